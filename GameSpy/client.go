@@ -3,6 +3,7 @@ package GameSpy
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
@@ -10,6 +11,7 @@ import (
 	"io"
 	"net"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/HeroesAwaken/GoAwaken/core"
@@ -27,6 +29,10 @@ type Client struct {
 	IpAddr     net.Addr
 	State      ClientState
 	FESL       bool
+	writer     FESLWriter
+
+	// lastActivity is the UnixNano of the last command, accessed atomically
+	lastActivity int64
 }
 
 type ClientState struct {
@@ -48,6 +54,14 @@ type ClientState struct {
 	ProfileSent     bool
 	LoggedOut       bool
 	HeartTicker     *time.Ticker
+	HeartCtx        context.Context
+	HeartCancel     context.CancelFunc
+	ClientVersion   string
+	Shard           string
+	LobbyID         string
+	Locale          string
+	IsServer        bool
+	GameID          string
 }
 
 // ClientEvent is the generic struct for events
@@ -71,6 +85,27 @@ func (client *Client) New(name string, conn *net.Conn) (chan ClientEvent, error)
 	return client.eventChan, nil
 }
 
+// NewWithWriter creates a Client without a connection, whose FESL packets
+// all go to writer
+func (client *Client) NewWithWriter(name string, writer FESLWriter) chan ClientEvent {
+	client.name = name
+	client.writer = writer
+	client.eventChan = make(chan ClientEvent, 1000)
+	client.IsActive = true
+
+	return client.eventChan
+}
+
+// Touch records that the client was active just now
+func (client *Client) Touch() {
+	atomic.StoreInt64(&client.lastActivity, time.Now().UnixNano())
+}
+
+// LastActivity returns when the client was last active
+func (client *Client) LastActivity() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&client.lastActivity))
+}
+
 func (client *Client) Write(command string) error {
 	if !client.IsActive {
 		log.Notef("%s: Trying to write to inactive client.\n%v", client.name, command)
@@ -125,6 +160,11 @@ func (client *Client) WriteFESL(msgType string, msg map[string]string, msgType2
 		log.Notef("%s: Trying to write to inactive Client.\n%v", client.name, msg)
 		return errors.New("ClientTLS is not active. Can't send message")
 	}
+
+	if client.writer != nil {
+		return client.writer.WriteFESL(msgType, msg, msgType2)
+	}
+
 	var lena int32
 	var buf bytes.Buffer
 
@@ -186,7 +226,7 @@ func (client *Client) readFESL(data []byte) []byte {
 
 		binary.Read(p, binary.BigEndian, &payloadLen)
 
-		log.Noteln("Current message: " + payloadType + " - " + fmt.Sprint(payloadID) + " - " + fmt.Sprint(payloadLen))
+		log.Debugln("Current message: " + payloadType + " - " + fmt.Sprint(payloadID) + " - " + fmt.Sprint(payloadLen))
 
 		if (payloadLen - 12) > uint32(len(p.Bytes())) {
 			log.Noteln("Packet not fully read")
@@ -2,6 +2,7 @@ package GameSpy
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -26,6 +27,7 @@ type ClientTLS struct {
 	RedisState *core.RedisState
 	State      ClientTLSState
 	FESL       bool
+	writer     FESLWriter
 }
 
 type ClientTLSState struct {
@@ -47,6 +49,8 @@ type ClientTLSState struct {
 	ProfileSent        bool
 	LoggedOut          bool
 	HeartTicker        *time.Ticker
+	HeartCtx           context.Context
+	HeartCancel        context.CancelFunc
 }
 
 type CommandFESL struct {
@@ -75,12 +79,27 @@ func (clientTLS *ClientTLS) New(name string, conn *tls.Conn) (chan ClientTLSEven
 	return clientTLS.eventChan, nil
 }
 
+// NewWithWriter creates a ClientTLS without a connection, whose FESL
+// packets all go to writer
+func (clientTLS *ClientTLS) NewWithWriter(name string, writer FESLWriter) chan ClientTLSEvent {
+	clientTLS.name = name
+	clientTLS.writer = writer
+	clientTLS.eventChan = make(chan ClientTLSEvent, 1000)
+	clientTLS.IsActive = true
+
+	return clientTLS.eventChan
+}
+
 func (clientTLS *ClientTLS) WriteFESL(msgType string, msg map[string]string, msgType2 uint32) error {
 
 	if !clientTLS.IsActive {
 		log.Notef("%s: Trying to write to inactive ClientTLS.\n%v", clientTLS.name, msg)
 		return errors.New("ClientTLS is not active. Can't send message")
 	}
+
+	if clientTLS.writer != nil {
+		return clientTLS.writer.WriteFESL(msgType, msg, msgType2)
+	}
 	var lena int32
 	var buf bytes.Buffer
 
@@ -180,7 +199,7 @@ func (clientTLS *ClientTLS) readFESL(data []byte) []byte {
 
 		binary.Read(p, binary.BigEndian, &payloadLen)
 
-		log.Noteln("Current message: " + payloadType + " - " + fmt.Sprint(payloadID) + " - " + fmt.Sprint(payloadLen))
+		log.Debugln("Current message: " + payloadType + " - " + fmt.Sprint(payloadID) + " - " + fmt.Sprint(payloadLen))
 
 		if (payloadLen - 12) > uint32(len(p.Bytes())) {
 			log.Noteln("Packet not fully read")
@@ -0,0 +1,34 @@
+package GameSpy
+
+// Error codes of FESL and theater answers, sent as errorCode next to a
+// localizedMessage the client shows
+const (
+	// ErrorCodeInvalid - the command was malformed or couldn't be handled
+	ErrorCodeInvalid = "99"
+	// ErrorCodeBanned - the account is banned
+	ErrorCodeBanned = "102"
+	// ErrorCodeVersionMismatch - the server runs another version of the game
+	ErrorCodeVersionMismatch = "103"
+	// ErrorCodeOtherLobby - the server is in a lobby the client isn't in
+	ErrorCodeOtherLobby = "104"
+	// ErrorCodeNameTaken - another server already uses the name
+	ErrorCodeNameTaken = "105"
+	// ErrorCodeWrongGamePassword - the password of the server is wrong
+	ErrorCodeWrongGamePassword = "106"
+	// ErrorCodeJoinInProgress - the server doesn't let players join mid-round
+	ErrorCodeJoinInProgress = "107"
+	// ErrorCodeRateLimited - the client sends commands too fast
+	ErrorCodeRateLimited = "108"
+	// ErrorCodeObserversFull - the server has no observer slot left
+	ErrorCodeObserversFull = "109"
+	// ErrorCodeJoinTimedOut - joining a server took too long
+	ErrorCodeJoinTimedOut = "110"
+	// ErrorCodeNotFound - the game, server or persona asked for doesn't exist
+	ErrorCodeNotFound = "111"
+	// ErrorCodeInternal - we failed, e.g. the database did
+	ErrorCodeInternal = "112"
+	// ErrorCodeNotEntitled - the account isn't allowed to do that
+	ErrorCodeNotEntitled = "120"
+	// ErrorCodeWrongPassword - the password of the account is wrong
+	ErrorCodeWrongPassword = "122"
+)
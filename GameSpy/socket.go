@@ -4,18 +4,22 @@ import (
 	"errors"
 	"net"
 	"strings"
+	"sync"
 
 	"github.com/HeroesAwaken/GoFesl/log"
 )
 
 // Socket is a basic event-based TCP-Server
 type Socket struct {
-	Clients   []*Client
-	name      string
-	port      string
-	listen    net.Listener
-	eventChan chan SocketEvent
-	fesl      bool
+	// Clients are changed on accept and close, use ConnectedClients to read
+	// them from other goroutines
+	Clients      []*Client
+	clientsMutex sync.Mutex
+	name         string
+	port         string
+	listen       net.Listener
+	eventChan    chan SocketEvent
+	fesl         bool
 }
 
 type EventError struct {
@@ -132,7 +136,9 @@ func (socket *Socket) run() {
 		}
 		go socket.handleClientEvents(newClient, clientEventSocket)
 
+		socket.clientsMutex.Lock()
 		socket.Clients = append(socket.Clients, newClient)
+		socket.clientsMutex.Unlock()
 
 		// Fire newClient event
 		socket.eventChan <- SocketEvent{
@@ -144,6 +150,14 @@ func (socket *Socket) run() {
 	}
 }
 
+// ConnectedClients returns a copy of the clients connected right now
+func (socket *Socket) ConnectedClients() []*Client {
+	socket.clientsMutex.Lock()
+	defer socket.clientsMutex.Unlock()
+
+	return append([]*Client(nil), socket.Clients...)
+}
+
 func (socket *Socket) removeClient(client *Client) error {
 	var indexToRemove = 0
 	var foundClient = false
@@ -153,6 +167,9 @@ func (socket *Socket) removeClient(client *Client) error {
 	client.IsActive = false
 	(*client.conn).Close()
 
+	socket.clientsMutex.Lock()
+	defer socket.clientsMutex.Unlock()
+
 	for i := range socket.Clients {
 		if socket.Clients[i] == client {
 			indexToRemove = i
@@ -2,10 +2,13 @@ package GameSpy
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"strings"
-
+	"sync"
 	"time"
 
 	"github.com/HeroesAwaken/GoFesl/log"
@@ -13,11 +16,14 @@ import (
 
 // Socket is a basic event-based TCP-Server
 type SocketTLS struct {
-	ClientsTLS []*ClientTLS
-	name       string
-	port       string
-	listen     net.Listener
-	eventChan  chan SocketEvent
+	// ClientsTLS are changed on accept and close, use ConnectedClients to
+	// read them from other goroutines
+	ClientsTLS   []*ClientTLS
+	clientsMutex sync.Mutex
+	name         string
+	port         string
+	listen       net.Listener
+	eventChan    chan SocketEvent
 }
 
 type EventNewClientTLS struct {
@@ -40,8 +46,24 @@ type EventClientTLSData struct {
 	Data   string
 }
 
-// New starts to listen on a new Socket
-func (socket *SocketTLS) New(name string, port string, tlsCert string, tlsKey string) (chan SocketEvent, error) {
+// ParseTLSVersion turns a version name (tls10, tls11, tls12) into the
+// matching crypto/tls constant. SSLv3 isn't offered, crypto/tls doesn't
+// support it anymore.
+func ParseTLSVersion(version string) (uint16, error) {
+	switch strings.ToLower(version) {
+	case "tls10":
+		return tls.VersionTLS10, nil
+	case "tls11":
+		return tls.VersionTLS11, nil
+	case "tls12":
+		return tls.VersionTLS12, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q", version)
+}
+
+// New starts to listen on a new Socket. tlsCA is optional, if set clients
+// presenting a certificate have to be signed by it.
+func (socket *SocketTLS) New(name string, port string, tlsCert string, tlsKey string, tlsCA string, minVersion uint16) (chan SocketEvent, error) {
 	var err error
 
 	socket.name = name
@@ -51,19 +73,33 @@ func (socket *SocketTLS) New(name string, port string, tlsCert string, tlsKey st
 	// Listen for incoming connections.
 	cer, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: loading certificate %s and key %s failed: %v", socket.name, tlsCert, tlsKey, err)
 	}
 
 	config := &tls.Config{
 		Certificates:       []tls.Certificate{cer},
 		ClientAuth:         tls.NoClientCert,
-		MinVersion:         tls.VersionSSL30,
+		MinVersion:         minVersion,
 		InsecureSkipVerify: true,
 		//MaxVersion:   tls.VersionSSL30,
 		CipherSuites: []uint16{
 			tls.TLS_RSA_WITH_RC4_128_SHA,
 		},
 	}
+
+	if tlsCA != "" {
+		caCert, err := ioutil.ReadFile(tlsCA)
+		if err != nil {
+			return nil, fmt.Errorf("%s: reading CA %s failed: %v", socket.name, tlsCA, err)
+		}
+
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("%s: CA %s contains no usable certificate", socket.name, tlsCA)
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
 	socket.listen, err = tls.Listen("tcp", "0.0.0.0:"+socket.port, config)
 
 	if err != nil {
@@ -157,7 +193,9 @@ func (socket *SocketTLS) run() {
 			go socket.handleClientEvents(newClient, clientEventSocket)
 
 			log.Noteln(socket.name + ": A new client connected")
+			socket.clientsMutex.Lock()
 			socket.ClientsTLS = append(socket.ClientsTLS, newClient)
+			socket.clientsMutex.Unlock()
 
 			// Fire newClient event
 			socket.eventChan <- SocketEvent{
@@ -170,6 +208,14 @@ func (socket *SocketTLS) run() {
 	}
 }
 
+// ConnectedClients returns a copy of the clients connected right now
+func (socket *SocketTLS) ConnectedClients() []*ClientTLS {
+	socket.clientsMutex.Lock()
+	defer socket.clientsMutex.Unlock()
+
+	return append([]*ClientTLS(nil), socket.ClientsTLS...)
+}
+
 func (socket *SocketTLS) removeClient(client *ClientTLS) error {
 	var indexToRemove = 0
 	var foundClient = false
@@ -179,6 +225,9 @@ func (socket *SocketTLS) removeClient(client *ClientTLS) error {
 	client.IsActive = false
 	(*client.conn).Close()
 
+	socket.clientsMutex.Lock()
+	defer socket.clientsMutex.Unlock()
+
 	for i := range socket.ClientsTLS {
 		if socket.ClientsTLS[i] == client {
 			indexToRemove = i
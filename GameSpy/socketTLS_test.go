@@ -0,0 +1,28 @@
+package GameSpy
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	tables := []struct {
+		version string
+		want    uint16
+		valid   bool
+	}{
+		{"tls10", tls.VersionTLS10, true},
+		{"TLS11", tls.VersionTLS11, true},
+		{"tls12", tls.VersionTLS12, true},
+		{"ssl30", 0, false},
+		{"ssl3", 0, false},
+		{"", 0, false},
+	}
+
+	for _, table := range tables {
+		version, err := ParseTLSVersion(table.version)
+		if (err == nil) != table.valid || version != table.want {
+			t.Errorf("ParseTLSVersion of %q was incorrect, got: %d, %v, want: %d.", table.version, version, err, table.want)
+		}
+	}
+}
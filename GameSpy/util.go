@@ -162,6 +162,18 @@ func ProcessFESL(data string) map[string]string {
 	return out
 }
 
+// StripQuotes removes a leading and a trailing quote from a FESL value, which
+// clients put around strings. Quotes inside the value are kept.
+func StripQuotes(value string) string {
+	if len(value) > 0 && value[0] == '"' {
+		value = value[1:]
+	}
+	if len(value) > 0 && value[len(value)-1] == '"' {
+		value = value[:len(value)-1]
+	}
+	return value
+}
+
 func SerializeFESL(data map[string]string) string {
 	var out string
 	for key, value := range data {
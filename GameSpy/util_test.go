@@ -60,3 +60,27 @@ func TestBF2RandomUnsafe(t *testing.T) {
 	}
 
 }
+
+func TestStripQuotes(t *testing.T) {
+	tables := []struct {
+		value    string
+		stripped string
+	}{
+		{"", ""},
+		{"\"", ""},
+		{"\"\"", ""},
+		{"a", "a"},
+		{"\"a\"", "a"},
+		{"\"Heroes Server\"", "Heroes Server"},
+		{"Heroes Server", "Heroes Server"},
+		{"\"The \"best\" server\"", "The \"best\" server"},
+		{"say \"hi\" there", "say \"hi\" there"},
+		{"\"unterminated", "unterminated"},
+	}
+
+	for _, table := range tables {
+		if stripped := GameSpy.StripQuotes(table.value); stripped != table.stripped {
+			t.Errorf("StripQuotes(%q) was incorrect, got: %q, want: %q.", table.value, stripped, table.stripped)
+		}
+	}
+}
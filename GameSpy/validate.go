@@ -0,0 +1,40 @@
+package GameSpy
+
+import "errors"
+
+var (
+	// ErrEmptyCommand is returned for commands without any payload
+	ErrEmptyCommand = errors.New("command has no payload")
+	// ErrMissingTID is returned for theater commands without a TID
+	ErrMissingTID = errors.New("command is missing its TID")
+	// ErrUnknownTXN is returned for FESL commands with a missing or unknown TXN
+	ErrUnknownTXN = errors.New("command has a missing or unknown TXN")
+)
+
+// ValidateTheaterCommand makes sure a theater command carries a TID, which
+// every answer needs so the client can correlate it
+func ValidateTheaterCommand(command *CommandFESL) error {
+	if command == nil || len(command.Message) == 0 {
+		return ErrEmptyCommand
+	}
+
+	if command.Message["TID"] == "" {
+		return ErrMissingTID
+	}
+
+	return nil
+}
+
+// ValidateFESLCommand makes sure a FESL command carries one of the TXNs in
+// knownTXNs
+func ValidateFESLCommand(command *CommandFESL, knownTXNs map[string]bool) error {
+	if command == nil || len(command.Message) == 0 {
+		return ErrEmptyCommand
+	}
+
+	if !knownTXNs[command.Message["TXN"]] {
+		return ErrUnknownTXN
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package GameSpy_test
+
+import (
+	"testing"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+)
+
+func TestValidateTheaterCommand(t *testing.T) {
+	tests := []struct {
+		command *GameSpy.CommandFESL
+		want    error
+	}{
+		{nil, GameSpy.ErrEmptyCommand},
+		{&GameSpy.CommandFESL{Query: "GDAT"}, GameSpy.ErrEmptyCommand},
+		{&GameSpy.CommandFESL{Query: "GDAT", Message: GameSpy.ProcessFESL("")}, GameSpy.ErrEmptyCommand},
+		{&GameSpy.CommandFESL{Query: "GDAT", Message: GameSpy.ProcessFESL("GID=1\nTID")}, GameSpy.ErrMissingTID},
+		{&GameSpy.CommandFESL{Query: "GDAT", Message: GameSpy.ProcessFESL("GID=1\nTID=")}, GameSpy.ErrMissingTID},
+		{&GameSpy.CommandFESL{Query: "GDAT", Message: GameSpy.ProcessFESL("GID=1\nTID=3")}, nil},
+	}
+
+	for _, test := range tests {
+		err := GameSpy.ValidateTheaterCommand(test.command)
+		if err != test.want {
+			t.Errorf("ValidateTheaterCommand was incorrect for %v, got: %v, want: %v.", test.command, err, test.want)
+		}
+	}
+}
+
+func TestValidateFESLCommand(t *testing.T) {
+	knownTXNs := map[string]bool{"Hello": true}
+
+	tests := []struct {
+		command *GameSpy.CommandFESL
+		want    error
+	}{
+		{nil, GameSpy.ErrEmptyCommand},
+		{&GameSpy.CommandFESL{Query: "fsys", Message: GameSpy.ProcessFESL("")}, GameSpy.ErrEmptyCommand},
+		{&GameSpy.CommandFESL{Query: "fsys", Message: GameSpy.ProcessFESL("clientType=server")}, GameSpy.ErrUnknownTXN},
+		{&GameSpy.CommandFESL{Query: "fsys", Message: GameSpy.ProcessFESL("TXN=")}, GameSpy.ErrUnknownTXN},
+		{&GameSpy.CommandFESL{Query: "fsys", Message: GameSpy.ProcessFESL("TXN=../../etc")}, GameSpy.ErrUnknownTXN},
+		{&GameSpy.CommandFESL{Query: "fsys", Message: GameSpy.ProcessFESL("TXN=Hello")}, nil},
+	}
+
+	for _, test := range tests {
+		err := GameSpy.ValidateFESLCommand(test.command, knownTXNs)
+		if err != test.want {
+			t.Errorf("ValidateFESLCommand was incorrect for %v, got: %v, want: %v.", test.command, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package GameSpy
+
+import (
+	"net"
+	"sync"
+)
+
+// FESLWriter is the write side of a FESL client connection
+type FESLWriter interface {
+	WriteFESL(msgType string, msg map[string]string, msgType2 uint32) error
+}
+
+// FESLWriterUDP is the write side of a FESL UDP socket
+type FESLWriterUDP interface {
+	WriteFESL(msgType string, msg map[string]string, msgType2 uint32, addr *net.UDPAddr) error
+}
+
+// Packet is a FESL packet captured by a Recorder
+type Packet struct {
+	Type    string
+	Message map[string]string
+	Type2   uint32
+	Addr    *net.UDPAddr
+}
+
+// Recorder captures FESL packets instead of sending them, so handlers can
+// be tested without a network
+type Recorder struct {
+	mutex   sync.Mutex
+	packets []Packet
+}
+
+// WriteFESL records a packet written to a client
+func (recorder *Recorder) WriteFESL(msgType string, msg map[string]string, msgType2 uint32) error {
+	return recorder.record(Packet{Type: msgType, Message: msg, Type2: msgType2})
+}
+
+// UDP returns a FESLWriterUDP recording into the same Recorder
+func (recorder *Recorder) UDP() FESLWriterUDP {
+	return recorderUDP{recorder}
+}
+
+// Packets returns all packets recorded so far
+func (recorder *Recorder) Packets() []Packet {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	return append([]Packet(nil), recorder.packets...)
+}
+
+func (recorder *Recorder) record(packet Packet) error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.packets = append(recorder.packets, packet)
+	return nil
+}
+
+type recorderUDP struct {
+	recorder *Recorder
+}
+
+func (udp recorderUDP) WriteFESL(msgType string, msg map[string]string, msgType2 uint32, addr *net.UDPAddr) error {
+	return udp.recorder.record(Packet{Type: msgType, Message: msg, Type2: msgType2, Addr: addr})
+}
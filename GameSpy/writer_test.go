@@ -0,0 +1,36 @@
+package GameSpy
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	recorder := new(Recorder)
+
+	client := new(Client)
+	client.NewWithWriter("test", recorder)
+	client.WriteFESL("CONN", map[string]string{"TID": "1"}, 0x0)
+
+	addr := &net.UDPAddr{IP: net.ParseIP("203.0.113.5"), Port: 18275}
+	recorder.UDP().WriteFESL("ECHO", map[string]string{"TID": "2"}, 0x0, addr)
+
+	packets := recorder.Packets()
+	if len(packets) != 2 {
+		t.Fatalf("Recorded packets were incorrect, got: %d, want: %d.", len(packets), 2)
+	}
+	if packets[0].Type != "CONN" || packets[0].Message["TID"] != "1" {
+		t.Errorf("First packet was incorrect, got: %s %v, want: %s %v.", packets[0].Type, packets[0].Message, "CONN", map[string]string{"TID": "1"})
+	}
+	if packets[1].Type != "ECHO" || packets[1].Addr != addr {
+		t.Errorf("Second packet was incorrect, got: %s %v, want: %s %v.", packets[1].Type, packets[1].Addr, "ECHO", addr)
+	}
+
+	client.IsActive = false
+	if err := client.WriteFESL("CONN", map[string]string{}, 0x0); err == nil {
+		t.Errorf("Writing to an inactive client was incorrect, got: %v, want: an error.", err)
+	}
+	if len(recorder.Packets()) != 2 {
+		t.Errorf("Recorded packets were incorrect, got: %d, want: %d.", len(recorder.Packets()), 2)
+	}
+}
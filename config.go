@@ -4,21 +4,62 @@ import (
 	"io/ioutil"
 	"log"
 
+	"github.com/HeroesAwaken/GoFesl/theater"
 	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	MysqlServer      string
-	MysqlUser        string
-	MysqlDb          string
-	MysqlPw          string
-	RedisServer      string
-	RedisPassword    string
-	RedisDB          int
-	InfluxDBHost     string
-	InfluxDBDatabase string
-	InfluxDBUser     string
-	InfluxDBPassword string
+	MysqlServer             string
+	MysqlUser               string
+	MysqlDb                 string
+	MysqlPw                 string
+	RedisServer             string
+	RedisPassword           string
+	RedisDB                 int
+	InfluxDBHost            string
+	InfluxDBDatabase        string
+	InfluxDBUser            string
+	InfluxDBPassword        string
+	PublicIP                string
+	TheaterHost             string
+	MessengerHost           string
+	MessengerPort           string
+	ActivityTimeout         int
+	Platform                string
+	PlatformNames           map[string]string
+	DataCenter              string
+	ResolveHostnames        bool
+	MaxConcurrentScans      int
+	ShardNetworks           map[string][]string
+	AllowCrossLobbyJoins    bool
+	MapDisplayNames         map[string]map[string]string
+	Lobbies                 []theater.Lobby
+	MaxLobbies              int
+	ServerNamePolicy        string
+	FallbackNickname        string
+	CommandsPerSecond       float64
+	CommandBurst            float64
+	ServerCommandsPerSecond float64
+	ServerCommandBurst      float64
+	AnswerRateLimited       bool
+	OwnerPattern            string
+	AdminSecret             string
+	WarmGetStatsKeys        []int
+	WarmServerStatsKeys     []int
+	IdleTimeout             int
+	JoinTimeout             int
+	AnswerPing              bool
+	StatsTables             map[string]string
+	LogFile                 string
+	LogFileMaxSize          int64
+	LogFileMaxAge           int
+	MinPasswordLength       int
+	HelloTime               string
+	Ticket                  string
+	EncryptionKey           string
+	Secret                  string
+	HostUserID              string
+	XUID                    string
 }
 
 func (config *Config) Parse(data []byte) error {
@@ -0,0 +1,44 @@
+package fesl
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+)
+
+// clientIP returns the IP of addr, which may be IPv4 or IPv6. IPv4 clients
+// connecting to an IPv6 socket (::ffff:a.b.c.d) get their IPv4 address.
+func clientIP(addr net.Addr) (net.IP, bool) {
+	var ip net.IP
+
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		ip = addr.IP
+	default:
+		if addr == nil {
+			return nil, false
+		}
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return nil, false
+		}
+		ip = net.ParseIP(host)
+	}
+
+	if ip == nil {
+		return nil, false
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return ipv4, true
+	}
+	return ip, true
+}
+
+// matchmakingAddress formats ip for the matchmaking api, which knows IPv4
+// addresses by their number. IPv6 addresses are sent as they are.
+func matchmakingAddress(ip net.IP) string {
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return strconv.FormatUint(uint64(binary.BigEndian.Uint32(ipv4)), 10)
+	}
+	return ip.String()
+}
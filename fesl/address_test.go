@@ -0,0 +1,38 @@
+package fesl
+
+import (
+	"net"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tables := []struct {
+		addr        net.Addr
+		ip          string
+		matchmaking string
+		ok          bool
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 18270}, "203.0.113.5", "3405803781", true},
+		{&net.TCPAddr{IP: net.ParseIP("::ffff:203.0.113.5"), Port: 18270}, "203.0.113.5", "3405803781", true},
+		{&net.TCPAddr{IP: net.ParseIP("2001:DB8::1"), Port: 18270}, "2001:db8::1", "2001:db8::1", true},
+		{&net.TCPAddr{}, "", "", false},
+		{nil, "", "", false},
+	}
+
+	for _, table := range tables {
+		ip, ok := clientIP(table.addr)
+		if ok != table.ok {
+			t.Errorf("clientIP(%v) was incorrect, got ok: %t, want: %t.", table.addr, ok, table.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if ip.String() != table.ip {
+			t.Errorf("clientIP(%v) was incorrect, got: %s, want: %s.", table.addr, ip, table.ip)
+		}
+		if address := matchmakingAddress(ip); address != table.matchmaking {
+			t.Errorf("matchmakingAddress(%s) was incorrect, got: %s, want: %s.", ip, address, table.matchmaking)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package fesl
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Config are the addresses and timeouts a FeslManager hands out to clients
+// in its Hello, and what it accepts from them
+type Config struct {
+	// TheaterHost is where clients find the theater, localhost in localMode
+	TheaterHost string
+	// TheaterPort is the port of the theater belonging to the manager, the
+	// one of game servers for a server FeslManager
+	TheaterPort string
+	// MessengerHost and MessengerPort are where clients find the messenger
+	MessengerHost string
+	MessengerPort string
+	// ActivityTimeout is how long clients may stay silent
+	ActivityTimeout time.Duration
+	// HelloTime is sent as curTime in the Hello, the current time if empty
+	HelloTime string
+
+	// OwnerPattern is what owners of GetStats requests have to look like,
+	// persona ids are numeric
+	OwnerPattern *regexp.Regexp
+	// MinPasswordLength is the shortest password NuUpdateAccount accepts
+	MinPasswordLength int
+}
+
+// DefaultConfig returns the settings used for anything left unconfigured
+func DefaultConfig() Config {
+	return Config{
+		TheaterHost:     "theater.heroesawaken.com",
+		TheaterPort:     "18275",
+		MessengerHost:   "messaging.ea.com",
+		MessengerPort:   "13505",
+		ActivityTimeout: time.Hour,
+
+		OwnerPattern:      regexp.MustCompile("^[0-9]{1,20}$"),
+		MinPasswordLength: 8,
+	}
+}
+
+// Validate checks for settings a FeslManager can't work with
+func (config Config) Validate() error {
+	if config.TheaterHost == "" {
+		return errors.New("TheaterHost is missing")
+	}
+	if !validPort(config.TheaterPort) {
+		return errors.New("invalid TheaterPort " + config.TheaterPort)
+	}
+	if config.MessengerHost == "" {
+		return errors.New("MessengerHost is missing")
+	}
+	if !validPort(config.MessengerPort) {
+		return errors.New("invalid MessengerPort " + config.MessengerPort)
+	}
+	if config.ActivityTimeout < time.Second {
+		return errors.New("ActivityTimeout must be at least a second")
+	}
+	if config.OwnerPattern == nil {
+		return errors.New("OwnerPattern is missing")
+	}
+	if config.MinPasswordLength < 1 || config.MinPasswordLength > maxPasswordLength {
+		return errors.New("MinPasswordLength must be between 1 and " + strconv.Itoa(maxPasswordLength))
+	}
+	return nil
+}
+
+func validPort(port string) bool {
+	number, err := strconv.Atoi(port)
+	return err == nil && number > 0 && number < 65536
+}
@@ -0,0 +1,31 @@
+package fesl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tables := []struct {
+		change func(*Config)
+		valid  bool
+	}{
+		{func(config *Config) {}, true},
+		{func(config *Config) { config.TheaterHost = "" }, false},
+		{func(config *Config) { config.TheaterPort = "port" }, false},
+		{func(config *Config) { config.MessengerPort = "70000" }, false},
+		{func(config *Config) { config.ActivityTimeout = time.Millisecond }, false},
+		{func(config *Config) { config.OwnerPattern = nil }, false},
+		{func(config *Config) { config.MinPasswordLength = 0 }, false},
+		{func(config *Config) { config.MinPasswordLength = 100 }, false},
+	}
+
+	for i, table := range tables {
+		config := DefaultConfig()
+		table.change(&config)
+
+		if err := config.Validate(); (err == nil) != table.valid {
+			t.Errorf("Validate of config %d was incorrect, got: %v, want valid: %t.", i, err, table.valid)
+		}
+	}
+}
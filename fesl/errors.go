@@ -0,0 +1,15 @@
+package fesl
+
+import "github.com/HeroesAwaken/GoFesl/GameSpy"
+
+// writeError answers a command with an error, see the GameSpy.ErrorCode
+// constants for the codes
+func (fM *FeslManager) writeError(event GameSpy.EventClientTLSCommand, code string, message string) {
+	answer := make(map[string]string)
+	answer["TXN"] = event.Command.Message["TXN"]
+	answer["localizedMessage"] = "\"" + message + "\""
+	answer["errorContainer.[]"] = "0"
+	answer["errorCode"] = code
+	event.Client.WriteFESL(event.Command.Query, answer, event.Command.PayloadID)
+	fM.logAnswer(event.Command.Query, answer, event.Command.PayloadID)
+}
@@ -0,0 +1,100 @@
+package fesl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/metrics"
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGetStatsDatabaseError(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Starting miniredis failed: %s", err)
+	}
+	defer mr.Close()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Creating sqlmock failed: %s", err)
+	}
+	defer db.Close()
+
+	fM := new(FeslManager)
+	fM.config = DefaultConfig()
+	fM.db = db
+	fM.prepareStatsStatements(db)
+
+	mock.ExpectPrepare("FROM game_stats").ExpectQuery().WillReturnError(errors.New("Error 1146: Table 'game_stats' doesn't exist"))
+
+	recorder := new(GameSpy.Recorder)
+	client := new(GameSpy.ClientTLS)
+	client.NewWithWriter("test", recorder)
+	client.RedisState = new(core.RedisState)
+	client.RedisState.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "client-test")
+	client.RedisState.Set("uID", "1")
+
+	fM.GetStats(GameSpy.EventClientTLSCommand{
+		Client: client,
+		Command: &GameSpy.CommandFESL{
+			Query:     "rank",
+			PayloadID: 0xc0000005,
+			Message:   map[string]string{"TXN": "GetStats", "owner": "2", "keys.[]": "1", "keys.0": "level"},
+		},
+	})
+
+	packets := recorder.Packets()
+	if len(packets) != 1 {
+		t.Fatalf("GetStats packets were incorrect, got: %v, want: one error.", packets)
+	}
+	want := map[string]string{
+		"TXN":               "GetStats",
+		"errorCode":         "112",
+		"errorContainer.[]": "0",
+		"localizedMessage":  "\"The stats couldn't be loaded.\"",
+	}
+	for key, value := range want {
+		if packets[0].Message[key] != value {
+			t.Errorf("GetStats %s was incorrect, got: %s, want: %s.", key, packets[0].Message[key], value)
+		}
+	}
+	if packets[0].Type2 != 0xc0000005 {
+		t.Errorf("GetStats payload id was incorrect, got: %x, want: %x.", packets[0].Type2, 0xc0000005)
+	}
+}
+
+func TestRejectCommandLabel(t *testing.T) {
+	fM := new(FeslManager)
+	fM.name = "rejections"
+
+	tables := []struct {
+		txn   string
+		label string
+	}{
+		{"NuLogin", "NuLogin"},
+		{"MadeUp", metrics.UnknownCommand},
+		{"", metrics.UnknownCommand},
+	}
+
+	for _, table := range tables {
+		outcome := metrics.CommandOutcomes.WithLabelValues("rejections", table.label, metrics.OutcomeRejected, "malformed")
+		before := testutil.ToFloat64(outcome)
+
+		client := new(GameSpy.ClientTLS)
+		client.NewWithWriter("test", new(GameSpy.Recorder))
+		fM.rejectCommand(GameSpy.EventClientTLSCommand{
+			Client:  client,
+			Command: &GameSpy.CommandFESL{Query: "acct", Message: map[string]string{"TXN": table.txn}},
+		}, errors.New("unknown TXN"))
+
+		if count := testutil.ToFloat64(outcome) - before; count != 1 {
+			t.Errorf("rejectCommand of %q was incorrect, got count: %v under %s, want: %v.", table.txn, count, table.label, 1)
+		}
+	}
+}
@@ -1,17 +1,20 @@
 package fesl
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/HeroesAwaken/GoAwaken/core"
 	"github.com/HeroesAwaken/GoFesl/GameSpy"
 	"github.com/HeroesAwaken/GoFesl/lib"
 	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/HeroesAwaken/GoFesl/metrics"
 
 	"github.com/go-redis/redis"
 )
@@ -28,6 +31,8 @@ type FeslManager struct {
 	server        bool
 	iDB           *core.InfluxDB
 	localMode     bool
+	config        Config
+	bans          *lib.BanChecker
 
 	// Database Statements
 	stmtGetUserByGameToken              *sql.Stmt
@@ -39,41 +44,81 @@ type FeslManager struct {
 	stmtGetHeroeByName                  *sql.Stmt
 	stmtGetHeroeByID                    *sql.Stmt
 	stmtClearGameServerStats            *sql.Stmt
-	mapGetStatsVariableAmount           map[int]*sql.Stmt
-	mapGetServerStatsVariableAmount     map[int]*sql.Stmt
-	mapSetStatsVariableAmount           map[int]*sql.Stmt
-	mapSetServerStatsVariableAmount     map[int]*sql.Stmt
+	stmtAddEntitlement                  *sql.Stmt
+	stmtGetUserPasswordByID             *sql.Stmt
+	stmtLockUserPasswordByID            *sql.Stmt
+	stmtUpdateUserEmail                 *sql.Stmt
+	stmtUpdateUserPassword              *sql.Stmt
+
+	// Statements depending on the amount of stats, the stats ones by table.
+	// They're prepared on statsDB, wrapping db, to survive reconnects.
+	statsDB                  *lib.DB
+	getStatsStatements       map[string]*lib.StmtCache
+	setStatsStatements       map[string]*lib.StmtCache
+	topNStatements           map[string]*lib.Stmt
+	statsStatementsMutex     sync.Mutex
+	getServerStatsStatements lib.StmtCache
 }
 
 var Shard string
 
-// New creates and starts a new ClientManager
-func (fM *FeslManager) New(name string, port string, certFile string, keyFile string, server bool, db *sql.DB, redis *redis.Client, iDB *core.InfluxDB, localMode bool) {
+// knownTXNs are the TXNs we accept from clients, everything else gets
+// rejected before it reaches a handler
+var knownTXNs = map[string]bool{
+	"Hello":              true,
+	"MemCheck":           true,
+	"GetSessionId":       true,
+	"Goodbye":            true,
+	"Ping":               true,
+	"NuLogin":            true,
+	"NuGetPersonas":      true,
+	"NuGetAccount":       true,
+	"NuUpdateAccount":    true,
+	"NuLoginPersona":     true,
+	"NuGrantEntitlement": true,
+	"GetStatsForOwners":  true,
+	"GetStats":           true,
+	"GetTopN":            true,
+	"NuLookupUserInfo":   true,
+	"GetPingSites":       true,
+	"UpdateStats":        true,
+	"GetTelemetryToken":  true,
+	"Start":              true,
+}
+
+// New creates and starts a new ClientManager. caFile is optional and
+// minTLSVersion is one of the crypto/tls version constants.
+func (fM *FeslManager) New(name string, port string, certFile string, keyFile string, caFile string, minTLSVersion uint16, server bool, config Config, db *sql.DB, redis *redis.Client, iDB *core.InfluxDB, localMode bool) error {
 	var err error
 
 	fM.socket = new(GameSpy.SocketTLS)
 	fM.db = db
 	fM.redis = redis
 	fM.name = name
-	fM.eventsChannel, err = fM.socket.New(fM.name, port, certFile, keyFile)
+	fM.eventsChannel, err = fM.socket.New(fM.name, port, certFile, keyFile, caFile, minTLSVersion)
+	if err != nil {
+		return err
+	}
 	fM.stopTicker = make(chan bool, 1)
 	fM.server = server
+	fM.config = config
 	fM.iDB = iDB
 	fM.localMode = localMode
 
-	fM.mapGetStatsVariableAmount = make(map[int]*sql.Stmt)
-	fM.mapGetServerStatsVariableAmount = make(map[int]*sql.Stmt)
-	fM.mapSetStatsVariableAmount = make(map[int]*sql.Stmt)
-
 	// Prepare database statements
+	fM.prepareStatsStatements(db)
 	fM.prepareStatements()
+
+	fM.bans = new(lib.BanChecker)
+	err = fM.bans.New(fM.db, time.Second*30)
 	if err != nil {
-		log.Errorln(err)
+		log.Fatalln("Error preparing ban lookup.", err.Error())
 	}
 
-	_, err = fM.stmtClearGameServerStats.Exec()
+	// Theaters of this shard store theirs as Shard-<theater shard>
+	_, err = fM.stmtClearGameServerStats.Exec(Shard, Shard+"-%")
 	if err != nil {
-		log.Panicln("Error clearing out game server stats", err)
+		log.Errorln("Error clearing out game server stats", err)
 	}
 
 	// Collect metrics every 10 seconds
@@ -85,86 +130,133 @@ func (fM *FeslManager) New(name string, port string, certFile string, keyFile st
 	}()
 
 	go fM.run()
+
+	return nil
 }
 
-func (fM *FeslManager) getServerStatsVariableAmount(statsAmount int) *sql.Stmt {
-	var err error
+// prepareStatsStatements sets up the caches of the statements depending on
+// the amount of stats
+func (fM *FeslManager) prepareStatsStatements(db *sql.DB) {
+	// Not pinging, the fixed statements share the pool and notice lost
+	// connections on their own
+	fM.statsDB = new(lib.DB)
+	fM.statsDB.New(db, 0)
+
+	fM.getStatsStatements = make(map[string]*lib.StmtCache)
+	fM.setStatsStatements = make(map[string]*lib.StmtCache)
+	fM.topNStatements = make(map[string]*lib.Stmt)
+	fM.getServerStatsStatements.New(fM.statsDB, getServerStatsQuery)
+}
 
-	// Check if we already have a statement prepared for that amount of stats
-	if statement, ok := fM.mapGetServerStatsVariableAmount[statsAmount]; ok {
-		return statement
-	}
+// statsStatements returns the cache of a stats table, creating it on first use
+func (fM *FeslManager) statsStatements(caches map[string]*lib.StmtCache, table string, query func(table string) func(statsAmount int) string) *lib.StmtCache {
+	fM.statsStatementsMutex.Lock()
+	defer fM.statsStatementsMutex.Unlock()
 
-	var query string
-	for i := 1; i < statsAmount; i++ {
-		query += "?, "
+	cache, ok := caches[table]
+	if !ok {
+		cache = new(lib.StmtCache)
+		cache.New(fM.statsDB, query(table))
+		caches[table] = cache
 	}
+	return cache
+}
 
-	sql := "SELECT gid, statsKey, statsValue" +
-		"	FROM game_server_stats" +
-		"	WHERE gid=?" +
-		"		AND statsKey IN (" + query + "?)"
+// topNStatement returns the leaderboard statement of a stats table,
+// preparing it on first use
+func (fM *FeslManager) topNStatement(table string) (*lib.Stmt, error) {
+	fM.statsStatementsMutex.Lock()
+	defer fM.statsStatementsMutex.Unlock()
 
-	fM.mapGetServerStatsVariableAmount[statsAmount], err = fM.db.Prepare(sql)
-	if err != nil {
-		log.Fatalln("Error preparing mapGetServerStatsVariableAmount with "+sql+" query.", err.Error())
+	if statement, ok := fM.topNStatements[table]; ok {
+		return statement, nil
 	}
 
-	return fM.mapGetServerStatsVariableAmount[statsAmount]
+	statement, err := fM.statsDB.Prepare(getTopNQuery(table))
+	if err != nil {
+		return nil, err
+	}
+	fM.topNStatements[table] = statement
+	return statement, nil
 }
 
-func (fM *FeslManager) getStatsStatement(statsAmount int) *sql.Stmt {
-	var err error
+// getTopNQuery ranks the heroes of a stats table by one stat. Stats of
+// deleted heroes aren't ranked.
+func getTopNQuery(table string) string {
+	return "SELECT stats.heroID, game_heroes.heroName, stats.statsValue" +
+		"	FROM " + table + " AS stats" +
+		"	INNER JOIN game_heroes" +
+		"		ON game_heroes.id=stats.heroID" +
+		"	WHERE stats.statsKey = ?" +
+		"	ORDER BY CAST(stats.statsValue AS DECIMAL(20,4)) DESC" +
+		"	LIMIT ? OFFSET ?"
+}
 
-	// Check if we already have a statement prepared for that amount of stats
-	if statement, ok := fM.mapGetStatsVariableAmount[statsAmount]; ok {
-		return statement
+func (fM *FeslManager) getServerStatsVariableAmount(statsAmount int) *lib.Stmt {
+	statement, err := fM.getServerStatsStatements.Get(statsAmount)
+	if err != nil {
+		log.Fatalln("Error preparing getServerStatsVariableAmount with "+getServerStatsQuery(statsAmount)+" query.", err.Error())
 	}
+	return statement
+}
 
+func getServerStatsQuery(statsAmount int) string {
 	var query string
 	for i := 1; i < statsAmount; i++ {
 		query += "?, "
 	}
 
-	sql := "SELECT user_id, heroID, statsKey, statsValue" +
-		"	FROM game_stats" +
-		"	WHERE heroID=?" +
-		"		AND user_id=?" +
+	return "SELECT gid, statsKey, statsValue" +
+		"	FROM game_server_stats" +
+		"	WHERE gid=?" +
+		"		AND shard=?" +
 		"		AND statsKey IN (" + query + "?)"
+}
 
-	fM.mapGetStatsVariableAmount[statsAmount], err = fM.db.Prepare(sql)
+func (fM *FeslManager) getStatsStatement(table string, statsAmount int) *lib.Stmt {
+	statement, err := fM.statsStatements(fM.getStatsStatements, table, getStatsQuery).Get(statsAmount)
 	if err != nil {
-		log.Fatalln("Error preparing stmtGetStatsVariableAmount with "+sql+" query.", err.Error())
+		log.Fatalln("Error preparing getStatsStatement with "+getStatsQuery(table)(statsAmount)+" query.", err.Error())
 	}
-
-	return fM.mapGetStatsVariableAmount[statsAmount]
+	return statement
 }
 
-func (fM *FeslManager) setStatsStatement(statsAmount int) *sql.Stmt {
-	var err error
+func getStatsQuery(table string) func(statsAmount int) string {
+	return func(statsAmount int) string {
+		var query string
+		for i := 1; i < statsAmount; i++ {
+			query += "?, "
+		}
 
-	// Check if we already have a statement prepared for that amount of stats
-	if statement, ok := fM.mapSetStatsVariableAmount[statsAmount]; ok {
-		return statement
+		return "SELECT user_id, heroID, statsKey, statsValue" +
+			"	FROM " + table +
+			"	WHERE heroID=?" +
+			"		AND user_id=?" +
+			"		AND statsKey IN (" + query + "?)"
 	}
+}
 
-	var query string
-	for i := 1; i < statsAmount; i++ {
-		query += "(?, ?, ?, ?), "
+func (fM *FeslManager) setStatsStatement(table string, statsAmount int) *lib.Stmt {
+	statement, err := fM.statsStatements(fM.setStatsStatements, table, setStatsQuery).Get(statsAmount)
+	if err != nil {
+		log.Fatalln("Error preparing setStatsStatement with "+setStatsQuery(table)(statsAmount)+" query.", err.Error())
 	}
+	return statement
+}
 
-	sql := "INSERT INTO game_stats" +
-		"	(user_id, heroID, statsKey, statsValue)" +
-		"	VALUES " + query + "(?, ?, ?, ?)" +
-		"	ON DUPLICATE KEY UPDATE" +
-		"	statsValue=VALUES(statsValue)"
+func setStatsQuery(table string) func(statsAmount int) string {
+	return func(statsAmount int) string {
+		var query string
+		for i := 1; i < statsAmount; i++ {
+			query += "(?, ?, ?, ?), "
+		}
 
-	fM.mapSetStatsVariableAmount[statsAmount], err = fM.db.Prepare(sql)
-	if err != nil {
-		log.Fatalln("Error preparing stmtSetStatsVariableAmount with "+sql+" query.", err.Error())
+		return "INSERT INTO " + table +
+			"	(user_id, heroID, statsKey, statsValue)" +
+			"	VALUES " + query + "(?, ?, ?, ?)" +
+			"	ON DUPLICATE KEY UPDATE" +
+			"	statsValue=VALUES(statsValue)"
 	}
-
-	return fM.mapSetStatsVariableAmount[statsAmount]
 }
 
 func (fM *FeslManager) prepareStatements() {
@@ -248,10 +340,62 @@ func (fM *FeslManager) prepareStatements() {
 	}
 
 	fM.stmtClearGameServerStats, err = fM.db.Prepare(
-		"DELETE FROM game_server_stats")
+		"DELETE FROM game_server_stats WHERE shard = ? OR shard LIKE ?")
 	if err != nil {
 		log.Fatalln("Error preparing stmtClearGameServerStats.", err.Error())
 	}
+
+	fM.prepareEntitlementStatements()
+
+	fM.stmtGetUserPasswordByID, err = fM.db.Prepare(
+		"SELECT password" +
+			"	FROM users" +
+			"	WHERE id = ?")
+	if err != nil {
+		log.Fatalln("Error preparing stmtGetUserPasswordByID.", err.Error())
+	}
+
+	fM.stmtLockUserPasswordByID, err = fM.db.Prepare(
+		"SELECT password" +
+			"	FROM users" +
+			"	WHERE id = ?" +
+			"	FOR UPDATE")
+	if err != nil {
+		log.Fatalln("Error preparing stmtLockUserPasswordByID.", err.Error())
+	}
+
+	fM.stmtUpdateUserEmail, err = fM.db.Prepare(
+		"UPDATE users" +
+			"	SET email = ?, updated_at = NOW()" +
+			"	WHERE id = ?")
+	if err != nil {
+		log.Fatalln("Error preparing stmtUpdateUserEmail.", err.Error())
+	}
+
+	fM.stmtUpdateUserPassword, err = fM.db.Prepare(
+		"UPDATE users" +
+			"	SET password = ?, updated_at = NOW()" +
+			"	WHERE id = ?")
+	if err != nil {
+		log.Fatalln("Error preparing stmtUpdateUserPassword.", err.Error())
+	}
+}
+
+// prepareEntitlementStatements sets up the statements granting entitlements.
+// They rely on a UNIQUE (user_id, group_name, tag) key on entitlements.
+func (fM *FeslManager) prepareEntitlementStatements() {
+	var err error
+
+	// Granting an entitlement twice doesn't change the row, so the second
+	// grant affects 0 rows
+	fM.stmtAddEntitlement, err = fM.db.Prepare(
+		"INSERT INTO entitlements" +
+			"	(user_id, group_name, tag, granted_at)" +
+			"	VALUES (?, ?, ?, NOW())" +
+			"	ON DUPLICATE KEY UPDATE user_id = user_id")
+	if err != nil {
+		log.Fatalln("Error preparing stmtAddEntitlement.", err.Error())
+	}
 }
 
 func (fM *FeslManager) closeStatements() {
@@ -263,16 +407,25 @@ func (fM *FeslManager) closeStatements() {
 	fM.stmtGetHeroesByUserID.Close()
 	fM.stmtGetHeroeByName.Close()
 	fM.stmtClearGameServerStats.Close()
+	fM.stmtAddEntitlement.Close()
+	fM.stmtGetUserPasswordByID.Close()
+	fM.stmtLockUserPasswordByID.Close()
+	fM.stmtUpdateUserEmail.Close()
+	fM.stmtUpdateUserPassword.Close()
 
-	// Close the dynamic lenght getStats statements
-	for index := range fM.mapGetStatsVariableAmount {
-		fM.mapGetStatsVariableAmount[index].Close()
+	// Close the dynamic lenght stats statements
+	fM.statsStatementsMutex.Lock()
+	for _, cache := range fM.getStatsStatements {
+		cache.Close()
 	}
-
-	// Close the dynamic lenght setStats statements
-	for index := range fM.mapSetStatsVariableAmount {
-		fM.mapSetStatsVariableAmount[index].Close()
+	for _, cache := range fM.setStatsStatements {
+		cache.Close()
+	}
+	for _, statement := range fM.topNStatements {
+		statement.Close()
 	}
+	fM.statsStatementsMutex.Unlock()
+	fM.getServerStatsStatements.Close()
 }
 
 func (fM *FeslManager) userHasPermission(id string, slug string) bool {
@@ -292,19 +445,37 @@ func (fM *FeslManager) userHasPermission(id string, slug string) bool {
 }
 
 func (fM *FeslManager) collectMetrics() {
+	clients := len(fM.socket.ConnectedClients())
+
 	// Create a point and add to batch
 	tags := map[string]string{"clients": "clients-total", "server": "feslManager" + fM.name}
 	fields := map[string]interface{}{
-		"clients": len(fM.socket.ClientsTLS),
+		"clients": clients,
 	}
 
 	fM.iDB.AddMetric("clients_total", tags, fields)
+
+	metrics.ClientsConnected.WithLabelValues(fM.name).Set(float64(clients))
 }
 
 func (fM *FeslManager) run() {
 	for {
 		select {
 		case event := <-fM.eventsChannel:
+			if command, ok := event.Data.(GameSpy.EventClientTLSCommand); ok {
+				if err := GameSpy.ValidateFESLCommand(command.Command, knownTXNs); err != nil {
+					// Every command arrives twice, only answer the specific one
+					if event.Name != "client.command" {
+						fM.rejectCommand(command, err)
+					}
+					continue
+				}
+
+				if event.Name == "client.command" {
+					metrics.Commands.WithLabelValues(fM.name, command.Command.Message["TXN"]).Inc()
+				}
+			}
+
 			switch {
 			case event.Name == "newClient":
 				fM.newClient(event.Data.(GameSpy.EventNewClientTLS))
@@ -316,12 +487,19 @@ func (fM *FeslManager) run() {
 				fM.NuGetPersonas(event.Data.(GameSpy.EventClientTLSCommand))
 			case event.Name == "client.command.NuGetAccount":
 				fM.NuGetAccount(event.Data.(GameSpy.EventClientTLSCommand))
+			case event.Name == "client.command.NuUpdateAccount":
+				// Hashing passwords is slow, so it mustn't hold up the others
+				go fM.NuUpdateAccount(event.Data.(GameSpy.EventClientTLSCommand))
 			case event.Name == "client.command.NuLoginPersona":
 				fM.NuLoginPersona(event.Data.(GameSpy.EventClientTLSCommand))
+			case event.Name == "client.command.NuGrantEntitlement":
+				fM.NuGrantEntitlement(event.Data.(GameSpy.EventClientTLSCommand))
 			case event.Name == "client.command.GetStatsForOwners":
 				fM.GetStatsForOwners(event.Data.(GameSpy.EventClientTLSCommand))
 			case event.Name == "client.command.GetStats":
 				fM.GetStats(event.Data.(GameSpy.EventClientTLSCommand))
+			case event.Name == "client.command.GetTopN":
+				fM.GetTopN(event.Data.(GameSpy.EventClientTLSCommand))
 			case event.Name == "client.command.NuLookupUserInfo":
 				fM.NuLookupUserInfo(event.Data.(GameSpy.EventClientTLSCommand))
 			case event.Name == "client.command.GetPingSites":
@@ -332,8 +510,14 @@ func (fM *FeslManager) run() {
 				fM.GetTelemetryToken(event.Data.(GameSpy.EventClientTLSCommand))
 			case event.Name == "client.command.Start":
 				fM.Start(event.Data.(GameSpy.EventClientTLSCommand))
+			case event.Name == "client.command.Goodbye":
+				fM.Goodbye(event.Data.(GameSpy.EventClientTLSCommand))
 			case event.Name == "client.close":
 				fM.close(event.Data.(GameSpy.EventClientTLSClose))
+			case event.Name == "client.error":
+				data := event.Data.([]interface{})
+				err, _ := data[1].(error)
+				fM.error(GameSpy.EventClientTLSError{Client: data[0].(*GameSpy.ClientTLS), Error: err})
 			case event.Name == "client.command":
 				fM.LogCommand(event.Data.(GameSpy.EventClientTLSCommand))
 				log.Debugf("Got event %s.%s: %v", event.Name, event.Data.(GameSpy.EventClientTLSCommand).Command.Message["TXN"], event.Data.(GameSpy.EventClientTLSCommand).Command)
@@ -347,6 +531,14 @@ func (fM *FeslManager) run() {
 	fM.closeStatements()
 }
 
+// rejectCommand - answers a malformed command with a protocol error
+func (fM *FeslManager) rejectCommand(event GameSpy.EventClientTLSCommand, err error) {
+	log.Warningln("Rejecting malformed command", event.Command.Query, "from", event.Client.IpAddr, err)
+	metrics.CommandOutcome(fM.name, metrics.CommandLabel(event.Command.Message["TXN"], knownTXNs), metrics.OutcomeRejected, "malformed")
+
+	fM.writeError(event, GameSpy.ErrorCodeInvalid, err.Error())
+}
+
 // LogCommand - logs detailed FESL command data to a file for further analysis
 func (fM *FeslManager) LogCommand(event GameSpy.EventClientTLSCommand) {
 	b, err := json.MarshalIndent(event.Command.Message, "", "	")
@@ -402,15 +594,18 @@ func (fM *FeslManager) newClient(event GameSpy.EventNewClientTLS) {
 	event.Client.WriteFESL("fsys", memCheck, 0xC0000000)
 	fM.logAnswer("fsys", memCheck, 0xC0000000)
 
-	// Start Heartbeat
-	event.Client.State.HeartTicker = time.NewTicker(time.Second * 10)
+	// Start Heartbeat, runs until the client closes or errors
+	ticker := time.NewTicker(time.Second * 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	event.Client.State.HeartTicker = ticker
+	event.Client.State.HeartCtx = ctx
+	event.Client.State.HeartCancel = cancel
 	go func() {
 		for {
-			if !event.Client.IsActive {
-				return
-			}
 			select {
-			case <-event.Client.State.HeartTicker.C:
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
 				if !event.Client.IsActive {
 					return
 				}
@@ -428,9 +623,21 @@ func (fM *FeslManager) newClient(event GameSpy.EventNewClientTLS) {
 
 }
 
+// stopHeartbeat ends the heartbeat of a client right away
+func stopHeartbeat(client *GameSpy.ClientTLS) {
+	if client.State.HeartCancel != nil {
+		client.State.HeartCancel()
+	}
+	if client.State.HeartTicker != nil {
+		client.State.HeartTicker.Stop()
+	}
+}
+
 func (fM *FeslManager) close(event GameSpy.EventClientTLSClose) {
 	log.Noteln("Client closed.")
 
+	stopHeartbeat(event.Client)
+
 	if event.Client.RedisState != nil {
 		if event.Client.RedisState.Get("lkeys") != "" {
 			lkeys := strings.Split(event.Client.RedisState.Get("lkeys"), ";")
@@ -452,4 +659,5 @@ func (fM *FeslManager) close(event GameSpy.EventClientTLSClose) {
 
 func (fM *FeslManager) error(event GameSpy.EventClientTLSError) {
 	log.Noteln("Client threw an error: ", event.Error)
+	stopHeartbeat(event.Client)
 }
@@ -2,9 +2,11 @@ package fesl
 
 import (
 	"strconv"
+	"time"
 
 	"github.com/HeroesAwaken/GoFesl/GameSpy"
 	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/HeroesAwaken/GoFesl/metrics"
 )
 
 // GetStats - Get basic stats about a soldier/owner (account holder)
@@ -14,7 +16,24 @@ func (fM *FeslManager) GetStats(event GameSpy.EventClientTLSCommand) {
 		return
 	}
 
+	metrics.GetStatsCalls.Inc()
+
 	owner := event.Command.Message["owner"]
+	if !fM.config.OwnerPattern.MatchString(owner) {
+		log.Noteln("Invalid owner " + owner + " in GetStats")
+		fM.writeError(event, GameSpy.ErrorCodeInvalid, "invalid owner")
+		metrics.CommandOutcome(fM.name, "GetStats", metrics.OutcomeError, "invalid_owner")
+		return
+	}
+
+	keys, err := parseStatsKeys(event.Command.Message, "keys", "")
+	if err != nil {
+		log.Noteln("Invalid keys in GetStats for "+owner, err.Error())
+		fM.writeError(event, GameSpy.ErrorCodeInvalid, err.Error())
+		metrics.CommandOutcome(fM.name, "GetStats", metrics.OutcomeError, "invalid_keys")
+		return
+	}
+
 	userId := event.Client.RedisState.Get("uID")
 
 	if event.Client.RedisState.Get("clientType") == "server" {
@@ -23,16 +42,17 @@ func (fM *FeslManager) GetStats(event GameSpy.EventClientTLSCommand) {
 		err := fM.stmtGetHeroeByID.QueryRow(owner).Scan(&id, &userID, &heroName, &online)
 		if err != nil {
 			log.Noteln("Persona not worthy!")
+			fM.writeError(event, GameSpy.ErrorCodeNotFound, "The persona doesn't exist.")
 			return
 		}
 
 		userId = userID
-		log.Noteln("Server requesting stats")
+		log.Debugln("Server requesting stats")
 	}
 
-	log.Noteln("GetStats", owner, userId)
+	log.Debugln("GetStats", owner, userId)
 
-	log.Noteln(event.Command.Message["owner"])
+	log.Debugln(event.Command.Message["owner"])
 
 	loginPacket := make(map[string]string)
 	loginPacket["TXN"] = "GetStats"
@@ -44,15 +64,19 @@ func (fM *FeslManager) GetStats(event GameSpy.EventClientTLSCommand) {
 	statsKeys := make(map[string]string)
 	args = append(args, owner)
 	args = append(args, userId)
-	keys, _ := strconv.Atoi(event.Command.Message["keys.[]"])
-	for i := 0; i < keys; i++ {
-		args = append(args, event.Command.Message["keys."+strconv.Itoa(i)+""])
-		statsKeys[event.Command.Message["keys."+strconv.Itoa(i)+""]] = strconv.Itoa(i)
+	for i, key := range keys {
+		args = append(args, key)
+		statsKeys[key] = strconv.Itoa(i)
 	}
 
-	rows, err := fM.getStatsStatement(keys).Query(args...)
+	start := time.Now()
+	rows, err := fM.getStatsStatement(statsTable(event.Client), len(keys)).Query(args...)
+	metrics.ObserveQuery("getStats", start)
 	if err != nil {
 		log.Errorln("Failed gettings stats for hero "+owner, err.Error())
+		fM.writeError(event, GameSpy.ErrorCodeInternal, "The stats couldn't be loaded.")
+		metrics.CommandOutcome(fM.name, "GetStats", metrics.OutcomeError, "db_error")
+		return
 	}
 
 	count := 0
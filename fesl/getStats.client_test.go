@@ -0,0 +1,63 @@
+package fesl
+
+import (
+	"testing"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+)
+
+func TestGetStatsRejectsMalformedOwner(t *testing.T) {
+	tables := []struct {
+		owner string
+	}{
+		{"abc"},
+		{""},
+		{"12 OR 1=1"},
+		{"-5"},
+		{"123456789012345678901"},
+	}
+
+	for _, table := range tables {
+		fM := new(FeslManager)
+		fM.config = DefaultConfig()
+
+		recorder := new(GameSpy.Recorder)
+		client := new(GameSpy.ClientTLS)
+		client.NewWithWriter("test", recorder)
+
+		fM.GetStats(GameSpy.EventClientTLSCommand{
+			Client: client,
+			Command: &GameSpy.CommandFESL{
+				Query:   "rank",
+				Message: map[string]string{"TXN": "GetStats", "owner": table.owner, "keys.[]": "1", "keys.0": "level"},
+			},
+		})
+
+		packets := recorder.Packets()
+		if len(packets) != 1 {
+			t.Fatalf("GetStats packets for %q were incorrect, got: %v, want: one error.", table.owner, packets)
+		}
+		if packets[0].Message["errorCode"] != "99" {
+			t.Errorf("GetStats for %q was incorrect, got errorCode: %s, want: %s.", table.owner, packets[0].Message["errorCode"], "99")
+		}
+	}
+}
+
+func TestOwnerPattern(t *testing.T) {
+	tables := []struct {
+		owner string
+		valid bool
+	}{
+		{"1", true},
+		{"2147483647", true},
+		{"abc", false},
+		{"1a", false},
+		{"", false},
+	}
+
+	for _, table := range tables {
+		if valid := DefaultConfig().OwnerPattern.MatchString(table.owner); valid != table.valid {
+			t.Errorf("OwnerPattern for %q was incorrect, got: %t, want: %t.", table.owner, valid, table.valid)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/HeroesAwaken/GoFesl/GameSpy"
 	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/HeroesAwaken/GoFesl/metrics"
 )
 
 // GetStatsForOwners - Gives a bunch of info for the Hero selection screen?
@@ -14,6 +15,14 @@ func (fM *FeslManager) GetStatsForOwners(event GameSpy.EventClientTLSCommand) {
 		return
 	}
 
+	keys, err := parseStatsKeys(event.Command.Message, "keys", "")
+	if err != nil {
+		log.Noteln("Invalid keys in GetStatsForOwners", err.Error())
+		fM.writeError(event, GameSpy.ErrorCodeInvalid, err.Error())
+		metrics.CommandOutcome(fM.name, "GetStatsForOwners", metrics.OutcomeError, "invalid_keys")
+		return
+	}
+
 	loginPacket := make(map[string]string)
 	loginPacket["TXN"] = "GetStats"
 
@@ -22,6 +31,7 @@ func (fM *FeslManager) GetStatsForOwners(event GameSpy.EventClientTLSCommand) {
 	userID := event.Client.RedisState.Get("uID")
 	numOfHeroesInt, err := strconv.Atoi(numOfHeroes)
 	if err != nil {
+		fM.writeError(event, GameSpy.ErrorCodeInvalid, "No heroes to get stats for.")
 		return
 	}
 
@@ -34,11 +44,12 @@ func (fM *FeslManager) GetStatsForOwners(event GameSpy.EventClientTLSCommand) {
 			err := fM.stmtGetHeroeByID.QueryRow(ownerID).Scan(&id, &userIDhero, &heroName, &online)
 			if err != nil {
 				log.Noteln("Persona not worthy!")
+				fM.writeError(event, GameSpy.ErrorCodeNotFound, "The persona doesn't exist.")
 				return
 			}
 
 			userID = userIDhero
-			log.Noteln("Server requesting stats")
+			log.Debugln("Server requesting stats")
 		}
 
 		loginPacket["stats."+strconv.Itoa(i-1)+".ownerId"] = ownerID
@@ -49,15 +60,16 @@ func (fM *FeslManager) GetStatsForOwners(event GameSpy.EventClientTLSCommand) {
 		statsKeys := make(map[string]string)
 		args = append(args, ownerID)
 		args = append(args, userID)
-		keys, _ := strconv.Atoi(event.Command.Message["keys.[]"])
-		for i := 0; i < keys; i++ {
-			args = append(args, event.Command.Message["keys."+strconv.Itoa(i)+""])
-			statsKeys[event.Command.Message["keys."+strconv.Itoa(i)+""]] = strconv.Itoa(i)
+		for i, key := range keys {
+			args = append(args, key)
+			statsKeys[key] = strconv.Itoa(i)
 		}
 
-		rows, err := fM.getStatsStatement(keys).Query(args...)
+		rows, err := fM.getStatsStatement(statsTable(event.Client), len(keys)).Query(args...)
 		if err != nil {
 			log.Errorln("Failed gettings stats for hero "+ownerID, err.Error())
+			fM.writeError(event, GameSpy.ErrorCodeInternal, "The stats couldn't be loaded.")
+			return
 		}
 
 		count := 0
@@ -0,0 +1,122 @@
+package fesl
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/HeroesAwaken/GoFesl/metrics"
+)
+
+const (
+	// leaderboardDefaultCount is used when the client doesn't ask for a count
+	leaderboardDefaultCount = 50
+	// leaderboardMaxCount is the most entries we send in one packet
+	leaderboardMaxCount = 100
+)
+
+// leaderboardKeys are the stats a leaderboard can be sorted by
+var leaderboardKeys = map[string]bool{
+	"elo":           true,
+	"level":         true,
+	"c_wallet_hero": true,
+}
+
+// leaderboardRange parses count and offset of a leaderboard request
+func leaderboardRange(countParam string, offsetParam string) (int, int, error) {
+	count := leaderboardDefaultCount
+	offset := 0
+
+	if countParam != "" {
+		var err error
+		count, err = strconv.Atoi(countParam)
+		if err != nil || count <= 0 {
+			return 0, 0, errors.New("invalid count")
+		}
+		if count > leaderboardMaxCount {
+			count = leaderboardMaxCount
+		}
+	}
+
+	if offsetParam != "" {
+		var err error
+		offset, err = strconv.Atoi(offsetParam)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("invalid offset")
+		}
+	}
+
+	return count, offset, nil
+}
+
+// GetTopN - Get the top heroes ordered by a stat, starting at offset
+func (fM *FeslManager) GetTopN(event GameSpy.EventClientTLSCommand) {
+	if !event.Client.IsActive {
+		log.Noteln("Client left")
+		return
+	}
+
+	key := event.Command.Message["key"]
+	count, offset, err := leaderboardRange(event.Command.Message["count"], event.Command.Message["offset"])
+	if err == nil && !leaderboardKeys[key] {
+		err = errors.New("invalid key")
+	}
+	if err != nil {
+		log.Noteln("Invalid leaderboard request", key, err)
+		fM.writeError(event, GameSpy.ErrorCodeInvalid, err.Error())
+		metrics.CommandOutcome(fM.name, "GetTopN", metrics.OutcomeError, "invalid_request")
+		return
+	}
+
+	statement, err := fM.topNStatement(statsTable(event.Client))
+	if err != nil {
+		log.Errorln("Failed preparing leaderboard for "+key, err.Error())
+		fM.writeError(event, GameSpy.ErrorCodeInternal, "The leaderboard couldn't be loaded.")
+		metrics.CommandOutcome(fM.name, "GetTopN", metrics.OutcomeError, "db_error")
+		return
+	}
+
+	rows, err := statement.Query(key, count, offset)
+	if err != nil {
+		log.Errorln("Failed getting leaderboard for "+key, err.Error())
+		fM.writeError(event, GameSpy.ErrorCodeInternal, "The leaderboard couldn't be loaded.")
+		metrics.CommandOutcome(fM.name, "GetTopN", metrics.OutcomeError, "db_error")
+		return
+	}
+	defer rows.Close()
+
+	answer := make(map[string]string)
+	answer["TXN"] = "GetTopN"
+	answer["key"] = key
+
+	i := 0
+	for rows.Next() {
+		var heroID, heroName, statsValue string
+		err := rows.Scan(&heroID, &heroName, &statsValue)
+		if err != nil {
+			log.Errorln("Failed reading leaderboard for "+key, err.Error())
+			fM.writeError(event, GameSpy.ErrorCodeInternal, "The leaderboard couldn't be loaded.")
+			metrics.CommandOutcome(fM.name, "GetTopN", metrics.OutcomeError, "db_error")
+			return
+		}
+
+		answer["stats."+strconv.Itoa(i)+".rank"] = strconv.Itoa(offset + i + 1)
+		answer["stats."+strconv.Itoa(i)+".ownerId"] = heroID
+		answer["stats."+strconv.Itoa(i)+".ownerName"] = heroName
+		answer["stats."+strconv.Itoa(i)+".key"] = key
+		answer["stats."+strconv.Itoa(i)+".value"] = statsValue
+		answer["stats."+strconv.Itoa(i)+".text"] = statsValue
+		i++
+	}
+	if err := rows.Err(); err != nil {
+		log.Errorln("Failed reading leaderboard for "+key, err.Error())
+		fM.writeError(event, GameSpy.ErrorCodeInternal, "The leaderboard couldn't be loaded.")
+		metrics.CommandOutcome(fM.name, "GetTopN", metrics.OutcomeError, "db_error")
+		return
+	}
+	answer["stats.[]"] = strconv.Itoa(i)
+
+	event.Client.WriteFESL(event.Command.Query, answer, event.Command.PayloadID)
+	fM.logAnswer(event.Command.Query, answer, event.Command.PayloadID)
+}
@@ -0,0 +1,126 @@
+package fesl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+)
+
+func TestLeaderboardRange(t *testing.T) {
+	tables := []struct {
+		count       string
+		offset      string
+		wantCount   int
+		wantOffset  int
+		shouldError bool
+	}{
+		{"", "", leaderboardDefaultCount, 0, false},
+		{"10", "20", 10, 20, false},
+		{"1000", "0", leaderboardMaxCount, 0, false},
+		{"0", "", 0, 0, true},
+		{"-5", "", 0, 0, true},
+		{"10", "-1", 0, 0, true},
+		{"ten", "", 0, 0, true},
+	}
+
+	for _, table := range tables {
+		count, offset, err := leaderboardRange(table.count, table.offset)
+		if (err != nil) != table.shouldError {
+			t.Errorf("leaderboardRange(%s, %s) was incorrect, got error: %v.", table.count, table.offset, err)
+			continue
+		}
+		if count != table.wantCount || offset != table.wantOffset {
+			t.Errorf("leaderboardRange(%s, %s) was incorrect, got: %d, %d, want: %d, %d.", table.count, table.offset, count, offset, table.wantCount, table.wantOffset)
+		}
+	}
+}
+
+func TestGetTopN(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Creating sqlmock failed: %s", err)
+	}
+	defer db.Close()
+
+	StatsTables = map[string]string{"game-a": "game_a_stats"}
+	defer func() { StatsTables = nil }()
+
+	fM := new(FeslManager)
+	fM.prepareStatsStatements(db)
+
+	mock.ExpectPrepare("FROM game_a_stats AS stats\\s+INNER JOIN game_heroes")
+
+	rows := sqlmock.NewRows([]string{"heroID", "heroName", "statsValue"}).
+		AddRow("7", "First", "1500").
+		AddRow("9", "Second", "1400")
+	mock.ExpectQuery("SELECT stats.heroID").WithArgs("elo", 2, 10).WillReturnRows(rows)
+
+	failing := sqlmock.NewRows([]string{"heroID", "heroName", "statsValue"}).
+		AddRow("7", "First", "1500").
+		AddRow("9", "Second", "1400").
+		RowError(1, errors.New("connection lost"))
+	mock.ExpectQuery("SELECT stats.heroID").WithArgs("elo", 2, 0).WillReturnRows(failing)
+
+	unreadable := sqlmock.NewRows([]string{"heroID", "heroName", "statsValue"}).
+		AddRow("7", "First", "1500").
+		AddRow("9", nil, "1400")
+	mock.ExpectQuery("SELECT stats.heroID").WithArgs("elo", 2, 0).WillReturnRows(unreadable)
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Starting miniredis failed: %s", err)
+	}
+	defer mr.Close()
+
+	recorder := new(GameSpy.Recorder)
+	client := new(GameSpy.ClientTLS)
+	client.NewWithWriter("test", recorder)
+	client.RedisState = new(core.RedisState)
+	client.RedisState.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "client")
+	client.RedisState.Set("clientString", "game-a")
+
+	fM.GetTopN(GameSpy.EventClientTLSCommand{
+		Client:  client,
+		Command: &GameSpy.CommandFESL{Query: "rank", Message: map[string]string{"TXN": "GetTopN", "key": "elo", "count": "2", "offset": "10"}},
+	})
+
+	packets := recorder.Packets()
+	if len(packets) != 1 {
+		t.Fatalf("GetTopN packets were incorrect, got: %v, want: one answer.", packets)
+	}
+	want := map[string]string{
+		"stats.[]": "2", "stats.0.rank": "11", "stats.0.ownerId": "7", "stats.0.ownerName": "First", "stats.0.value": "1500",
+		"stats.1.rank": "12", "stats.1.ownerId": "9", "stats.1.ownerName": "Second", "stats.1.value": "1400",
+	}
+	for key, value := range want {
+		if packets[0].Message[key] != value {
+			t.Errorf("GetTopN %s was incorrect, got: %s, want: %s.", key, packets[0].Message[key], value)
+		}
+	}
+
+	// A leaderboard cut short by an error isn't sent
+	fM.GetTopN(GameSpy.EventClientTLSCommand{
+		Client:  client,
+		Command: &GameSpy.CommandFESL{Query: "rank", Message: map[string]string{"TXN": "GetTopN", "key": "elo", "count": "2"}},
+	})
+
+	// ... and neither is one missing a row which couldn't be read
+	fM.GetTopN(GameSpy.EventClientTLSCommand{
+		Client:  client,
+		Command: &GameSpy.CommandFESL{Query: "rank", Message: map[string]string{"TXN": "GetTopN", "key": "elo", "count": "2"}},
+	})
+
+	packets = recorder.Packets()
+	if len(packets) != 3 || packets[1].Message["errorCode"] != "112" || packets[2].Message["errorCode"] != "112" {
+		t.Errorf("GetTopN was incorrect, got: %v, want two errorCodes: %s.", packets[1:], "112")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("GetTopN database calls were incorrect: %s", err)
+	}
+}
@@ -0,0 +1,19 @@
+package fesl
+
+import (
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/log"
+)
+
+// Goodbye - SHARED sent by clients logging out, we close the connection right
+// away instead of waiting for it to drop. Its close event cleans up.
+func (fM *FeslManager) Goodbye(event GameSpy.EventClientTLSCommand) {
+	if !event.Client.IsActive {
+		log.Noteln("Client left")
+		return
+	}
+
+	log.Noteln("Client said goodbye:", event.Command.Message["reason"], event.Command.Message["message"])
+
+	event.Client.Close()
+}
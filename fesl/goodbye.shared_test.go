@@ -0,0 +1,75 @@
+package fesl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+)
+
+func TestGoodbyeCleansUpImmediately(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Starting miniredis failed: %s", err)
+	}
+	defer mr.Close()
+
+	fM := new(FeslManager)
+	fM.redis = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	client := new(GameSpy.ClientTLS)
+	events := client.NewWithWriter("test", new(GameSpy.Recorder))
+
+	client.RedisState = new(core.RedisState)
+	client.RedisState.New(fM.redis, "client-test")
+	client.RedisState.Set("lkeys", ";lkey1")
+	fM.redis.HSet("lkeys:lkey1", "id", "5")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client.State.HeartTicker = time.NewTicker(time.Hour)
+	client.State.HeartCtx = ctx
+	client.State.HeartCancel = cancel
+
+	fM.Goodbye(GameSpy.EventClientTLSCommand{
+		Client: client,
+		Command: &GameSpy.CommandFESL{
+			Query:   "fsys",
+			Message: map[string]string{"TXN": "Goodbye", "reason": "GOODBYE_CLIENT_NORMAL"},
+		},
+	})
+
+	if client.IsActive {
+		t.Errorf("Goodbye was incorrect, client is still active")
+	}
+
+	// The connection closes once, its close event does the cleanup
+	select {
+	case event := <-events:
+		if event.Name != "close" {
+			t.Fatalf("Goodbye was incorrect, got event: %s, want: %s.", event.Name, "close")
+		}
+	default:
+		t.Fatalf("Goodbye was incorrect, connection wasn't closed")
+	}
+	select {
+	case event := <-events:
+		t.Errorf("Goodbye was incorrect, got another event: %s.", event.Name)
+	default:
+	}
+
+	fM.close(GameSpy.EventClientTLSClose{Client: client})
+
+	if mr.Exists("lkeys:lkey1") {
+		t.Errorf("Goodbye was incorrect, lkey wasn't deleted")
+	}
+	if client.RedisState.Get("lkeys") != "" {
+		t.Errorf("Goodbye was incorrect, client state wasn't deleted")
+	}
+	if ctx.Err() == nil {
+		t.Errorf("Goodbye was incorrect, heartbeat wasn't stopped")
+	}
+}
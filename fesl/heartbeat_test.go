@@ -0,0 +1,40 @@
+package fesl
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+)
+
+func TestHeartbeatStopsOnCloseAndError(t *testing.T) {
+	fM := new(FeslManager)
+
+	baseline := runtime.NumGoroutine()
+
+	for i := 0; i < 100; i++ {
+		client := new(GameSpy.ClientTLS)
+		client.NewWithWriter("test", new(GameSpy.Recorder))
+		fM.newClient(GameSpy.EventNewClientTLS{Client: client})
+		if client.State.HeartCancel == nil {
+			t.Fatalf("newClient was incorrect, no heartbeat was started.")
+		}
+
+		if i%2 == 0 {
+			fM.close(GameSpy.EventClientTLSClose{Client: client})
+		} else {
+			fM.error(GameSpy.EventClientTLSError{Client: client, Error: errors.New("connection reset")})
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if runtime.NumGoroutine() > baseline {
+		t.Errorf("Heartbeat was incorrect, got goroutines: %d, want: %d.", runtime.NumGoroutine(), baseline)
+	}
+}
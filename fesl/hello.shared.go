@@ -1,12 +1,19 @@
 package fesl
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/HeroesAwaken/GoFesl/GameSpy"
 	"github.com/HeroesAwaken/GoFesl/log"
 
 	"github.com/HeroesAwaken/GoAwaken/core"
 )
 
+// helloTimeLayout is how curTime looks in the Hello, e.g.
+// Jun-15-2017 07:26:12 UTC
+const helloTimeLayout = "Jan-02-2006 15:04:05 UTC"
+
 func (fM *FeslManager) hello(event GameSpy.EventClientTLSCommand) {
 	if !event.Client.IsActive {
 		log.Noteln("Client left")
@@ -42,19 +49,18 @@ func (fM *FeslManager) hello(event GameSpy.EventClientTLSCommand) {
 	} else {
 		helloPacket["domainPartition.subDomain"] = "bfwest-dedicated"
 	}
-	helloPacket["curTime"] = "Jun-15-2017 07:26:12 UTC"
-	helloPacket["activityTimeoutSecs"] = "3600"
-	helloPacket["messengerIp"] = "messaging.ea.com"
-	helloPacket["messengerPort"] = "13505"
-	helloPacket["theaterIp"] = "theater.heroesawaken.com"
+	helloPacket["curTime"] = fM.config.HelloTime
+	if helloPacket["curTime"] == "" {
+		helloPacket["curTime"] = time.Now().UTC().Format(helloTimeLayout)
+	}
+	helloPacket["activityTimeoutSecs"] = strconv.Itoa(int(fM.config.ActivityTimeout.Seconds()))
+	helloPacket["messengerIp"] = fM.config.MessengerHost
+	helloPacket["messengerPort"] = fM.config.MessengerPort
+	helloPacket["theaterIp"] = fM.config.TheaterHost
 	if fM.localMode {
 		helloPacket["theaterIp"] = "localhost"
 	}
-	if fM.server {
-		helloPacket["theaterPort"] = "18056"
-	} else {
-		helloPacket["theaterPort"] = "18275"
-	}
+	helloPacket["theaterPort"] = fM.config.TheaterPort
 	event.Client.WriteFESL("fsys", helloPacket, 0xC0000001)
 	fM.logAnswer("fsys", helloPacket, 0xC0000001)
 
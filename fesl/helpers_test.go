@@ -0,0 +1,22 @@
+package fesl
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TestMain runs the tests in a temporary directory, which is where answers
+// logged by the handlers end up
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "fesl")
+	if err != nil {
+		panic(err)
+	}
+	os.Chdir(dir)
+
+	code := m.Run()
+
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
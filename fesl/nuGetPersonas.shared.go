@@ -21,6 +21,8 @@ func (fM *FeslManager) NuGetPersonas(event GameSpy.EventClientTLSCommand) {
 
 	rows, err := fM.stmtGetHeroesByUserID.Query(event.Client.RedisState.Get("uID"))
 	if err != nil {
+		log.Errorln("Failed getting personas of "+event.Client.RedisState.Get("uID"), err.Error())
+		fM.writeError(event, GameSpy.ErrorCodeInternal, "The personas couldn't be loaded.")
 		return
 	}
 
@@ -33,6 +35,7 @@ func (fM *FeslManager) NuGetPersonas(event GameSpy.EventClientTLSCommand) {
 		err := rows.Scan(&id, &userID, &heroName, &online)
 		if err != nil {
 			log.Errorln(err)
+			fM.writeError(event, GameSpy.ErrorCodeInternal, "The personas couldn't be loaded.")
 			return
 		}
 		personaPacket["personas."+strconv.Itoa(i)] = heroName
@@ -50,11 +53,13 @@ func (fM *FeslManager) NuGetPersonas(event GameSpy.EventClientTLSCommand) {
 
 // NuGetPersonasServer - Soldier data lookup call for servers
 func (fM *FeslManager) NuGetPersonasServer(event GameSpy.EventClientTLSCommand) {
-	log.Noteln("We are a server NuGetPersonas")
+	log.Debugln("We are a server NuGetPersonas")
 
 	// Server login
 	rows, err := fM.stmtGetServerByID.Query(event.Client.RedisState.Get("uID"))
 	if err != nil {
+		log.Errorln("Failed getting personas of "+event.Client.RedisState.Get("uID"), err.Error())
+		fM.writeError(event, GameSpy.ErrorCodeInternal, "The personas couldn't be loaded.")
 		return
 	}
 
@@ -67,6 +72,7 @@ func (fM *FeslManager) NuGetPersonasServer(event GameSpy.EventClientTLSCommand)
 		err := rows.Scan(&id, &userID, &servername, &secretKey, &username)
 		if err != nil {
 			log.Errorln(err)
+			fM.writeError(event, GameSpy.ErrorCodeInternal, "The personas couldn't be loaded.")
 			return
 		}
 		personaPacket["personas."+strconv.Itoa(i)] = servername
@@ -78,5 +84,5 @@ func (fM *FeslManager) NuGetPersonasServer(event GameSpy.EventClientTLSCommand)
 
 	event.Client.WriteFESL(event.Command.Query, personaPacket, event.Command.PayloadID)
 	fM.logAnswer(event.Command.Query, personaPacket, event.Command.PayloadID)
-	log.Noteln(event.Command.Query, personaPacket, event.Command.PayloadID)
+	log.Debugln(event.Command.Query, personaPacket, event.Command.PayloadID)
 }
@@ -0,0 +1,87 @@
+package fesl
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/HeroesAwaken/GoFesl/metrics"
+)
+
+// NuGrantEntitlement - ADMIN grants an entitlement (beta access, DLC, ...)
+// to an account. Granting one the account already has is a no-op.
+func (fM *FeslManager) NuGrantEntitlement(event GameSpy.EventClientTLSCommand) {
+	if !event.Client.IsActive {
+		log.Noteln("Client left")
+		return
+	}
+
+	if !fM.userHasPermission(event.Client.RedisState.Get("uID"), "admin.entitlements") {
+		log.Noteln("User not worthy: " + event.Client.RedisState.Get("username"))
+		fM.writeError(event, GameSpy.ErrorCodeNotEntitled, "You are not allowed to grant entitlements.")
+		metrics.CommandOutcome(fM.name, "NuGrantEntitlement", metrics.OutcomeError, "no_permission")
+		return
+	}
+
+	userID := event.Command.Message["userId"]
+	groupName := event.Command.Message["groupName"]
+	entitlementTag := event.Command.Message["entitlementTag"]
+
+	if err := validateEntitlement(userID, groupName, entitlementTag); err != nil {
+		log.Noteln("Invalid entitlement grant", userID, groupName, entitlementTag, err)
+		fM.writeError(event, GameSpy.ErrorCodeInvalid, err.Error())
+		metrics.CommandOutcome(fM.name, "NuGrantEntitlement", metrics.OutcomeError, "invalid_request")
+		return
+	}
+
+	granted, err := fM.grantEntitlement(userID, groupName, entitlementTag)
+	if err != nil {
+		log.Errorln("Failed granting "+entitlementTag+" to "+userID, err.Error())
+		fM.writeError(event, GameSpy.ErrorCodeInternal, "The entitlement could not be granted.")
+		metrics.CommandOutcome(fM.name, "NuGrantEntitlement", metrics.OutcomeError, "grant_failed")
+		return
+	}
+
+	if granted {
+		log.Noteln("Granted " + groupName + "/" + entitlementTag + " to " + userID + " by " + event.Client.RedisState.Get("username"))
+	}
+
+	answer := make(map[string]string)
+	answer["TXN"] = "NuGrantEntitlement"
+	answer["userId"] = userID
+	answer["groupName"] = groupName
+	answer["entitlementTag"] = entitlementTag
+	event.Client.WriteFESL(event.Command.Query, answer, event.Command.PayloadID)
+	fM.logAnswer(event.Command.Query, answer, event.Command.PayloadID)
+	metrics.CommandOutcome(fM.name, "NuGrantEntitlement", metrics.OutcomeSuccess, "")
+}
+
+// validateEntitlement checks that a grant names an account by its numeric id,
+// a group and a tag
+func validateEntitlement(userID string, groupName string, entitlementTag string) error {
+	if _, err := strconv.ParseUint(userID, 10, 64); err != nil {
+		return errors.New("The userId is invalid.")
+	}
+	if groupName == "" || entitlementTag == "" {
+		return errors.New("The groupName and entitlementTag are required.")
+	}
+	return nil
+}
+
+// grantEntitlement adds an entitlement to an account unless it already has
+// it. Returns whether a row was inserted. Concurrent grants of the same
+// entitlement are serialized by the unique key of entitlements.
+func (fM *FeslManager) grantEntitlement(userID string, groupName string, entitlementTag string) (bool, error) {
+	result, err := fM.stmtAddEntitlement.Exec(userID, groupName, entitlementTag)
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return inserted > 0, nil
+}
@@ -0,0 +1,115 @@
+package fesl
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+)
+
+func TestGrantEntitlementTwice(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Creating sqlmock failed: %s", err)
+	}
+	defer db.Close()
+
+	insertQuery := regexp.QuoteMeta("INSERT INTO entitlements") + ".*" + regexp.QuoteMeta("ON DUPLICATE KEY UPDATE")
+
+	insert := mock.ExpectPrepare(insertQuery)
+
+	fM := new(FeslManager)
+	fM.db = db
+	fM.prepareEntitlementStatements()
+
+	// First grant inserts the row
+	insert.ExpectExec().WithArgs("7", "HeroesBeta", "BETA").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// Second grant hits the unique key and doesn't change anything
+	insert.ExpectExec().WithArgs("7", "HeroesBeta", "BETA").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	granted, err := fM.grantEntitlement("7", "HeroesBeta", "BETA")
+	if err != nil || !granted {
+		t.Errorf("grantEntitlement was incorrect, got: %t, %v, want: %t.", granted, err, true)
+	}
+
+	granted, err = fM.grantEntitlement("7", "HeroesBeta", "BETA")
+	if err != nil || granted {
+		t.Errorf("grantEntitlement was incorrect, got: %t, %v, want: %t.", granted, err, false)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("grantEntitlement was incorrect: %s", err)
+	}
+}
+
+func TestNuGrantEntitlementRejectsInvalidGrants(t *testing.T) {
+	tables := []struct {
+		userID         string
+		groupName      string
+		entitlementTag string
+	}{
+		{"", "HeroesBeta", "BETA"},
+		{"seven", "HeroesBeta", "BETA"},
+		{"-7", "HeroesBeta", "BETA"},
+		{"7", "", "BETA"},
+		{"7", "HeroesBeta", ""},
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Creating sqlmock failed: %s", err)
+	}
+	defer db.Close()
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Starting miniredis failed: %s", err)
+	}
+	defer mr.Close()
+
+	permission := mock.ExpectPrepare("SELECT count")
+	mock.ExpectPrepare("INSERT INTO entitlements")
+
+	fM := new(FeslManager)
+	fM.db = db
+	fM.stmtGetCountOfPermissionByIDAndSlug, _ = db.Prepare("SELECT count(id) FROM permissions")
+	fM.prepareEntitlementStatements()
+
+	recorder := new(GameSpy.Recorder)
+	client := new(GameSpy.ClientTLS)
+	client.NewWithWriter("test", recorder)
+	client.RedisState = new(core.RedisState)
+	client.RedisState.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "client")
+	client.RedisState.Set("uID", "1")
+
+	for _, table := range tables {
+		permission.ExpectQuery().WithArgs("1", "admin.entitlements").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+		fM.NuGrantEntitlement(GameSpy.EventClientTLSCommand{
+			Client: client,
+			Command: &GameSpy.CommandFESL{Query: "acct", Message: map[string]string{
+				"TXN": "NuGrantEntitlement", "userId": table.userID, "groupName": table.groupName, "entitlementTag": table.entitlementTag,
+			}},
+		})
+	}
+
+	packets := recorder.Packets()
+	if len(packets) != len(tables) {
+		t.Fatalf("NuGrantEntitlement packets were incorrect, got: %v, want: %d errors.", packets, len(tables))
+	}
+	for i, table := range tables {
+		if packets[i].Message["errorCode"] != "99" {
+			t.Errorf("NuGrantEntitlement for %v was incorrect, got errorCode: %s, want: %s.", table, packets[i].Message["errorCode"], "99")
+		}
+	}
+
+	// Nothing may have been inserted
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("NuGrantEntitlement was incorrect: %s", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/HeroesAwaken/GoFesl/GameSpy"
 	"github.com/HeroesAwaken/GoFesl/lib"
 	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/HeroesAwaken/GoFesl/metrics"
 )
 
 // NuLogin - master login command
@@ -24,24 +25,30 @@ func (fM *FeslManager) NuLogin(event GameSpy.EventClientTLSCommand) {
 	err := fM.stmtGetUserByGameToken.QueryRow(event.Command.Message["encryptedInfo"]).Scan(&id, &username, &email, &birthday, &language, &country, &gameToken)
 	if err != nil {
 		log.Noteln("User not worthy!", err)
-		loginPacket := make(map[string]string)
-		loginPacket["TXN"] = "NuLogin"
-		loginPacket["localizedMessage"] = "\"The user is not entitled to access this game\""
-		loginPacket["errorContainer.[]"] = "0"
-		loginPacket["errorCode"] = "120"
-		event.Client.WriteFESL(event.Command.Query, loginPacket, event.Command.PayloadID)
+		fM.writeError(event, GameSpy.ErrorCodeNotEntitled, "The user is not entitled to access this game")
+		metrics.CommandOutcome(fM.name, "NuLogin", metrics.OutcomeError, "invalid_token")
 		return
 	}
 
 	// Check if user is allowed to login
 	if !fM.userHasPermission(id, "game.login") {
 		log.Noteln("User not worthy: " + username)
-		loginPacket := make(map[string]string)
-		loginPacket["TXN"] = "NuLogin"
-		loginPacket["localizedMessage"] = "\"Your user is currently not allowed to login.\""
-		loginPacket["errorContainer.[]"] = "0"
-		loginPacket["errorCode"] = "120"
-		event.Client.WriteFESL(event.Command.Query, loginPacket, event.Command.PayloadID)
+		fM.writeError(event, GameSpy.ErrorCodeNotEntitled, "Your user is currently not allowed to login.")
+		metrics.CommandOutcome(fM.name, "NuLogin", metrics.OutcomeError, "no_permission")
+		return
+	}
+
+	banned, err := fM.bans.IsBanned(id)
+	if err != nil {
+		log.Errorln("Failed checking bans for "+id, err.Error())
+		fM.writeError(event, GameSpy.ErrorCodeInternal, "Your account couldn't be checked.")
+		metrics.CommandOutcome(fM.name, "NuLogin", metrics.OutcomeError, "ban_check_failed")
+		return
+	}
+	if banned {
+		log.Noteln("User banned: " + username)
+		fM.writeError(event, GameSpy.ErrorCodeBanned, "Your account is banned.")
+		metrics.CommandOutcome(fM.name, "NuLogin", metrics.OutcomeError, "banned")
 		return
 	}
 
@@ -60,6 +67,7 @@ func (fM *FeslManager) NuLogin(event GameSpy.EventClientTLSCommand) {
 	lkeyRedis.Set("id", id)
 	lkeyRedis.Set("userID", id)
 	lkeyRedis.Set("name", username)
+	lkeyRedis.Set("clientString", event.Client.RedisState.Get("clientString"))
 
 	loginPacket := make(map[string]string)
 	loginPacket["TXN"] = "NuLogin"
@@ -70,6 +78,7 @@ func (fM *FeslManager) NuLogin(event GameSpy.EventClientTLSCommand) {
 	event.Client.RedisState.Set("lkeys", event.Client.RedisState.Get("lkeys")+";"+lkey)
 	event.Client.WriteFESL(event.Command.Query, loginPacket, event.Command.PayloadID)
 	fM.logAnswer(event.Command.Query, loginPacket, event.Command.PayloadID)
+	metrics.CommandOutcome(fM.name, "NuLogin", metrics.OutcomeSuccess, "")
 }
 
 // NuLoginServer - login command for servers
@@ -78,12 +87,8 @@ func (fM *FeslManager) NuLoginServer(event GameSpy.EventClientTLSCommand) {
 
 	err := fM.stmtGetServerBySecret.QueryRow(event.Command.Message["password"]).Scan(&id, &userID, &servername, &secretKey, &username)
 	if err != nil {
-		loginPacket := make(map[string]string)
-		loginPacket["TXN"] = "NuLogin"
-		loginPacket["localizedMessage"] = "\"The password the user specified is incorrect\""
-		loginPacket["errorContainer.[]"] = "0"
-		loginPacket["errorCode"] = "122"
-		event.Client.WriteFESL(event.Command.Query, loginPacket, event.Command.PayloadID)
+		fM.writeError(event, GameSpy.ErrorCodeWrongPassword, "The password the user specified is incorrect")
+		metrics.CommandOutcome(fM.name, "NuLoginServer", metrics.OutcomeError, "wrong_password")
 		return
 	}
 
@@ -102,6 +107,7 @@ func (fM *FeslManager) NuLoginServer(event GameSpy.EventClientTLSCommand) {
 	lkeyRedis.Set("id", id)
 	lkeyRedis.Set("userID", userID)
 	lkeyRedis.Set("name", username)
+	lkeyRedis.Set("clientString", event.Client.RedisState.Get("clientString"))
 
 	loginPacket := make(map[string]string)
 	loginPacket["TXN"] = "NuLogin"
@@ -113,4 +119,5 @@ func (fM *FeslManager) NuLoginServer(event GameSpy.EventClientTLSCommand) {
 	event.Client.RedisState.Set("lkeys", event.Client.RedisState.Get("lkeys")+";"+lkey)
 	event.Client.WriteFESL(event.Command.Query, loginPacket, event.Command.PayloadID)
 	fM.logAnswer(event.Command.Query, loginPacket, event.Command.PayloadID)
+	metrics.CommandOutcome(fM.name, "NuLoginServer", metrics.OutcomeSuccess, "")
 }
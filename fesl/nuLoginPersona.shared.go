@@ -23,6 +23,7 @@ func (fM *FeslManager) NuLoginPersona(event GameSpy.EventClientTLSCommand) {
 	err := fM.stmtGetHeroeByName.QueryRow(event.Command.Message["name"]).Scan(&id, &userID, &heroName, &online)
 	if err != nil {
 		log.Noteln("Persona not worthy!")
+		fM.writeError(event, GameSpy.ErrorCodeNotFound, "The persona doesn't exist.")
 		return
 	}
 
@@ -33,6 +34,7 @@ func (fM *FeslManager) NuLoginPersona(event GameSpy.EventClientTLSCommand) {
 	lkeyRedis.Set("id", id)
 	lkeyRedis.Set("userID", userID)
 	lkeyRedis.Set("name", heroName)
+	lkeyRedis.Set("clientString", event.Client.RedisState.Get("clientString"))
 
 	saveRedis := make(map[string]interface{})
 	saveRedis["heroID"] = id
@@ -54,6 +56,7 @@ func (fM *FeslManager) NuLoginPersonaServer(event GameSpy.EventClientTLSCommand)
 	err := fM.stmtGetServerByName.QueryRow(event.Command.Message["name"]).Scan(&id, &userID, &servername, &secretKey, &username)
 	if err != nil {
 		log.Noteln("Persona not worthy!")
+		fM.writeError(event, GameSpy.ErrorCodeNotFound, "The persona doesn't exist.")
 		return
 	}
 
@@ -64,6 +67,7 @@ func (fM *FeslManager) NuLoginPersonaServer(event GameSpy.EventClientTLSCommand)
 	lkeyRedis.Set("id", userID)
 	lkeyRedis.Set("userID", userID)
 	lkeyRedis.Set("name", servername)
+	lkeyRedis.Set("clientString", event.Client.RedisState.Get("clientString"))
 
 	loginPacket := make(map[string]string)
 	loginPacket["TXN"] = "NuLoginPersona"
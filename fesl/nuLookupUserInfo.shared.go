@@ -19,7 +19,7 @@ func (fM *FeslManager) NuLookupUserInfo(event GameSpy.EventClientTLSCommand) {
 		return
 	}
 
-	log.Noteln("LookupUserInfo - CLIENT MODE! " + event.Command.Message["userInfo.0.userName"])
+	log.Debugln("LookupUserInfo - CLIENT MODE! " + event.Command.Message["userInfo.0.userName"])
 
 	personaPacket := make(map[string]string)
 	personaPacket["TXN"] = "NuLookupUserInfo"
@@ -31,6 +31,7 @@ func (fM *FeslManager) NuLookupUserInfo(event GameSpy.EventClientTLSCommand) {
 		var id, userID, heroName, online string
 		err := fM.stmtGetHeroeByName.QueryRow(heroNamePacket).Scan(&id, &userID, &heroName, &online)
 		if err != nil {
+			fM.writeError(event, GameSpy.ErrorCodeNotFound, "The user doesn't exist.")
 			return
 		}
 
@@ -56,6 +57,7 @@ func (fM *FeslManager) NuLookupUserInfoServer(event GameSpy.EventClientTLSComman
 	err = fM.stmtGetServerByID.QueryRow(event.Client.RedisState.Get("sID")).Scan(&id, &userID, &servername, &secretKey, &username)
 	if err != nil {
 		log.Errorln(err)
+		fM.writeError(event, GameSpy.ErrorCodeNotFound, "The server doesn't exist.")
 		return
 	}
 
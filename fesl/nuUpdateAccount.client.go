@@ -0,0 +1,250 @@
+package fesl
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/HeroesAwaken/GoFesl/metrics"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordLength is all bcrypt looks at
+const maxPasswordLength = 72
+
+const maxEmailLength = 254
+
+const (
+	// maxPasswordAttempts wrong current passwords lock the account updates
+	// of a user for passwordAttemptsWindow
+	maxPasswordAttempts    = 5
+	passwordAttemptsWindow = time.Minute * 15
+)
+
+// NuUpdateAccount - CLIENT changes the email and/or password of the account.
+// Both need the current password in oldPassword.
+func (fM *FeslManager) NuUpdateAccount(event GameSpy.EventClientTLSCommand) {
+	if !event.Client.IsActive {
+		log.Noteln("Client left")
+		return
+	}
+
+	userID := event.Client.RedisState.Get("uID")
+	if userID == "" || event.Client.RedisState.Get("clientType") == "server" {
+		fM.rejectAccountUpdate(event, GameSpy.ErrorCodeNotEntitled, "You need to be logged in to update your account.", "not_logged_in")
+		return
+	}
+
+	email := strings.TrimSpace(event.Command.Message["email"])
+	password := event.Command.Message["password"]
+
+	if email == "" && password == "" {
+		fM.rejectAccountUpdate(event, GameSpy.ErrorCodeInvalid, "Nothing to update.", "nothing_to_update")
+		return
+	}
+
+	if email != "" {
+		if err := validateEmail(email); err != nil {
+			fM.rejectAccountUpdate(event, GameSpy.ErrorCodeInvalid, err.Error(), "invalid_email")
+			return
+		}
+	}
+
+	if password != "" {
+		if err := validatePassword(password, fM.config.MinPasswordLength, event.Client.RedisState.Get("username"), email); err != nil {
+			fM.rejectAccountUpdate(event, GameSpy.ErrorCodeInvalid, err.Error(), "weak_password")
+			return
+		}
+	}
+
+	// Updates of a user run concurrently, so the attempt is counted before
+	// the password is checked and only given back when it wasn't wrong
+	if !fM.reservePasswordAttempt(userID) {
+		log.Noteln("Too many wrong passwords updating account " + userID)
+		fM.rejectAccountUpdate(event, GameSpy.ErrorCodeRateLimited, "Too many wrong passwords, try again later.", "too_many_attempts")
+		return
+	}
+
+	err := fM.updateAccount(userID, event.Command.Message["oldPassword"], email, password)
+	if err == errWrongPassword {
+		log.Noteln("Wrong password updating account " + userID)
+		fM.rejectAccountUpdate(event, GameSpy.ErrorCodeWrongPassword, "The password the user specified is incorrect", "wrong_password")
+		return
+	}
+	if err != nil {
+		fM.redis.Decr(passwordAttemptsKey(userID))
+	}
+	if err == errUnsupportedHash {
+		log.Errorln("Password of account " + userID + " isn't a bcrypt hash")
+		fM.rejectAccountUpdate(event, GameSpy.ErrorCodeInternal, "The account couldn't be updated.", "unsupported_hash")
+		return
+	}
+	if err != nil {
+		log.Errorln("Failed updating account "+userID, err.Error())
+		fM.rejectAccountUpdate(event, GameSpy.ErrorCodeInternal, "The account couldn't be updated.", "db_error")
+		return
+	}
+
+	if email != "" {
+		event.Client.RedisState.Set("email", email)
+	}
+	fM.redis.Del(passwordAttemptsKey(userID))
+
+	log.Noteln("Updated account " + userID)
+
+	answer := make(map[string]string)
+	answer["TXN"] = "NuUpdateAccount"
+	event.Client.WriteFESL(event.Command.Query, answer, event.Command.PayloadID)
+	fM.logAnswer(event.Command.Query, answer, event.Command.PayloadID)
+	metrics.CommandOutcome(fM.name, "NuUpdateAccount", metrics.OutcomeSuccess, "")
+}
+
+func (fM *FeslManager) rejectAccountUpdate(event GameSpy.EventClientTLSCommand, code string, message string, reason string) {
+	fM.writeError(event, code, message)
+	metrics.CommandOutcome(fM.name, "NuUpdateAccount", metrics.OutcomeError, reason)
+}
+
+var (
+	errWrongPassword   = errors.New("wrong password")
+	errUnsupportedHash = errors.New("unsupported password hash")
+)
+
+// passwordAttemptsKey counts the wrong current passwords sent for a user
+func passwordAttemptsKey(userID string) string {
+	return "pwattempts:" + userID
+}
+
+// reservePasswordAttempt counts an attempt at the current password of a
+// user, the window starts with the first one. It returns false once more than
+// maxPasswordAttempts were made within passwordAttemptsWindow.
+func (fM *FeslManager) reservePasswordAttempt(userID string) bool {
+	key := passwordAttemptsKey(userID)
+	attempts := fM.redis.Incr(key).Val()
+	if attempts == 1 {
+		fM.redis.Expire(key, passwordAttemptsWindow)
+	}
+	return attempts <= maxPasswordAttempts
+}
+
+// updateAccount checks the current password and then applies the update,
+// empty values are left alone. Hashing is slow, so it's done before the row
+// of the user gets locked. The locked row then only has to show that the
+// password didn't change in the meantime.
+func (fM *FeslManager) updateAccount(userID string, currentPassword string, email string, password string) error {
+	var hash string
+	err := fM.stmtGetUserPasswordByID.QueryRow(userID).Scan(&hash)
+	if err != nil {
+		return err
+	}
+
+	err = checkPassword(hash, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	var newHash []byte
+	if password != "" {
+		newHash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := fM.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var lockedHash string
+	err = tx.Stmt(fM.stmtLockUserPasswordByID).QueryRow(userID).Scan(&lockedHash)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if lockedHash != hash {
+		tx.Rollback()
+		return errWrongPassword
+	}
+
+	if email != "" {
+		_, err = tx.Stmt(fM.stmtUpdateUserEmail).Exec(email, userID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if password != "" {
+		_, err = tx.Stmt(fM.stmtUpdateUserPassword).Exec(string(newHash), userID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// checkPassword compares a password with its hash from users.password. The
+// website stores bcrypt hashes there, the $2y$ ones of PHP's password_hash
+// included. Anything else is refused instead of being taken for a wrong
+// password.
+func checkPassword(hash string, password string) error {
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return errUnsupportedHash
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return errWrongPassword
+	}
+	return nil
+}
+
+// validateEmail checks that email is a plain address
+func validateEmail(email string) error {
+	if len(email) > maxEmailLength {
+		return errors.New("The email address is too long.")
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return errors.New("The email address is invalid.")
+	}
+	return nil
+}
+
+// validatePassword checks that a new password is strong enough: long enough,
+// with letters and digits and not containing the username or email
+func validatePassword(password string, minLength int, username string, email string) error {
+	if len(password) < minLength {
+		return errors.New("The password is too short.")
+	}
+	if len(password) > maxPasswordLength {
+		return errors.New("The password is too long.")
+	}
+
+	var letters, digits bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letters = true
+		case unicode.IsDigit(r):
+			digits = true
+		}
+	}
+	if !letters || !digits {
+		return errors.New("The password needs both letters and digits.")
+	}
+
+	lower := strings.ToLower(password)
+	if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+		return errors.New("The password must not contain the username.")
+	}
+	if email != "" && strings.Contains(lower, strings.ToLower(email)) {
+		return errors.New("The password must not contain the email address.")
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package fesl
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newAccountTest(t *testing.T) (*FeslManager, sqlmock.Sqlmock, *GameSpy.ClientTLS, *GameSpy.Recorder, func()) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Starting miniredis failed: %s", err)
+	}
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Creating sqlmock failed: %s", err)
+	}
+
+	mock.ExpectPrepare(regexp.QuoteMeta("SELECT password"))
+	mock.ExpectPrepare(regexp.QuoteMeta("SELECT password"))
+	mock.ExpectPrepare(regexp.QuoteMeta("UPDATE users SET email"))
+	mock.ExpectPrepare(regexp.QuoteMeta("UPDATE users SET password"))
+
+	fM := new(FeslManager)
+	fM.config = DefaultConfig()
+	fM.db = db
+	fM.stmtGetUserPasswordByID, _ = db.Prepare("SELECT password FROM users WHERE id = ?")
+	fM.stmtLockUserPasswordByID, _ = db.Prepare("SELECT password FROM users WHERE id = ? FOR UPDATE")
+	fM.stmtUpdateUserEmail, _ = db.Prepare("UPDATE users SET email = ?, updated_at = NOW() WHERE id = ?")
+	fM.stmtUpdateUserPassword, _ = db.Prepare("UPDATE users SET password = ?, updated_at = NOW() WHERE id = ?")
+
+	fM.redis = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	recorder := new(GameSpy.Recorder)
+	client := new(GameSpy.ClientTLS)
+	client.NewWithWriter("test", recorder)
+	client.RedisState = new(core.RedisState)
+	client.RedisState.New(fM.redis, "client-test")
+	client.RedisState.Set("uID", "7")
+	client.RedisState.Set("username", "hero")
+
+	return fM, mock, client, recorder, func() {
+		db.Close()
+		mr.Close()
+	}
+}
+
+func updateAccountCommand(client *GameSpy.ClientTLS, message map[string]string) GameSpy.EventClientTLSCommand {
+	message["TXN"] = "NuUpdateAccount"
+	return GameSpy.EventClientTLSCommand{
+		Client:  client,
+		Command: &GameSpy.CommandFESL{Query: "acct", Message: message},
+	}
+}
+
+func TestNuUpdateAccount(t *testing.T) {
+	fM, mock, client, recorder, cleanup := newAccountTest(t)
+	defer cleanup()
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("old-secret1"), bcrypt.MinCost)
+
+	// Checked and hashed before the row gets locked
+	mock.ExpectQuery(`SELECT password FROM users WHERE id = \?$`).WithArgs("7").WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(string(hash)))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE")).WithArgs("7").WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(string(hash)))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET email")).WithArgs("new@example.com", "7").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET password")).WithArgs(sqlmock.AnyArg(), "7").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	fM.NuUpdateAccount(updateAccountCommand(client, map[string]string{
+		"email":       "new@example.com",
+		"password":    "n3w-Secret",
+		"oldPassword": "old-secret1",
+	}))
+
+	packets := recorder.Packets()
+	if len(packets) != 1 || packets[0].Message["errorCode"] != "" {
+		t.Fatalf("NuUpdateAccount was incorrect, got: %v, want a confirmation.", packets)
+	}
+	if email := client.RedisState.Get("email"); email != "new@example.com" {
+		t.Errorf("NuUpdateAccount email was incorrect, got: %s, want: %s.", email, "new@example.com")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("NuUpdateAccount was incorrect: %s", err)
+	}
+}
+
+func TestNuUpdateAccountRejectsWeakPassword(t *testing.T) {
+	fM, mock, client, recorder, cleanup := newAccountTest(t)
+	defer cleanup()
+
+	tables := []struct {
+		password string
+	}{
+		{"short1"},
+		{"onlyletters"},
+		{"12345678901"},
+		{"myhero123name"},
+	}
+
+	for _, table := range tables {
+		fM.NuUpdateAccount(updateAccountCommand(client, map[string]string{
+			"password":    table.password,
+			"oldPassword": "old-secret1",
+		}))
+	}
+
+	packets := recorder.Packets()
+	if len(packets) != len(tables) {
+		t.Fatalf("NuUpdateAccount packets were incorrect, got: %v, want: %d errors.", packets, len(tables))
+	}
+	for i, table := range tables {
+		if packets[i].Message["errorCode"] != "99" {
+			t.Errorf("NuUpdateAccount for %q was incorrect, got errorCode: %s, want: %s.", table.password, packets[i].Message["errorCode"], "99")
+		}
+	}
+
+	// Nothing may have been looked up or written
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("NuUpdateAccount was incorrect: %s", err)
+	}
+}
+
+func TestNuUpdateAccountLimitsWrongPasswords(t *testing.T) {
+	fM, mock, client, recorder, cleanup := newAccountTest(t)
+	defer cleanup()
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("old-secret1"), bcrypt.MinCost)
+
+	for i := 0; i < maxPasswordAttempts; i++ {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT password")).WithArgs("7").WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(string(hash)))
+		fM.NuUpdateAccount(updateAccountCommand(client, map[string]string{"email": "new@example.com", "oldPassword": "guess"}))
+	}
+
+	// Not even looked up anymore, the right password included
+	fM.NuUpdateAccount(updateAccountCommand(client, map[string]string{"email": "new@example.com", "oldPassword": "old-secret1"}))
+
+	packets := recorder.Packets()
+	if len(packets) != maxPasswordAttempts+1 {
+		t.Fatalf("NuUpdateAccount packets were incorrect, got: %v, want: %d errors.", packets, maxPasswordAttempts+1)
+	}
+	for _, packet := range packets[:maxPasswordAttempts] {
+		if packet.Message["errorCode"] != "122" {
+			t.Errorf("NuUpdateAccount was incorrect, got errorCode: %s, want: %s.", packet.Message["errorCode"], "122")
+		}
+	}
+	if code := packets[maxPasswordAttempts].Message["errorCode"]; code != "108" {
+		t.Errorf("NuUpdateAccount was incorrect, got errorCode: %s, want: %s.", code, "108")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("NuUpdateAccount was incorrect: %s", err)
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("old-secret1"), bcrypt.MinCost)
+	php := "$2y$" + string(hash[4:])
+
+	tables := []struct {
+		hash     string
+		password string
+		err      error
+	}{
+		{string(hash), "old-secret1", nil},
+		{string(hash), "guess", errWrongPassword},
+		{php, "old-secret1", nil},
+		{"5ebe2294ecd0e0f08eab7690d2a6ee69", "secret", errUnsupportedHash},
+		{"", "", errUnsupportedHash},
+	}
+
+	for _, table := range tables {
+		if err := checkPassword(table.hash, table.password); err != table.err {
+			t.Errorf("checkPassword(%q, %q) was incorrect, got: %v, want: %v.", table.hash, table.password, err, table.err)
+		}
+	}
+}
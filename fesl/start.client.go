@@ -17,13 +17,16 @@ func (fM *FeslManager) Start(event GameSpy.EventClientTLSCommand) {
 	// Check if user is allowed to matchmake
 	if !fM.userHasPermission(event.Client.RedisState.Get("uID"), "game.matchmake") {
 		log.Noteln("User not worthy: " + event.Client.RedisState.Get("username"))
+		fM.writeError(event, GameSpy.ErrorCodeNotEntitled, "You are not allowed to matchmake.")
 		return
 	}
 
 	// Check if user has op rocket equipped
-	rows, err := fM.getStatsStatement(2).Query(event.Client.RedisState.Get("heroID"), event.Client.RedisState.Get("uID"), "c_eqp", "c_apr")
+	rows, err := fM.getStatsStatement(statsTable(event.Client), 2).Query(event.Client.RedisState.Get("heroID"), event.Client.RedisState.Get("uID"), "c_eqp", "c_apr")
 	if err != nil {
 		log.Errorln("Failed gettings stats for hero "+event.Client.RedisState.Get("heroID"), err.Error())
+		fM.writeError(event, GameSpy.ErrorCodeInternal, "Your hero couldn't be loaded.")
+		return
 	}
 
 	stats := make(map[string]string)
@@ -38,11 +41,12 @@ func (fM *FeslManager) Start(event GameSpy.EventClientTLSCommand) {
 
 	if strings.Contains(stats["c_eqp"], "3018") {
 		log.Noteln("User trying to matchmake with op launcher")
+		fM.writeError(event, GameSpy.ErrorCodeNotEntitled, "You can't matchmake with this launcher equipped.")
 		return
 	}
 
-	log.Noteln("START CALLED")
-	log.Noteln(event.Command.Message["partition.partition"])
+	log.Debugln("START CALLED")
+	log.Debugln(event.Command.Message["partition.partition"])
 	answer := make(map[string]string)
 	answer["TXN"] = "Start"
 	answer["id.id"] = "1"
@@ -0,0 +1,61 @@
+package fesl
+
+import (
+	"errors"
+	"strconv"
+)
+
+// maxStatsKeys is the most stats one request may ask for or update, more
+// keys than that are ignored
+const maxStatsKeys = 64
+
+// maxStatsUsers is the most users one UpdateStats may update, a full server
+// stays well below it
+const maxStatsUsers = 64
+
+// parseStatsKeys reads a list of stat keys sent as prefix.[] with the keys in
+// prefix.0suffix, prefix.1suffix, ... Lists which are empty, have a
+// malformed count or miss some of the keys they announce are rejected.
+func parseStatsKeys(message map[string]string, prefix string, suffix string) ([]string, error) {
+	count, err := strconv.Atoi(message[prefix+".[]"])
+	if err != nil || count < 0 {
+		return nil, errors.New("invalid keys count")
+	}
+	if count == 0 {
+		return nil, errors.New("no keys")
+	}
+	if count > maxStatsKeys {
+		count = maxStatsKeys
+	}
+
+	keys := make([]string, count)
+	for i := range keys {
+		key := message[prefix+"."+strconv.Itoa(i)+suffix]
+		if key == "" {
+			return nil, errors.New("missing key " + strconv.Itoa(i))
+		}
+		keys[i] = key
+	}
+
+	return keys, nil
+}
+
+// parseStatsUsers reads the count of users an UpdateStats sends as u.[].
+// A missing count means a single user, malformed, negative or oversized
+// counts are rejected.
+func parseStatsUsers(message map[string]string) (int, error) {
+	count, ok := message["u.[]"]
+	if !ok || count == "" {
+		return 1, nil
+	}
+
+	users, err := strconv.Atoi(count)
+	if err != nil || users < 0 || users > maxStatsUsers {
+		return 0, errors.New("invalid users count")
+	}
+	if users == 0 {
+		return 1, nil
+	}
+
+	return users, nil
+}
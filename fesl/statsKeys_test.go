@@ -0,0 +1,185 @@
+package fesl
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+)
+
+// keysMessage announces count keys and sends the first present of them
+func keysMessage(count string, present int) map[string]string {
+	message := map[string]string{"TXN": "GetStats", "owner": "1", "keys.[]": count}
+	for i := 0; i < present; i++ {
+		message["keys."+strconv.Itoa(i)] = "key" + strconv.Itoa(i)
+	}
+	return message
+}
+
+func TestParseStatsKeys(t *testing.T) {
+	tables := []struct {
+		name    string
+		message map[string]string
+		keys    int
+		valid   bool
+	}{
+		{"valid", keysMessage("3", 3), 3, true},
+		{"negative", keysMessage("-1", 3), 0, false},
+		{"zero", keysMessage("0", 3), 0, false},
+		{"malformed", keysMessage("3a", 3), 0, false},
+		{"missing", map[string]string{"keys.0": "level"}, 0, false},
+		{"oversized", keysMessage("100000", maxStatsKeys+10), maxStatsKeys, true},
+		{"oversized and missing", keysMessage("100000", 3), 0, false},
+		{"mismatched", keysMessage("4", 3), 0, false},
+		{"empty key", map[string]string{"keys.[]": "2", "keys.0": "level", "keys.1": ""}, 0, false},
+	}
+
+	for _, table := range tables {
+		keys, err := parseStatsKeys(table.message, "keys", "")
+		if (err == nil) != table.valid {
+			t.Errorf("parseStatsKeys for %s was incorrect, got error: %v, want valid: %t.", table.name, err, table.valid)
+			continue
+		}
+		if len(keys) != table.keys {
+			t.Errorf("parseStatsKeys for %s was incorrect, got %d keys, want: %d.", table.name, len(keys), table.keys)
+		}
+	}
+}
+
+func TestParseStatsUsers(t *testing.T) {
+	tables := []struct {
+		name  string
+		count string
+		users int
+		valid bool
+	}{
+		{"valid", "2", 2, true},
+		{"missing", "", 1, true},
+		{"zero", "0", 1, true},
+		{"negative", "-1", 0, false},
+		{"malformed", "2a", 0, false},
+		{"oversized", "2000000000", 0, false},
+	}
+
+	for _, table := range tables {
+		message := map[string]string{"TXN": "UpdateStats"}
+		if table.count != "" {
+			message["u.[]"] = table.count
+		}
+
+		users, err := parseStatsUsers(message)
+		if (err == nil) != table.valid {
+			t.Errorf("parseStatsUsers for %s was incorrect, got error: %v, want valid: %t.", table.name, err, table.valid)
+			continue
+		}
+		if users != table.users {
+			t.Errorf("parseStatsUsers for %s was incorrect, got %d users, want: %d.", table.name, users, table.users)
+		}
+	}
+}
+
+func TestGetStatsRejectsMalformedKeys(t *testing.T) {
+	tables := []struct {
+		name    string
+		message map[string]string
+	}{
+		{"negative", keysMessage("-1", 1)},
+		{"zero", keysMessage("0", 1)},
+		{"oversized", keysMessage("100000", 1)},
+		{"mismatched", keysMessage("4", 3)},
+	}
+
+	for _, table := range tables {
+		fM := new(FeslManager)
+		fM.config = DefaultConfig()
+
+		recorder := new(GameSpy.Recorder)
+		client := new(GameSpy.ClientTLS)
+		client.NewWithWriter("test", recorder)
+
+		fM.GetStats(GameSpy.EventClientTLSCommand{
+			Client:  client,
+			Command: &GameSpy.CommandFESL{Query: "rank", Message: table.message},
+		})
+
+		packets := recorder.Packets()
+		if len(packets) != 1 || packets[0].Message["errorCode"] != "99" {
+			t.Errorf("GetStats for %s keys was incorrect, got: %v, want errorCode: %s.", table.name, packets, "99")
+		}
+	}
+}
+
+func TestUpdateStatsRejectsMalformedKeys(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Starting miniredis failed: %s", err)
+	}
+	defer mr.Close()
+
+	fM := new(FeslManager)
+
+	recorder := new(GameSpy.Recorder)
+	client := new(GameSpy.ClientTLS)
+	client.NewWithWriter("test", recorder)
+	client.RedisState = new(core.RedisState)
+	client.RedisState.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "client-test")
+
+	// The first user is fine, the second one announces a key it doesn't send
+	fM.UpdateStats(GameSpy.EventClientTLSCommand{
+		Client: client,
+		Command: &GameSpy.CommandFESL{Query: "rank", Message: map[string]string{
+			"TXN":       "UpdateStats",
+			"u.[]":      "2",
+			"u.0.o":     "1",
+			"u.0.s.[]":  "1",
+			"u.0.s.0.k": "level",
+			"u.0.s.0.t": "2",
+			"u.1.o":     "2",
+			"u.1.s.[]":  "2",
+			"u.1.s.0.k": "level",
+		}},
+	})
+
+	packets := recorder.Packets()
+	if len(packets) != 1 || packets[0].Message["errorCode"] != "99" {
+		t.Errorf("UpdateStats was incorrect, got: %v, want errorCode: %s.", packets, "99")
+	}
+}
+
+func TestUpdateStatsRejectsMalformedUsers(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Starting miniredis failed: %s", err)
+	}
+	defer mr.Close()
+
+	for _, count := range []string{"-1", "2000000000", "2a"} {
+		fM := new(FeslManager)
+
+		recorder := new(GameSpy.Recorder)
+		client := new(GameSpy.ClientTLS)
+		client.NewWithWriter("test", recorder)
+		client.RedisState = new(core.RedisState)
+		client.RedisState.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "client-test")
+
+		fM.UpdateStats(GameSpy.EventClientTLSCommand{
+			Client: client,
+			Command: &GameSpy.CommandFESL{Query: "rank", Message: map[string]string{
+				"TXN":       "UpdateStats",
+				"u.[]":      count,
+				"u.0.o":     "1",
+				"u.0.s.[]":  "1",
+				"u.0.s.0.k": "level",
+				"u.0.s.0.t": "2",
+			}},
+		})
+
+		packets := recorder.Packets()
+		if len(packets) != 1 || packets[0].Message["errorCode"] != "99" {
+			t.Errorf("UpdateStats for %s users was incorrect, got: %v, want errorCode: %s.", count, packets, "99")
+		}
+	}
+}
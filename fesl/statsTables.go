@@ -0,0 +1,18 @@
+package fesl
+
+import (
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+// StatsTables maps the clientString a game sends with Hello to the table
+// its hero stats are kept in
+var StatsTables lib.StatsTables
+
+// statsTable returns the stats table of the game a client is playing
+func statsTable(client *GameSpy.ClientTLS) string {
+	if client.RedisState == nil {
+		return lib.DefaultStatsTable
+	}
+	return StatsTables.For(client.RedisState.Get("clientString"))
+}
@@ -0,0 +1,73 @@
+package fesl
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+)
+
+func TestGetStatsTargetsGameTable(t *testing.T) {
+	StatsTables = map[string]string{"game-a": "game_a_stats", "game-b": "game_b_stats"}
+	defer func() { StatsTables = nil }()
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Starting miniredis failed: %s", err)
+	}
+	defer mr.Close()
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Creating sqlmock failed: %s", err)
+	}
+	defer db.Close()
+
+	fM := new(FeslManager)
+	fM.config = DefaultConfig()
+	fM.db = db
+	fM.prepareStatsStatements(db)
+
+	columns := []string{"user_id", "heroID", "statsKey", "statsValue"}
+	mock.ExpectPrepare("FROM game_a_stats").ExpectQuery().WillReturnRows(sqlmock.NewRows(columns).AddRow("1", "2", "level", "3"))
+	mock.ExpectPrepare("FROM game_b_stats").ExpectQuery().WillReturnRows(sqlmock.NewRows(columns).AddRow("1", "2", "level", "7"))
+
+	tables := []struct {
+		game  string
+		level string
+	}{
+		{"game-a", "3"},
+		{"game-b", "7"},
+	}
+
+	for _, table := range tables {
+		recorder := new(GameSpy.Recorder)
+		client := new(GameSpy.ClientTLS)
+		client.NewWithWriter("test", recorder)
+		client.RedisState = new(core.RedisState)
+		client.RedisState.New(redisClient, "client-"+table.game)
+		client.RedisState.Set("clientString", table.game)
+		client.RedisState.Set("uID", "1")
+
+		fM.GetStats(GameSpy.EventClientTLSCommand{
+			Client: client,
+			Command: &GameSpy.CommandFESL{
+				Query:   "rank",
+				Message: map[string]string{"TXN": "GetStats", "owner": "2", "keys.[]": "1", "keys.0": "level"},
+			},
+		})
+
+		packets := recorder.Packets()
+		if len(packets) != 1 || packets[0].Message["stats.0.value"] != table.level {
+			t.Errorf("GetStats for %s was incorrect, got: %v, want level: %s.", table.game, packets, table.level)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("GetStats was incorrect, %s", err)
+	}
+}
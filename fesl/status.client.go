@@ -1,9 +1,6 @@
 package fesl
 
 import (
-	"encoding/binary"
-	"fmt"
-	"net"
 	"strconv"
 	"strings"
 
@@ -27,7 +24,7 @@ func (fM *FeslManager) Status(event GameSpy.EventClientTLSCommand) {
 	}
 
 	// Check if user has op rocket equipped
-	rows, err := fM.getStatsStatement(2).Query(event.Client.RedisState.Get("heroID"), event.Client.RedisState.Get("uID"), "c_eqp", "c_apr")
+	rows, err := fM.getStatsStatement(statsTable(event.Client), 2).Query(event.Client.RedisState.Get("heroID"), event.Client.RedisState.Get("uID"), "c_eqp", "c_apr")
 	if err != nil {
 		log.Errorln("Failed gettings stats for hero "+event.Client.RedisState.Get("heroID"), err.Error())
 		fM.sendDenied(event)
@@ -49,7 +46,7 @@ func (fM *FeslManager) Status(event GameSpy.EventClientTLSCommand) {
 		return
 	}
 
-	log.Noteln("STATUS CALLED")
+	log.Debugln("STATUS CALLED")
 
 	answer := make(map[string]string)
 	answer["TXN"] = "Status"
@@ -60,8 +57,12 @@ func (fM *FeslManager) Status(event GameSpy.EventClientTLSCommand) {
 	answer["props.{resultType}"] = "JOIN"
 
 	// Find latest game (do better later)
-	ipint := binary.BigEndian.Uint32(event.Client.IpAddr.(*net.TCPAddr).IP.To4())
-	gameIDs := matchmaking.FindAvailableGIDs(event.Client.RedisState.Get("heroID"), fmt.Sprint(ipint))
+	var gameIDs []string
+	if ip, ok := clientIP(event.Client.IpAddr); ok {
+		gameIDs = matchmaking.FindAvailableGIDs(event.Client.RedisState.Get("heroID"), matchmakingAddress(ip))
+	} else {
+		log.Errorln("Failed reading the address of", event.Client.IpAddr)
+	}
 
 	for i, gid := range gameIDs {
 		answer["props.{games}."+strconv.Itoa(i)+".lid"] = "1"
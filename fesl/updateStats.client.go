@@ -5,6 +5,7 @@ import (
 
 	"github.com/HeroesAwaken/GoFesl/GameSpy"
 	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/HeroesAwaken/GoFesl/metrics"
 )
 
 type stat struct {
@@ -24,30 +25,51 @@ func (fM *FeslManager) UpdateStats(event GameSpy.EventClientTLSCommand) {
 
 	userId := event.Client.RedisState.Get("uID")
 
-	users, _ := strconv.Atoi(event.Command.Message["u.[]"])
+	users, err := parseStatsUsers(event.Command.Message)
+	if err != nil {
+		log.Noteln("Invalid users in UpdateStats", err.Error())
+		fM.writeError(event, GameSpy.ErrorCodeInvalid, err.Error())
+		metrics.CommandOutcome(fM.name, "UpdateStats", metrics.OutcomeError, "invalid_users")
+		return
+	}
 
-	if users == 0 {
-		log.Warning("No u.[], defaulting to 1")
-		users = 1
+	// Check the keys of all users first, so nothing gets updated when any of
+	// them is malformed
+	keysOfUsers := make([][]string, users)
+	for i := range keysOfUsers {
+		keys, err := parseStatsKeys(event.Command.Message, "u."+strconv.Itoa(i)+".s", ".k")
+		if err != nil {
+			log.Noteln("Invalid keys in UpdateStats for user "+strconv.Itoa(i), err.Error())
+			fM.writeError(event, GameSpy.ErrorCodeInvalid, err.Error())
+			metrics.CommandOutcome(fM.name, "UpdateStats", metrics.OutcomeError, "invalid_keys")
+			return
+		}
+		keysOfUsers[i] = keys
 	}
 
+	// Work out the new stats of all users before writing any of them, so a
+	// rejected user doesn't leave the others partly updated
+	owners := make([]string, users)
+	updates := make([][]interface{}, users)
 	for i := 0; i < users; i++ {
 		owner, ok := event.Command.Message["u."+strconv.Itoa(i)+".o"]
+		if !ok {
+			fM.writeError(event, GameSpy.ErrorCodeInvalid, "missing owner")
+			return
+		}
+
 		if event.Client.RedisState.Get("clientType") == "server" {
 
 			var id, userIDhero, heroName, online string
 			err := fM.stmtGetHeroeByID.QueryRow(owner).Scan(&id, &userIDhero, &heroName, &online)
 			if err != nil {
 				log.Noteln("Persona not worthy!")
+				fM.writeError(event, GameSpy.ErrorCodeNotFound, "The persona doesn't exist.")
 				return
 			}
 
 			userId = userIDhero
-			log.Noteln("Server updating stats")
-		}
-
-		if !ok {
-			return
+			log.Debugln("Server updating stats")
 		}
 
 		stats := make(map[string]*stat)
@@ -58,15 +80,17 @@ func (fM *FeslManager) UpdateStats(event GameSpy.EventClientTLSCommand) {
 		statsKeys := make(map[string]string)
 		argsGet = append(argsGet, owner)
 		argsGet = append(argsGet, userId)
-		keys, _ := strconv.Atoi(event.Command.Message["u."+strconv.Itoa(i)+".s.[]"])
-		for j := 0; j < keys; j++ {
-			argsGet = append(argsGet, event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".k"])
-			statsKeys[event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".k"]] = strconv.Itoa(j)
+		keys := keysOfUsers[i]
+		for j, key := range keys {
+			argsGet = append(argsGet, key)
+			statsKeys[key] = strconv.Itoa(j)
 		}
 
-		rows, err := fM.getStatsStatement(keys).Query(argsGet...)
+		rows, err := fM.getStatsStatement(statsTable(event.Client), len(keys)).Query(argsGet...)
 		if err != nil {
 			log.Errorln("Failed gettings stats for hero "+owner, err.Error())
+			fM.writeError(event, GameSpy.ErrorCodeInternal, "The stats couldn't be loaded.")
+			return
 		}
 
 		count := 0
@@ -103,18 +127,17 @@ func (fM *FeslManager) UpdateStats(event GameSpy.EventClientTLSCommand) {
 
 		// Generate our argument list for the statement -> userId, owner, key1, value1, userId, owner, key2, value2, userId, owner, ...
 		var args []interface{}
-		keys, _ = strconv.Atoi(event.Command.Message["u."+strconv.Itoa(i)+".s.[]"])
-		for j := 0; j < keys; j++ {
+		for j := range keys {
 
 			if event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".ut"] != "3" {
-				log.Noteln("Update new Type:", event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".k"], event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".t"], event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".ut"], event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".v"], event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".pt"])
+				log.Debugln("Update new Type:", event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".k"], event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".t"], event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".ut"], event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".v"], event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".pt"])
 			}
 
 			key := event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".k"]
 			value := event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".t"]
 
 			if value == "" {
-				log.Noteln("Updating stat", key+":", event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".v"], "+", stats[key].value)
+				log.Debugln("Updating stat", key+":", event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".v"], "+", stats[key].value)
 				// We are dealing with a number
 				value = event.Command.Message["u."+strconv.Itoa(i)+".s."+strconv.Itoa(j)+".v"]
 
@@ -160,16 +183,24 @@ func (fM *FeslManager) UpdateStats(event GameSpy.EventClientTLSCommand) {
 
 			// We need to append 3 values for each insert/update,
 			// owner, key and value
-			log.Noteln("Updating stats:", userId, owner, key, value)
+			log.Debugln("Updating stats:", userId, owner, key, value)
 			args = append(args, userId)
 			args = append(args, owner)
 			args = append(args, key)
 			args = append(args, value)
 		}
 
-		_, err = fM.setStatsStatement(keys).Exec(args...)
+		owners[i] = owner
+		updates[i] = args
+	}
+
+	for i, args := range updates {
+		_, err = fM.setStatsStatement(statsTable(event.Client), len(keysOfUsers[i])).Exec(args...)
 		if err != nil {
-			log.Errorln("Failed setting stats for hero "+owner, err.Error())
+			log.Errorln("Failed setting stats for hero "+owners[i], err.Error())
+			fM.writeError(event, GameSpy.ErrorCodeInternal, "The stats couldn't be saved.")
+			metrics.CommandOutcome(fM.name, "UpdateStats", metrics.OutcomeError, "db_error")
+			return
 		}
 	}
 
@@ -0,0 +1,94 @@
+package fesl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+)
+
+// updateStatsMessage updates level of hero 1 and, as the second user, stat
+// key of hero 2 by value
+func updateStatsMessage(key string, value string) map[string]string {
+	return map[string]string{
+		"TXN":        "UpdateStats",
+		"u.[]":       "2",
+		"u.0.o":      "1",
+		"u.0.s.[]":   "1",
+		"u.0.s.0.k":  "level",
+		"u.0.s.0.t":  "2",
+		"u.1.o":      "2",
+		"u.1.s.[]":   "1",
+		"u.1.s.0.k":  key,
+		"u.1.s.0.v":  value,
+		"u.1.s.0.ut": "3",
+	}
+}
+
+func TestUpdateStatsWritesAllUsersOrNone(t *testing.T) {
+	tables := []struct {
+		name      string
+		key       string
+		value     string
+		writes    int
+		writeErr  error
+		errorCode string
+	}{
+		{"rejected second user", "c_wallet_hero", "5", 0, nil, ""},
+		{"failed write", "c_ltp", "5", 2, errors.New("deadlock"), "112"},
+		{"written", "c_ltp", "5", 2, nil, ""},
+	}
+
+	for _, table := range tables {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Creating sqlmock failed: %s", err)
+		}
+
+		fM := new(FeslManager)
+		fM.prepareStatsStatements(db)
+
+		mock.ExpectPrepare("SELECT user_id, heroID, statsKey, statsValue")
+		mock.ExpectQuery("SELECT user_id").WithArgs("1", "42", "level").
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "heroID", "statsKey", "statsValue"}))
+		mock.ExpectQuery("SELECT user_id").WithArgs("2", "42", table.key).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "heroID", "statsKey", "statsValue"}).AddRow("42", "2", table.key, "10"))
+		if table.writes > 0 {
+			mock.ExpectPrepare("INSERT INTO game_stats")
+			mock.ExpectExec("INSERT INTO game_stats").WithArgs("42", "1", "level", "2").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("INSERT INTO game_stats").WithArgs("42", "2", table.key, "15.0000").WillReturnResult(sqlmock.NewResult(0, 1)).WillReturnError(table.writeErr)
+		}
+
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatalf("Starting miniredis failed: %s", err)
+		}
+
+		recorder := new(GameSpy.Recorder)
+		client := new(GameSpy.ClientTLS)
+		client.NewWithWriter("test", recorder)
+		client.RedisState = new(core.RedisState)
+		client.RedisState.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "client")
+		client.RedisState.Set("uID", "42")
+
+		fM.UpdateStats(GameSpy.EventClientTLSCommand{
+			Client:  client,
+			Command: &GameSpy.CommandFESL{Query: "rank", Message: updateStatsMessage(table.key, table.value)},
+		})
+
+		packets := recorder.Packets()
+		if len(packets) != 1 || packets[0].Message["errorCode"] != table.errorCode {
+			t.Errorf("UpdateStats for %s was incorrect, got: %v, want errorCode: %q.", table.name, packets, table.errorCode)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("UpdateStats database calls for %s were incorrect: %s", table.name, err)
+		}
+
+		mr.Close()
+		db.Close()
+	}
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+type banCacheEntry struct {
+	banned  bool
+	checked time.Time
+}
+
+// BanChecker looks up whether an account is banned. Results are cached for
+// a short while so we don't hit the db on every command of the same user.
+type BanChecker struct {
+	stmtGetActiveBans *sql.Stmt
+	cacheTTL          time.Duration
+	cache             map[string]banCacheEntry
+	lastPrune         time.Time
+	mutex             sync.Mutex
+}
+
+// New - prepares the lookup statement
+func (bC *BanChecker) New(db *sql.DB, cacheTTL time.Duration) error {
+	var err error
+
+	bC.cacheTTL = cacheTTL
+	bC.cache = make(map[string]banCacheEntry)
+
+	// Temporary bans past their expiry don't count
+	bC.stmtGetActiveBans, err = db.Prepare(
+		"SELECT count(id)" +
+			"	FROM bans" +
+			"	WHERE user_id = ?" +
+			"		AND (expires_at IS NULL OR expires_at > NOW())")
+	return err
+}
+
+// IsBanned - returns true if the account has an active ban. Callers should
+// refuse the account when the lookup fails.
+func (bC *BanChecker) IsBanned(userID string) (bool, error) {
+	bC.mutex.Lock()
+	entry, ok := bC.cache[userID]
+	bC.mutex.Unlock()
+
+	if ok && time.Since(entry.checked) < bC.cacheTTL {
+		return entry.banned, nil
+	}
+
+	var count int
+	err := bC.stmtGetActiveBans.QueryRow(userID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+
+	bC.mutex.Lock()
+	bC.prune(now)
+	bC.cache[userID] = banCacheEntry{
+		banned:  count > 0,
+		checked: now,
+	}
+	bC.mutex.Unlock()
+
+	return count > 0, nil
+}
+
+// prune drops expired entries, at most once per cacheTTL so it doesn't run
+// on every lookup. The mutex must be held.
+func (bC *BanChecker) prune(now time.Time) {
+	if now.Sub(bC.lastPrune) < bC.cacheTTL {
+		return
+	}
+	bC.lastPrune = now
+
+	for userID, entry := range bC.cache {
+		if now.Sub(entry.checked) >= bC.cacheTTL {
+			delete(bC.cache, userID)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newTestBanChecker(t *testing.T, cacheTTL time.Duration) (*BanChecker, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Creating sqlmock failed: %s", err)
+	}
+
+	mock.ExpectPrepare("SELECT count")
+	bC := new(BanChecker)
+	if err := bC.New(conn, cacheTTL); err != nil {
+		t.Fatalf("Preparing bans failed: %s", err)
+	}
+
+	return bC, mock
+}
+
+func TestIsBannedCachesResults(t *testing.T) {
+	bC, mock := newTestBanChecker(t, time.Minute)
+
+	mock.ExpectQuery("SELECT count").WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT count").WithArgs("2").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	for i := 0; i < 2; i++ {
+		if banned, err := bC.IsBanned("1"); err != nil || !banned {
+			t.Errorf("IsBanned was incorrect, got: %t, %v, want: %t.", banned, err, true)
+		}
+		if banned, err := bC.IsBanned("2"); err != nil || banned {
+			t.Errorf("IsBanned was incorrect, got: %t, %v, want: %t.", banned, err, false)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("IsBanned database calls were incorrect: %s", err)
+	}
+}
+
+func TestIsBannedReturnsErrors(t *testing.T) {
+	bC, mock := newTestBanChecker(t, time.Minute)
+
+	mock.ExpectQuery("SELECT count").WithArgs("1").WillReturnError(errors.New("connection lost"))
+	mock.ExpectQuery("SELECT count").WithArgs("1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	if _, err := bC.IsBanned("1"); err == nil {
+		t.Errorf("IsBanned was incorrect, got no error for a failed lookup.")
+	}
+
+	// Failures aren't cached, the next lookup asks again
+	if banned, err := bC.IsBanned("1"); err != nil || !banned {
+		t.Errorf("IsBanned was incorrect, got: %t, %v, want: %t.", banned, err, true)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("IsBanned database calls were incorrect: %s", err)
+	}
+}
+
+func TestIsBannedPrunesExpiredEntries(t *testing.T) {
+	bC, mock := newTestBanChecker(t, time.Minute)
+
+	mock.ExpectQuery("SELECT count").WithArgs("3").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	expired := time.Now().Add(-2 * time.Minute)
+	bC.cache["1"] = banCacheEntry{checked: expired}
+	bC.cache["2"] = banCacheEntry{checked: time.Now()}
+	bC.lastPrune = expired
+
+	if _, err := bC.IsBanned("3"); err != nil {
+		t.Fatalf("IsBanned failed: %s", err)
+	}
+
+	if _, ok := bC.cache["1"]; ok {
+		t.Errorf("IsBanned was incorrect, the expired entry was kept.")
+	}
+	for _, userID := range []string{"2", "3"} {
+		if _, ok := bC.cache[userID]; !ok {
+			t.Errorf("IsBanned was incorrect, the entry of %s was dropped.", userID)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package lib
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HeroesAwaken/GoFesl/log"
+)
+
+// DB keeps a mysql pool usable across database restarts. It pings on an
+// interval, re-establishes the pool and re-prepares its statements when
+// that fails, and retries transient errors a bounded number of times.
+type DB struct {
+	conn       *sql.DB
+	statements []*Stmt
+	mutex      sync.RWMutex
+	stop       chan bool
+	stopOnce   sync.Once
+
+	// Retries is how often a transient error is retried before giving up
+	Retries int
+	// RetryDelay is waited before the first retry, longer before later ones
+	RetryDelay time.Duration
+}
+
+// Stmt is a prepared statement of a DB, it gets re-prepared on reconnects
+type Stmt struct {
+	db    *DB
+	query string
+	stmt  *sql.Stmt
+}
+
+// maxIdleConns is what database/sql uses by default
+const maxIdleConns = 2
+
+// retiredStmtGrace is how long statements replaced on a reconnect stay open,
+// so calls which already got them can finish
+const retiredStmtGrace = time.Minute
+
+// New - wraps a pool, pinging it every pingInterval (0 disables pinging)
+func (db *DB) New(conn *sql.DB, pingInterval time.Duration) {
+	db.conn = conn
+	db.stop = make(chan bool)
+	db.Retries = 3
+	db.RetryDelay = time.Millisecond * 100
+
+	if pingInterval > 0 {
+		go db.ping(pingInterval)
+	}
+}
+
+// Close stops pinging, the pool itself stays open. It may be called more
+// than once.
+func (db *DB) Close() {
+	db.stopOnce.Do(func() {
+		close(db.stop)
+	})
+}
+
+// Conn returns the wrapped pool
+func (db *DB) Conn() *sql.DB {
+	return db.conn
+}
+
+// Prepare prepares a statement that's re-prepared on reconnects
+func (db *DB) Prepare(query string) (*Stmt, error) {
+	stmt, err := db.conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &Stmt{db: db, query: query, stmt: stmt}
+
+	db.mutex.Lock()
+	db.statements = append(db.statements, statement)
+	db.mutex.Unlock()
+
+	return statement, nil
+}
+
+// Begin starts a transaction, retrying transient errors
+func (db *DB) Begin() (*sql.Tx, error) {
+	var tx *sql.Tx
+	err := db.Retry(func() error {
+		var err error
+		tx, err = db.conn.Begin()
+		return err
+	})
+	return tx, err
+}
+
+// Retry calls f until it succeeds, fails with an error that isn't transient
+// or ran out of retries. Lost connections are re-established, but only
+// errors which guarantee f didn't apply are retried.
+func (db *DB) Retry(f func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = f()
+		if err == nil {
+			return nil
+		}
+
+		if isConnectionError(err) {
+			if reconnectErr := db.reconnect(); reconnectErr != nil {
+				log.Errorln("Reconnecting to db failed", reconnectErr.Error())
+			}
+		}
+
+		if !IsTransient(err) || attempt >= db.Retries {
+			return err
+		}
+
+		log.Warningln("Retrying transient db error", err.Error())
+		time.Sleep(db.RetryDelay * time.Duration(attempt+1))
+	}
+}
+
+func (db *DB) ping(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := db.conn.Ping(); err != nil {
+				log.Errorln("Lost connection to db", err.Error())
+				if err := db.reconnect(); err != nil {
+					log.Errorln("Reconnecting to db failed", err.Error())
+				}
+			}
+		case <-db.stop:
+			return
+		}
+	}
+}
+
+// reconnect drops the idle connections of the pool, which may all be dead,
+// and re-prepares the statements on a fresh one. Statements which fail to
+// prepare keep their old one, the first error is returned.
+func (db *DB) reconnect() error {
+	db.conn.SetMaxIdleConns(0)
+	db.conn.SetMaxIdleConns(maxIdleConns)
+
+	if err := db.conn.Ping(); err != nil {
+		return err
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	var firstErr error
+	var retired []*sql.Stmt
+	for _, statement := range db.statements {
+		stmt, err := db.conn.Prepare(statement.query)
+		if err != nil {
+			log.Errorln("Re-preparing "+statement.query+" failed", err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		retired = append(retired, statement.stmt)
+		statement.stmt = stmt
+	}
+
+	// Others may still be running the replaced ones
+	if len(retired) > 0 {
+		time.AfterFunc(retiredStmtGrace, func() {
+			for _, stmt := range retired {
+				stmt.Close()
+			}
+		})
+	}
+
+	log.Noteln("Reconnected to db, re-prepared", len(retired), "of", len(db.statements), "statements")
+	return firstErr
+}
+
+// Stmt returns the current prepared statement, e.g. for use in a transaction
+func (statement *Stmt) Stmt() *sql.Stmt {
+	statement.db.mutex.RLock()
+	defer statement.db.mutex.RUnlock()
+
+	return statement.stmt
+}
+
+// Exec executes the statement, retrying transient errors
+func (statement *Stmt) Exec(args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := statement.db.Retry(func() error {
+		var err error
+		result, err = statement.Stmt().Exec(args...)
+		return err
+	})
+	return result, err
+}
+
+// Query runs the statement, retrying transient errors
+func (statement *Stmt) Query(args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := statement.db.Retry(func() error {
+		var err error
+		rows, err = statement.Stmt().Query(args...)
+		return err
+	})
+	return rows, err
+}
+
+// Close closes the statement, it won't be re-prepared anymore
+func (statement *Stmt) Close() error {
+	statement.db.mutex.Lock()
+	defer statement.db.mutex.Unlock()
+
+	for i, other := range statement.db.statements {
+		if other == statement {
+			statement.db.statements = append(statement.db.statements[:i], statement.db.statements[i+1:]...)
+			break
+		}
+	}
+
+	return statement.stmt.Close()
+}
+
+// transientErrors are mysql errors that go away when retried. The statement
+// which failed with them was rolled back.
+var transientErrors = []string{
+	"Error 1205:", // Lock wait timeout exceeded
+	"Error 1213:", // Deadlock found when trying to get lock
+}
+
+// connectionErrors are what the driver returns when the connection is gone.
+// Apart from refused connections, the statement may have been applied before
+// the connection broke.
+var connectionErrors = []string{
+	"invalid connection",
+	"broken pipe",
+	"connection refused",
+	"connection reset",
+	"unexpected EOF",
+}
+
+// IsTransient tells whether an error may go away when retried, without the
+// failed call having applied anything
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// Returned by the driver before anything was sent
+	if err == driver.ErrBadConn || strings.Contains(err.Error(), "connection refused") {
+		return true
+	}
+
+	for _, prefix := range transientErrors {
+		if strings.HasPrefix(err.Error(), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isConnectionError(err error) bool {
+	if err == driver.ErrBadConn {
+		return true
+	}
+
+	for _, message := range connectionErrors {
+		if strings.Contains(err.Error(), message) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package lib_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+func newTestDB(t *testing.T) (*lib.DB, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Creating sqlmock failed: %s", err)
+	}
+
+	db := new(lib.DB)
+	db.New(conn, 0)
+	db.RetryDelay = 0
+
+	return db, mock
+}
+
+func TestDBRetriesDeadlocks(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	prepare := mock.ExpectPrepare("UPDATE games")
+	prepare.ExpectExec().WillReturnError(errors.New("Error 1213: Deadlock found when trying to get lock; try restarting transaction"))
+	prepare.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+
+	stmt, err := db.Prepare("UPDATE games")
+	if err != nil {
+		t.Fatalf("Preparing failed: %s", err)
+	}
+
+	if _, err := stmt.Exec(); err != nil {
+		t.Errorf("Exec after a deadlock was incorrect, got: %s, want: %v.", err, nil)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Database calls were incorrect: %s", err)
+	}
+}
+
+func TestDBDoesNotRetryOtherErrors(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	prepare := mock.ExpectPrepare("UPDATE games")
+	prepare.ExpectExec().WillReturnError(errors.New("Error 1062: Duplicate entry"))
+
+	stmt, _ := db.Prepare("UPDATE games")
+	if _, err := stmt.Exec(); err == nil {
+		t.Errorf("Exec was incorrect, got: %v, want: an error.", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Database calls were incorrect: %s", err)
+	}
+}
+
+func TestDBGivesUp(t *testing.T) {
+	db, mock := newTestDB(t)
+	db.Retries = 2
+
+	prepare := mock.ExpectPrepare("UPDATE games")
+	for i := 0; i <= db.Retries; i++ {
+		prepare.ExpectExec().WillReturnError(errors.New("Error 1205: Lock wait timeout exceeded; try restarting transaction"))
+	}
+
+	stmt, _ := db.Prepare("UPDATE games")
+	if _, err := stmt.Exec(); err == nil {
+		t.Errorf("Exec was incorrect, got: %v, want: an error.", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Database calls were incorrect: %s", err)
+	}
+}
+
+func TestDBReprepares(t *testing.T) {
+	conn, mock, err := sqlmock.NewWithDSN("reprepare")
+	if err != nil {
+		t.Fatalf("Creating sqlmock failed: %s", err)
+	}
+	defer conn.Close()
+
+	// sqlmock forgets a dsn once all its connections are closed, which
+	// reconnecting does with the idle ones
+	holder, _ := sql.Open("sqlmock", "reprepare")
+	holder.Ping()
+	defer holder.Close()
+
+	db := new(lib.DB)
+	db.New(conn, 0)
+	db.RetryDelay = 0
+
+	mock.ExpectPrepare("UPDATE games").ExpectExec().WillReturnError(errors.New("dial tcp 127.0.0.1:3306: connect: connection refused"))
+	mock.ExpectPrepare("UPDATE games").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+
+	stmt, _ := db.Prepare("UPDATE games")
+	if _, err := stmt.Exec(); err != nil {
+		t.Errorf("Exec after reconnecting was incorrect, got: %s, want: %v.", err, nil)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Database calls were incorrect: %s", err)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tables := []struct {
+		err       error
+		transient bool
+	}{
+		{nil, false},
+		{errors.New("Error 1213: Deadlock found when trying to get lock; try restarting transaction"), true},
+		{errors.New("Error 1205: Lock wait timeout exceeded; try restarting transaction"), true},
+		{driver.ErrBadConn, true},
+		{errors.New("dial tcp 127.0.0.1:3306: connect: connection refused"), true},
+		// The statement may have been applied before these
+		{errors.New("invalid connection"), false},
+		{errors.New("unexpected EOF"), false},
+		{errors.New("write tcp: broken pipe"), false},
+		{errors.New("sql: statement is closed"), false},
+		{errors.New("Error 1062: Duplicate entry '1' for key 'PRIMARY'"), false},
+	}
+
+	for _, table := range tables {
+		if transient := lib.IsTransient(table.err); transient != table.transient {
+			t.Errorf("IsTransient(%v) was incorrect, got: %t, want: %t.", table.err, transient, table.transient)
+		}
+	}
+}
+
+func TestDBDoesNotRetryAfterLostConnection(t *testing.T) {
+	db, _ := newTestDB(t)
+
+	calls := 0
+	err := db.Retry(func() error {
+		calls++
+		return errors.New("unexpected EOF")
+	})
+
+	if err == nil || calls != 1 {
+		t.Errorf("Retry after a lost connection was incorrect, got: %v after %d calls, want: an error after %d.", err, calls, 1)
+	}
+}
+
+func TestDBReprepareKeepsGoing(t *testing.T) {
+	conn, mock, err := sqlmock.NewWithDSN("reprepare-partial")
+	if err != nil {
+		t.Fatalf("Creating sqlmock failed: %s", err)
+	}
+	defer conn.Close()
+
+	holder, _ := sql.Open("sqlmock", "reprepare-partial")
+	holder.Ping()
+	defer holder.Close()
+
+	db := new(lib.DB)
+	db.New(conn, 0)
+	db.RetryDelay = 0
+
+	mock.ExpectPrepare("UPDATE games")
+	mock.ExpectPrepare("UPDATE heroes")
+	games, _ := db.Prepare("UPDATE games")
+	heroes, _ := db.Prepare("UPDATE heroes")
+	gamesBefore, heroesBefore := games.Stmt(), heroes.Stmt()
+
+	// The first statement fails to prepare, the second still gets prepared
+	mock.ExpectPrepare("UPDATE games").WillReturnError(errors.New("Error 1461: Can't create more than max_prepared_stmt_count statements"))
+	mock.ExpectPrepare("UPDATE heroes")
+
+	calls := 0
+	err = db.Retry(func() error {
+		calls++
+		if calls == 1 {
+			return errors.New("dial tcp 127.0.0.1:3306: connect: connection refused")
+		}
+		return nil
+	})
+
+	if err != nil || calls != 2 {
+		t.Errorf("Retry was incorrect, got: %v after %d calls, want: %v after %d.", err, calls, nil, 2)
+	}
+	if games.Stmt() != gamesBefore {
+		t.Errorf("Reconnect was incorrect, the statement which failed to prepare was replaced.")
+	}
+	if heroes.Stmt() == heroesBefore {
+		t.Errorf("Reconnect was incorrect, the statement after the failed one wasn't re-prepared.")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Database calls were incorrect: %s", err)
+	}
+}
+
+func TestDBCloseDoesNotBlock(t *testing.T) {
+	for _, pingInterval := range []time.Duration{0, time.Hour} {
+		conn, _, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Creating sqlmock failed: %s", err)
+		}
+
+		db := new(lib.DB)
+		db.New(conn, pingInterval)
+
+		closed := make(chan bool)
+		go func() {
+			db.Close()
+			db.Close()
+			closed <- true
+		}()
+
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Errorf("Close with ping interval %s was incorrect, it blocked.", pingInterval)
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,22 @@
+package lib
+
+import (
+	"github.com/go-redis/redis"
+)
+
+// NewRedisClient - connects to redis using the given logical database
+func NewRedisClient(addr string, password string, db int) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+
+	_, err := client.Ping().Result()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
@@ -0,0 +1,41 @@
+package lib_test
+
+import (
+	"testing"
+
+	"github.com/HeroesAwaken/GoFesl/lib"
+	"github.com/alicebob/miniredis"
+)
+
+func TestNewRedisClientSeparatesDatabases(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Starting miniredis failed: %s", err)
+	}
+	defer mr.Close()
+
+	shard1, err := lib.NewRedisClient(mr.Addr(), "", 1)
+	if err != nil {
+		t.Fatalf("NewRedisClient was incorrect, got error: %s", err)
+	}
+	shard2, err := lib.NewRedisClient(mr.Addr(), "", 2)
+	if err != nil {
+		t.Fatalf("NewRedisClient was incorrect, got error: %s", err)
+	}
+
+	gameServer1 := new(lib.RedisObject)
+	gameServer1.New(shard1, "gdata", "1")
+	gameServer1.Set("NAME", "shard1")
+
+	gameServer2 := new(lib.RedisObject)
+	gameServer2.New(shard2, "gdata", "1")
+
+	if name := gameServer2.Get("NAME"); name != "" {
+		t.Errorf("NewRedisClient was incorrect, shard 2 sees key of shard 1: %s", name)
+	}
+
+	gameServer2.Set("NAME", "shard2")
+	if name := gameServer1.Get("NAME"); name != "shard1" {
+		t.Errorf("NewRedisClient was incorrect, got: %s, want: %s.", name, "shard1")
+	}
+}
@@ -0,0 +1,47 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DefaultStatsTable holds the stats of all games without their own table
+const DefaultStatsTable = "game_stats"
+
+// StatsTables maps the clientString a game sends with Hello to the table
+// its hero stats are kept in
+type StatsTables map[string]string
+
+var tableNamePattern = regexp.MustCompile("^[A-Za-z0-9_]{1,64}$")
+
+// ParseStatsTables checks the table names of a StatsTables config, they
+// end up in queries as they are
+func ParseStatsTables(tables map[string]string) (StatsTables, error) {
+	for game, table := range tables {
+		if !tableNamePattern.MatchString(table) {
+			return nil, fmt.Errorf("invalid stats table %q for %s", table, game)
+		}
+	}
+	return StatsTables(tables), nil
+}
+
+// For returns the stats table of the game sending clientString
+func (tables StatsTables) For(clientString string) string {
+	if table, ok := tables[clientString]; ok {
+		return table
+	}
+	return DefaultStatsTable
+}
+
+// Tables returns every stats table, the default one first
+func (tables StatsTables) Tables() []string {
+	all := []string{DefaultStatsTable}
+	seen := map[string]bool{DefaultStatsTable: true}
+	for _, table := range tables {
+		if !seen[table] {
+			seen[table] = true
+			all = append(all, table)
+		}
+	}
+	return all
+}
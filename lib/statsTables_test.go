@@ -0,0 +1,30 @@
+package lib
+
+import "testing"
+
+func TestParseStatsTables(t *testing.T) {
+	if _, err := ParseStatsTables(map[string]string{"game-a": "game_a_stats"}); err != nil {
+		t.Errorf("ParseStatsTables was incorrect, got error: %s.", err)
+	}
+	if _, err := ParseStatsTables(map[string]string{"game-a": "stats; DROP TABLE users"}); err == nil {
+		t.Errorf("ParseStatsTables was incorrect, accepted an invalid table name.")
+	}
+}
+
+func TestStatsTablesFor(t *testing.T) {
+	tables := StatsTables{"game-a": "game_a_stats", "game-b": "game_a_stats"}
+
+	if table := tables.For("game-a"); table != "game_a_stats" {
+		t.Errorf("For was incorrect, got: %s, want: %s.", table, "game_a_stats")
+	}
+	if table := tables.For("game-c"); table != DefaultStatsTable {
+		t.Errorf("For was incorrect, got: %s, want: %s.", table, DefaultStatsTable)
+	}
+	if table := StatsTables(nil).For("game-a"); table != DefaultStatsTable {
+		t.Errorf("For was incorrect, got: %s, want: %s.", table, DefaultStatsTable)
+	}
+
+	if all := tables.Tables(); len(all) != 2 || all[0] != DefaultStatsTable || all[1] != "game_a_stats" {
+		t.Errorf("Tables was incorrect, got: %v, want: %v.", all, []string{DefaultStatsTable, "game_a_stats"})
+	}
+}
@@ -0,0 +1,50 @@
+package lib
+
+import "sync"
+
+// StmtCache holds statements whose query depends on an amount of keys, like
+// the IN (?, ?, ...) of a stats lookup. Each amount gets prepared the first
+// time it's asked for and reused afterwards. The statements belong to a DB,
+// so they're re-prepared when it reconnects.
+type StmtCache struct {
+	db         *DB
+	query      func(keys int) string
+	statements map[int]*Stmt
+	mutex      sync.Mutex
+}
+
+// New - caches the statements of query on db
+func (cache *StmtCache) New(db *DB, query func(keys int) string) {
+	cache.db = db
+	cache.query = query
+	cache.statements = make(map[int]*Stmt)
+}
+
+// Get returns the statement for an amount of keys, preparing it if needed
+func (cache *StmtCache) Get(keys int) (*Stmt, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if statement, ok := cache.statements[keys]; ok {
+		return statement, nil
+	}
+
+	statement, err := cache.db.Prepare(cache.query(keys))
+	if err != nil {
+		return nil, err
+	}
+
+	cache.statements[keys] = statement
+	return statement, nil
+}
+
+// Close closes all statements prepared so far
+func (cache *StmtCache) Close() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	for keys, statement := range cache.statements {
+		statement.Close()
+		delete(cache.statements, keys)
+	}
+}
@@ -0,0 +1,78 @@
+package lib_test
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+func keysQuery(keys int) string {
+	return "SELECT stats FOR " + strconv.Itoa(keys) + " KEYS"
+}
+
+func TestStmtCachePreparesEachAmountOnce(t *testing.T) {
+	db, mock := newTestDB(t)
+
+	for _, keys := range []int{1, 4, 7} {
+		mock.ExpectPrepare("FOR " + strconv.Itoa(keys) + " KEYS")
+	}
+
+	cache := new(lib.StmtCache)
+	cache.New(db, keysQuery)
+
+	statements := make(map[int]*lib.Stmt)
+	for i := 0; i < 3; i++ {
+		for _, keys := range []int{1, 4, 7} {
+			statement, err := cache.Get(keys)
+			if err != nil {
+				t.Fatalf("Get for %d keys was incorrect, got error: %s.", keys, err)
+			}
+			if previous, ok := statements[keys]; ok && previous != statement {
+				t.Errorf("Get for %d keys was incorrect, got a new statement instead of the cached one.", keys)
+			}
+			statements[keys] = statement
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Database calls were incorrect: %s", err)
+	}
+}
+
+func TestStmtCacheRepreparesOnReconnect(t *testing.T) {
+	conn, mock, err := sqlmock.NewWithDSN("stmtcache")
+	if err != nil {
+		t.Fatalf("Creating sqlmock failed: %s", err)
+	}
+	defer conn.Close()
+
+	// See TestDBReprepares
+	holder, _ := sql.Open("sqlmock", "stmtcache")
+	holder.Ping()
+	defer holder.Close()
+
+	db := new(lib.DB)
+	db.New(conn, 0)
+	db.RetryDelay = 0
+
+	cache := new(lib.StmtCache)
+	cache.New(db, keysQuery)
+
+	mock.ExpectPrepare("FOR 2 KEYS").ExpectExec().WillReturnError(errors.New("dial tcp 127.0.0.1:3306: connect: connection refused"))
+	mock.ExpectPrepare("FOR 2 KEYS").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+
+	statement, _ := cache.Get(2)
+	if _, err := statement.Exec(); err != nil {
+		t.Errorf("Exec after reconnecting was incorrect, got: %s, want: %v.", err, nil)
+	}
+	if again, _ := cache.Get(2); again != statement {
+		t.Errorf("Get after reconnecting was incorrect, got a new statement instead of the cached one.")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Database calls were incorrect: %s", err)
+	}
+}
@@ -3,12 +3,14 @@ package log
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -35,19 +37,134 @@ var (
 	maxLine       = 1
 )
 
-func SetLevel(level string) {
-	switch strings.ToLower(level) {
+// SetLevel sets what gets logged. Besides a level like "note" it takes
+// levels per subsystem, e.g. "warning,theater=debug,db=error". Subsystems are
+// the packages, db being the lib package. Nothing changes if any of the
+// levels is unknown.
+func SetLevel(level string) error {
+	levels := make(map[string]Flag)
+	defaultLevel := ErrorFlag
+
+	for _, part := range strings.Split(level, ",") {
+		if tag := strings.SplitN(part, "=", 2); len(tag) == 2 {
+			flag, err := ParseLevel(tag[1])
+			if err != nil {
+				return err
+			}
+			levels[strings.TrimSpace(tag[0])] = flag
+			continue
+		}
+
+		flag, err := ParseLevel(part)
+		if err != nil {
+			return err
+		}
+		defaultLevel = flag
+	}
+
+	levelMutex.Lock()
+	LogFlag = defaultLevel
+	tagLevels = levels
+	levelMutex.Unlock()
+	return nil
+}
+
+// ParseLevel returns the level of a name
+func ParseLevel(level string) (Flag, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
 	case "debug":
-		LogFlag = DebugFlag
+		return DebugFlag, nil
 	case "note":
-		LogFlag = NoteFlag
+		return NoteFlag, nil
 	case "warning":
-		LogFlag = WarningFlag
+		return WarningFlag, nil
 	case "error":
-		LogFlag = ErrorFlag
+		return ErrorFlag, nil
 	default:
-		LogFlag = ErrorFlag
+		return ErrorFlag, fmt.Errorf("unknown log level %q", level)
+	}
+}
+
+// packageTags are the subsystems of packages not named like them
+var packageTags = map[string]string{
+	"lib": "db",
+}
+
+var (
+	levelMutex sync.RWMutex
+	tagLevels  map[string]Flag
+)
+
+// enabled tells whether a message at flag gets logged for the caller of the
+// logging function calling it
+func enabled(flag Flag) bool {
+	levelMutex.RLock()
+	defer levelMutex.RUnlock()
+
+	if len(tagLevels) > 0 {
+		if level, ok := tagLevels[callerTag(3)]; ok {
+			return level <= flag
+		}
 	}
+	return LogFlag <= flag
+}
+
+// callerTag returns the subsystem of the function skip frames up
+func callerTag(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip)
+	if !ok {
+		return ""
+	}
+	f := runtime.FuncForPC(pc)
+	if f == nil {
+		return ""
+	}
+
+	name := f.Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+
+	if tag, ok := packageTags[name]; ok {
+		return tag
+	}
+	return name
+}
+
+var (
+	outputMutex sync.RWMutex
+	stdout      io.Writer = os.Stdout
+	stderr      io.Writer = os.Stderr
+)
+
+// SetFile additionally logs into a file at path, which is rotated once it
+// grows past maxSize bytes. Rotated files older than maxAge are removed, 0
+// disables either limit.
+func SetFile(path string, maxSize int64, maxAge time.Duration) error {
+	file, err := OpenRotatingFile(path, maxSize, maxAge)
+	if err != nil {
+		return err
+	}
+
+	outputMutex.Lock()
+	stdout = io.MultiWriter(os.Stdout, file)
+	stderr = io.MultiWriter(os.Stderr, file)
+	outputMutex.Unlock()
+
+	return nil
+}
+
+func output() io.Writer {
+	outputMutex.RLock()
+	defer outputMutex.RUnlock()
+	return stdout
+}
+
+func errOutput() io.Writer {
+	outputMutex.RLock()
+	defer outputMutex.RUnlock()
+	return stderr
 }
 
 func leftPad2Len(s string, padStr string, overallLen int) string {
@@ -105,43 +222,43 @@ func prepareLog(raw string) string {
 }
 
 func Error(args ...interface{}) {
-	if LogFlag <= ErrorFlag {
+	if enabled(ErrorFlag) {
 		args = append([]interface{}{prepareLog(ErrorFormat)}, args...)
 		args = append(args, "\033[0m")
-		fmt.Fprint(os.Stderr, args...)
+		fmt.Fprint(errOutput(), args...)
 	}
 }
 
 func Errorf(format string, args ...interface{}) {
-	if LogFlag <= ErrorFlag {
+	if enabled(ErrorFlag) {
 		var buffer bytes.Buffer
 		buffer.WriteString("%s ")
 		buffer.WriteString(format)
 
 		args = append([]interface{}{prepareLog(ErrorFormat)}, args...)
 		args = append(args, "\033[0m\n")
-		fmt.Fprintf(os.Stderr, buffer.String(), args...)
+		fmt.Fprintf(errOutput(), buffer.String(), args...)
 	}
 }
 
 func Errorln(args ...interface{}) {
-	if LogFlag <= ErrorFlag {
+	if enabled(ErrorFlag) {
 		args = append([]interface{}{prepareLog(ErrorFormat)}, args...)
 		args = append(args, "\033[0m")
-		fmt.Fprintln(os.Stderr, args...)
+		fmt.Fprintln(errOutput(), args...)
 	}
 }
 
 func Warning(args ...interface{}) {
-	if LogFlag <= WarningFlag {
+	if enabled(WarningFlag) {
 		args = append([]interface{}{prepareLog(WarningFormat)}, args...)
 		args = append(args, "\033[0m")
-		fmt.Fprint(os.Stderr, args...)
+		fmt.Fprint(errOutput(), args...)
 	}
 }
 
 func Warningf(format string, args ...interface{}) {
-	if LogFlag <= WarningFlag {
+	if enabled(WarningFlag) {
 		var buffer bytes.Buffer
 		buffer.WriteString("%s ")
 		buffer.WriteString(format)
@@ -149,28 +266,28 @@ func Warningf(format string, args ...interface{}) {
 
 		args = append([]interface{}{prepareLog(WarningFormat)}, args...)
 		args = append(args, "\033[0m\n")
-		fmt.Fprintf(os.Stderr, buffer.String(), args...)
+		fmt.Fprintf(errOutput(), buffer.String(), args...)
 	}
 }
 
 func Warningln(args ...interface{}) {
-	if LogFlag <= WarningFlag {
+	if enabled(WarningFlag) {
 		args = append([]interface{}{prepareLog(WarningFormat)}, args...)
 		args = append(args, "\033[0m")
-		fmt.Fprintln(os.Stderr, args...)
+		fmt.Fprintln(errOutput(), args...)
 	}
 }
 
 func Note(args ...interface{}) {
-	if LogFlag <= NoteFlag {
+	if enabled(NoteFlag) {
 		args = append([]interface{}{prepareLog(NoteFormat)}, args...)
 		args = append(args, "\033[0m")
-		fmt.Print(args...)
+		fmt.Fprint(output(), args...)
 	}
 }
 
 func Notef(format string, args ...interface{}) {
-	if LogFlag <= NoteFlag {
+	if enabled(NoteFlag) {
 		var buffer bytes.Buffer
 		buffer.WriteString("%s ")
 		buffer.WriteString(format)
@@ -178,28 +295,28 @@ func Notef(format string, args ...interface{}) {
 
 		args = append([]interface{}{prepareLog(NoteFormat)}, args...)
 		args = append(args, "\033[0m\n")
-		fmt.Printf(buffer.String(), args...)
+		fmt.Fprintf(output(), buffer.String(), args...)
 	}
 }
 
 func Noteln(args ...interface{}) {
-	if LogFlag <= NoteFlag {
+	if enabled(NoteFlag) {
 		args = append([]interface{}{prepareLog(NoteFormat)}, args...)
 		args = append(args, "\033[0m")
-		fmt.Println(args...)
+		fmt.Fprintln(output(), args...)
 	}
 }
 
 func Debug(args ...interface{}) {
-	if LogFlag <= NoteFlag {
+	if enabled(DebugFlag) {
 		args = append([]interface{}{prepareLog(DebugFormat)}, args...)
 		args = append(args, "\033[0m")
-		fmt.Print(args...)
+		fmt.Fprint(output(), args...)
 	}
 }
 
 func Debugf(format string, args ...interface{}) {
-	if LogFlag <= DebugFlag {
+	if enabled(DebugFlag) {
 		var buffer bytes.Buffer
 		buffer.WriteString("%s ")
 		buffer.WriteString(format)
@@ -207,22 +324,22 @@ func Debugf(format string, args ...interface{}) {
 
 		args = append([]interface{}{prepareLog(DebugFormat)}, args...)
 		args = append(args, "\033[0m\n")
-		fmt.Printf(buffer.String(), args...)
+		fmt.Fprintf(output(), buffer.String(), args...)
 	}
 }
 
 func Debugln(args ...interface{}) {
-	if LogFlag <= DebugFlag {
+	if enabled(DebugFlag) {
 		args = append([]interface{}{prepareLog(DebugFormat)}, args...)
 		args = append(args, "\033[0m")
-		fmt.Println(args...)
+		fmt.Fprintln(output(), args...)
 	}
 }
 
 func Fatal(args ...interface{}) {
 	args = append([]interface{}{prepareLog(FatalFormat)}, args...)
 	args = append(args, "\033[0m")
-	fmt.Print(args...)
+	fmt.Fprint(output(), args...)
 	os.Exit(1)
 }
 
@@ -234,21 +351,21 @@ func Fatalf(format string, args ...interface{}) {
 
 	args = append([]interface{}{prepareLog(FatalFormat)}, args...)
 	args = append(args, "\033[0m\n")
-	fmt.Printf(buffer.String(), args...)
+	fmt.Fprintf(output(), buffer.String(), args...)
 	os.Exit(1)
 }
 
 func Fatalln(args ...interface{}) {
 	args = append([]interface{}{prepareLog(FatalFormat)}, args...)
 	args = append(args, "\033[0m")
-	fmt.Println(args...)
+	fmt.Fprintln(output(), args...)
 	os.Exit(1)
 }
 
 func Panic(args ...interface{}) {
 	args = append([]interface{}{prepareLog(PanicFormat)}, args...)
 	args = append(args, "\033[0m")
-	fmt.Print(args...)
+	fmt.Fprint(output(), args...)
 	panic(fmt.Sprintf("%v", args))
 }
 
@@ -260,13 +377,13 @@ func Panicf(format string, args ...interface{}) {
 
 	args = append([]interface{}{prepareLog(PanicFormat)}, args...)
 	args = append(args, "\033[0m\n")
-	fmt.Printf(buffer.String(), args...)
+	fmt.Fprintf(output(), buffer.String(), args...)
 	panic(fmt.Sprintf("%v", args))
 }
 
 func Panicln(args ...interface{}) {
 	args = append([]interface{}{prepareLog(PanicFormat)}, args...)
 	args = append(args, "\033[0m")
-	fmt.Println(args...)
+	fmt.Fprintln(output(), args...)
 	panic(fmt.Sprintf("%v", args))
 }
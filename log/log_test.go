@@ -0,0 +1,113 @@
+package log
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// logs is called like the logging functions call enabled
+func logs(flag Flag) bool {
+	return enabled(flag)
+}
+
+func TestSetLevel(t *testing.T) {
+	defer SetLevel("error")
+
+	SetLevel("warning,log=debug,db=error")
+
+	if LogFlag != WarningFlag {
+		t.Errorf("SetLevel default was incorrect, got: %d, want: %d.", LogFlag, WarningFlag)
+	}
+	// This package is tagged log, so its debug messages are let through
+	if !logs(DebugFlag) {
+		t.Errorf("SetLevel for tag log was incorrect, debug isn't enabled.")
+	}
+
+	SetLevel("note")
+	if logs(DebugFlag) || !logs(NoteFlag) {
+		t.Errorf("SetLevel was incorrect, got: %d, want: %d.", LogFlag, NoteFlag)
+	}
+
+	// Typos don't quietly turn logging down
+	for _, level := range []string{"notice", "warning,theater=verbose", ""} {
+		if err := SetLevel(level); err == nil {
+			t.Errorf("SetLevel(%q) was incorrect, got no error.", level)
+		}
+		if LogFlag != NoteFlag {
+			t.Errorf("SetLevel(%q) was incorrect, changed the level to %d.", level, LogFlag)
+		}
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatalf("Creating temp dir failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "gofesl.log")
+
+	// Left over from an earlier rotation, long expired
+	expired := path + ".20000101-000000.000000"
+	ioutil.WriteFile(expired, []byte("old\n"), 0644)
+	old := time.Now().Add(-time.Hour * 48)
+	os.Chtimes(expired, old, old)
+
+	file, err := OpenRotatingFile(path, 16, time.Hour*24)
+	if err != nil {
+		t.Fatalf("Opening rotating file failed: %s", err)
+	}
+	defer file.Close()
+
+	file.Write([]byte("\033[31mERROR first\033[0m\n"))
+	file.Write([]byte("second line\n"))
+
+	content, _ := ioutil.ReadFile(path)
+	if string(content) != "second line\n" {
+		t.Errorf("RotatingFile content was incorrect, got: %q, want: %q.", content, "second line\n")
+	}
+
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 1 {
+		t.Fatalf("RotatingFile rotated files were incorrect, got: %v, want one.", rotated)
+	}
+	if content, _ := ioutil.ReadFile(rotated[0]); !strings.HasPrefix(string(content), "ERROR first") {
+		t.Errorf("RotatingFile rotated content was incorrect, got: %q.", content)
+	}
+}
+
+func TestRotatingFileFailedRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log")
+	if err != nil {
+		t.Fatalf("Creating temp dir failed: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "gofesl.log")
+
+	file, err := OpenRotatingFile(path, 16, 0)
+	if err != nil {
+		t.Fatalf("Opening rotating file failed: %s", err)
+	}
+	defer file.Close()
+
+	file.Write([]byte("first line\n"))
+
+	// Gone from under us, so it can't be moved aside
+	os.Remove(path)
+
+	if _, err := file.Write([]byte("second line\n")); err != nil {
+		t.Fatalf("RotatingFile was incorrect, got error: %s.", err)
+	}
+	file.Write([]byte("3\n"))
+
+	content, _ := ioutil.ReadFile(path)
+	if string(content) != "second line\n3\n" {
+		t.Errorf("RotatingFile content was incorrect, got: %q, want: %q.", content, "second line\n3\n")
+	}
+}
@@ -0,0 +1,127 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// colors are the terminal escapes of the formats, they don't belong in files
+var colors = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// RotatingFile is a log file which gets rotated once it grows past maxSize.
+// Rotated files older than maxAge are removed.
+type RotatingFile struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+// OpenRotatingFile opens or creates the log file at path, 0 disables either
+// limit
+func OpenRotatingFile(path string, maxSize int64, maxAge time.Duration) (*RotatingFile, error) {
+	file := &RotatingFile{path: path, maxSize: maxSize, maxAge: maxAge}
+	if err := file.open(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (f *RotatingFile) open() error {
+	return f.openPath(f.path)
+}
+
+// openPath makes the file at path the current one
+func (f *RotatingFile) openPath(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write writes p without its colors, rotating the file first if p doesn't
+// fit anymore
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	plain := colors.ReplaceAll(p, nil)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(plain)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(plain)
+	f.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the current file
+func (f *RotatingFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.file.Close()
+}
+
+// rotate moves the current file aside and starts a new one. If that fails
+// the original file is opened again, so logging goes on and the next write
+// tries rotating again.
+func (f *RotatingFile) rotate() error {
+	f.file.Close()
+
+	rotated := f.path + "." + time.Now().Format("20060102-150405.000000")
+	if err := os.Rename(f.path, rotated); err != nil {
+		fmt.Fprintln(os.Stderr, "Rotating log file failed:", err)
+		return f.open()
+	}
+
+	f.removeExpired()
+
+	if err := f.open(); err != nil {
+		fmt.Fprintln(os.Stderr, "Opening new log file failed:", err)
+		return f.openPath(rotated)
+	}
+	return nil
+}
+
+// removeExpired removes rotated files older than maxAge
+func (f *RotatingFile) removeExpired() {
+	if f.maxAge <= 0 {
+		return
+	}
+
+	rotated, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return
+	}
+
+	for _, path := range rotated {
+		info, err := os.Stat(path)
+		if err == nil && time.Since(info.ModTime()) > f.maxAge {
+			os.Remove(path)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http/httputil"
 	"os"
 	"os/signal"
+	"regexp"
 	"runtime"
 	"strings"
 	"time"
@@ -14,10 +15,11 @@ import (
 	"github.com/HeroesAwaken/GoAwaken/core"
 	"github.com/HeroesAwaken/GoFesl/GameSpy"
 	"github.com/HeroesAwaken/GoFesl/fesl"
+	"github.com/HeroesAwaken/GoFesl/lib"
 	"github.com/HeroesAwaken/GoFesl/log"
 	"github.com/HeroesAwaken/GoFesl/matchmaking"
+	"github.com/HeroesAwaken/GoFesl/metrics"
 	"github.com/HeroesAwaken/GoFesl/theater"
-	"github.com/go-redis/redis"
 	"github.com/gorilla/mux"
 
 	"net/http"
@@ -27,27 +29,45 @@ import (
 // Initialize flag-parameters and config
 func init() {
 	flag.StringVar(&configPath, "config", "config.yml", "Path to yml configuration file")
-	flag.StringVar(&logLevel, "logLevel", "error", "LogLevel [error|warning|note|debug]")
+	flag.StringVar(&logLevel, "logLevel", "error", "LogLevel [error|warning|note|debug], optionally per subsystem, e.g. warning,theater=debug")
 	flag.StringVar(&certFileFlag, "cert", "cert.pem", "[HTTPS] Location of your certification file. Env: LOUIS_HTTPS_CERT")
 	flag.StringVar(&keyFileFlag, "key", "key.pem", "[HTTPS] Location of your private key file. Env: LOUIS_HTTPS_KEY")
+	flag.StringVar(&caFileFlag, "ca", "", "[FESL] Optional CA used to verify client certificates")
+	flag.StringVar(&tlsMinVersionFlag, "tlsMinVersion", "tls10", "[FESL] Minimum TLS version [tls10|tls11|tls12]")
+	flag.StringVar(&adminAddrFlag, "adminAddr", "", "Address to serve the admin endpoint on, e.g. 127.0.0.1:9101. Disabled if empty")
+	flag.StringVar(&metricsAddrFlag, "metricsAddr", "", "Address to serve prometheus metrics on, e.g. :9100. Disabled if empty")
 	flag.BoolVar(&localMode, "localMode", false, "Use in local modus")
 
 	flag.Parse()
 
-	log.SetLevel(logLevel)
+	if err := log.SetLevel(logLevel); err != nil {
+		log.Fatalln("Invalid logLevel:", err)
+	}
 	MyConfig.Load(configPath)
 
+	if MyConfig.LogFile != "" {
+		// LogFileMaxSize is in MB, LogFileMaxAge in days
+		err := log.SetFile(MyConfig.LogFile, MyConfig.LogFileMaxSize*1024*1024, time.Duration(MyConfig.LogFileMaxAge)*time.Hour*24)
+		if err != nil {
+			log.Fatalln("Error opening log file:", err)
+		}
+	}
+
 	if CompileVersion != "0" {
 		Version = Version + "." + CompileVersion
 	}
 }
 
 var (
-	configPath   string
-	logLevel     string
-	certFileFlag string
-	keyFileFlag  string
-	localMode    bool
+	configPath        string
+	logLevel          string
+	certFileFlag      string
+	keyFileFlag       string
+	caFileFlag        string
+	tlsMinVersionFlag string
+	metricsAddrFlag   string
+	adminAddrFlag     string
+	localMode         bool
 
 	// CompileVersion we are receiving by the build command
 	CompileVersion = "0"
@@ -69,15 +89,21 @@ var (
 	Shard string
 )
 
+// Ports of the theaters of clients and game servers
+const (
+	clientTheaterPort = "18275"
+	serverTheaterPort = "18056"
+)
+
 func emtpyHandler(w http.ResponseWriter, r *http.Request) {
-	log.Noteln("EMTPTY", r.URL.Path)
+	log.Debugln("EMTPTY", r.URL.Path)
 	LogMagmaRequest(r, "requestEmtpy")
 
 	fmt.Fprintf(w, "<update><status>Online</status></update>")
 }
 
 func relationship(w http.ResponseWriter, r *http.Request) {
-	log.Noteln("RELATIONSHIP", r.URL.Path)
+	log.Debugln("RELATIONSHIP", r.URL.Path)
 	LogMagmaRequest(r, "requestRelationship")
 
 	vars := mux.Vars(r)
@@ -93,13 +119,13 @@ func sessionHandler(w http.ResponseWriter, r *http.Request) {
 		userKey, err := r.Cookie("magma")
 		if err != nil {
 		}
-		log.Noteln("<success><token code=\"NEW_TOKEN\">" + userKey.Value + "</token></success>")
+		log.Debugln("<success><token code=\"NEW_TOKEN\">" + userKey.Value + "</token></success>")
 		fmt.Fprintf(w, "<success><token code=\"NEW_TOKEN\">"+userKey.Value+"</token></success>")
 	}
 }
 
 func entitlementsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Noteln("ENTITLEMENTS", r.URL.Path)
+	log.Debugln("ENTITLEMENTS", r.URL.Path)
 	LogMagmaRequest(r, "requestEntitlements")
 
 	vars := mux.Vars(r)
@@ -122,7 +148,7 @@ func entitlementsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func offersHandler(w http.ResponseWriter, r *http.Request) {
-	log.Noteln("OFFERS", r.URL.Path)
+	log.Debugln("OFFERS", r.URL.Path)
 	LogMagmaRequest(r, "requestOffers")
 
 	contents, _ := ioutil.ReadFile("api/products.xml")
@@ -131,7 +157,7 @@ func offersHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func walletsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Noteln("WALLETS", r.URL.Path)
+	log.Debugln("WALLETS", r.URL.Path)
 	LogMagmaRequest(r, "requestWallets")
 	//vars := mux.Vars(r)
 	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"yes\" ?><billingAccounts><walletAccount><currency>hp</currency><balance>1</balance></billingAccounts>")
@@ -212,13 +238,8 @@ func main() {
 		log.Fatalln("Error connecting to DB:", err)
 	}
 
-	// Redis Connection
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     MyConfig.RedisServer,
-		Password: MyConfig.RedisPassword,
-		DB:       MyConfig.RedisDB,
-	})
-	_, err = redisClient.Ping().Result()
+	// Redis Connection, shards sharing a redis server select their own db
+	redisClient, err := lib.NewRedisClient(MyConfig.RedisServer, MyConfig.RedisPassword, MyConfig.RedisDB)
 	if err != nil {
 		log.Fatalln("Error connecting to redis:", err)
 	}
@@ -230,6 +251,12 @@ func main() {
 		log.Fatalln("Error connecting to MetricsDB:", err)
 	}
 
+	metricsServer := new(metrics.Server)
+	err = metricsServer.New(metricsAddrFlag)
+	if err != nil {
+		log.Fatalln("Error serving metrics:", err)
+	}
+
 	globalMetrics := time.NewTicker(time.Second * 10)
 	go func() {
 		for range globalMetrics.C {
@@ -241,22 +268,158 @@ func main() {
 	log.Noteln("Starting up as shard: " + Shard)
 	matchmaking.Shard = Shard
 	theater.Shard = Shard
+	theater.ShardNetworks, err = theater.ParseShardNetworks(MyConfig.ShardNetworks)
+	if err != nil {
+		log.Fatalln("Invalid ShardNetworks:", err)
+	}
 	fesl.Shard = Shard
+	fesl.StatsTables, err = lib.ParseStatsTables(MyConfig.StatsTables)
+	if err != nil {
+		log.Fatalln("Invalid StatsTables:", err)
+	}
+	theater.StatsTables = fesl.StatsTables
+
+	theaterConfig := theater.DefaultConfig()
+	theaterConfig.PublicIP = MyConfig.PublicIP
+	if MyConfig.DataCenter != "" {
+		theaterConfig.DataCenter = MyConfig.DataCenter
+	}
+	if MyConfig.ActivityTimeout > 0 {
+		theaterConfig.ActivityTimeout = time.Duration(MyConfig.ActivityTimeout) * time.Second
+	}
+	if MyConfig.JoinTimeout > 0 {
+		theaterConfig.JoinTimeout = time.Duration(MyConfig.JoinTimeout) * time.Second
+	}
+	theaterConfig.IdleTimeout = time.Duration(MyConfig.IdleTimeout) * time.Second
+	theaterConfig.AnswerPing = MyConfig.AnswerPing
+	if len(MyConfig.Lobbies) > 0 {
+		theaterConfig.Lobbies = MyConfig.Lobbies
+	}
+	if MyConfig.MaxLobbies > 0 {
+		theaterConfig.MaxLobbies = MyConfig.MaxLobbies
+	}
+	theaterConfig.AllowCrossLobbyJoins = MyConfig.AllowCrossLobbyJoins
+	if MyConfig.ServerNamePolicy != "" {
+		theaterConfig.ServerNamePolicy = MyConfig.ServerNamePolicy
+	}
+	if MyConfig.MaxConcurrentScans > 0 {
+		theaterConfig.MaxConcurrentScans = MyConfig.MaxConcurrentScans
+	}
+	if MyConfig.CommandsPerSecond > 0 {
+		theaterConfig.CommandsPerSecond = MyConfig.CommandsPerSecond
+	}
+	if MyConfig.CommandBurst > 0 {
+		theaterConfig.CommandBurst = MyConfig.CommandBurst
+	}
+	if MyConfig.ServerCommandsPerSecond > 0 {
+		theaterConfig.ServerCommandsPerSecond = MyConfig.ServerCommandsPerSecond
+	}
+	if MyConfig.ServerCommandBurst > 0 {
+		theaterConfig.ServerCommandBurst = MyConfig.ServerCommandBurst
+	}
+	theaterConfig.AnswerRateLimited = MyConfig.AnswerRateLimited
+	theaterConfig.ResolveHostnames = MyConfig.ResolveHostnames
+	if MyConfig.Platform != "" {
+		theaterConfig.Platform = MyConfig.Platform
+	}
+	if MyConfig.PlatformNames != nil {
+		theaterConfig.PlatformNames, err = theater.ParsePlatformNames(MyConfig.PlatformNames)
+		if err != nil {
+			log.Fatalln("Invalid PlatformNames:", err)
+		}
+	}
+	if MyConfig.MapDisplayNames != nil {
+		theaterConfig.MapDisplayNames = MyConfig.MapDisplayNames
+	}
+	if MyConfig.FallbackNickname != "" {
+		theaterConfig.FallbackNickname = MyConfig.FallbackNickname
+	}
+	if MyConfig.Ticket != "" {
+		theaterConfig.Ticket = MyConfig.Ticket
+	}
+	if MyConfig.EncryptionKey != "" {
+		theaterConfig.EncryptionKey = MyConfig.EncryptionKey
+	}
+	if MyConfig.Secret != "" {
+		theaterConfig.Secret = MyConfig.Secret
+	}
+	if MyConfig.HostUserID != "" {
+		theaterConfig.HostUserID = MyConfig.HostUserID
+	}
+	if MyConfig.XUID != "" {
+		theaterConfig.XUID = MyConfig.XUID
+	}
+	theaterConfig.WarmGetStatsKeys = MyConfig.WarmGetStatsKeys
+	theaterConfig.WarmServerStatsKeys = MyConfig.WarmServerStatsKeys
+	if err := theaterConfig.Validate(); err != nil {
+		log.Fatalln("Invalid theater config:", err)
+	}
+
+	feslConfig := fesl.DefaultConfig()
+	if MyConfig.TheaterHost != "" {
+		feslConfig.TheaterHost = MyConfig.TheaterHost
+	}
+	if MyConfig.MessengerHost != "" {
+		feslConfig.MessengerHost = MyConfig.MessengerHost
+	}
+	if MyConfig.MessengerPort != "" {
+		feslConfig.MessengerPort = MyConfig.MessengerPort
+	}
+	feslConfig.ActivityTimeout = theaterConfig.ActivityTimeout
+	feslConfig.HelloTime = MyConfig.HelloTime
+	if MyConfig.OwnerPattern != "" {
+		feslConfig.OwnerPattern, err = regexp.Compile(MyConfig.OwnerPattern)
+		if err != nil {
+			log.Fatalln("Invalid OwnerPattern:", err)
+		}
+	}
+	if MyConfig.MinPasswordLength > 0 {
+		feslConfig.MinPasswordLength = MyConfig.MinPasswordLength
+	}
+
+	// Each FESL sends its clients to the matching theater
+	clientFeslConfig, serverFeslConfig := feslConfig, feslConfig
+	clientFeslConfig.TheaterPort = clientTheaterPort
+	serverFeslConfig.TheaterPort = serverTheaterPort
+	for _, config := range []fesl.Config{clientFeslConfig, serverFeslConfig} {
+		if err := config.Validate(); err != nil {
+			log.Fatalln("Invalid FESL config:", err)
+		}
+	}
+
+	tlsMinVersion, err := GameSpy.ParseTLSVersion(tlsMinVersionFlag)
+	if err != nil {
+		log.Fatalln("Invalid tlsMinVersion:", err)
+	}
 
 	feslManager := new(fesl.FeslManager)
-	feslManager.New("FM", "18270", certFileFlag, keyFileFlag, false, dbSQL, redisClient, metricConnection, localMode)
+	err = feslManager.New("FM", "18270", certFileFlag, keyFileFlag, caFileFlag, tlsMinVersion, false, clientFeslConfig, dbSQL, redisClient, metricConnection, localMode)
+	if err != nil {
+		log.Fatalln("Error starting FESL:", err)
+	}
 	serverManager := new(fesl.FeslManager)
-	serverManager.New("SFM", "18051", certFileFlag, keyFileFlag, true, dbSQL, redisClient, metricConnection, localMode)
+	err = serverManager.New("SFM", "18051", certFileFlag, keyFileFlag, caFileFlag, tlsMinVersion, true, serverFeslConfig, dbSQL, redisClient, metricConnection, localMode)
+	if err != nil {
+		log.Fatalln("Error starting server FESL:", err)
+	}
 
 	theaterManager := new(theater.TheaterManager)
-	theaterManager.New("TM", "18275", dbSQL, redisClient, metricConnection, localMode)
+	theaterManager.New("TM", clientTheaterPort, theaterConfig, dbSQL, redisClient, metricConnection, localMode)
 	servertheaterManager := new(theater.TheaterManager)
-	servertheaterManager.New("STM", "18056", dbSQL, redisClient, metricConnection, localMode)
+	servertheaterManager.New("STM", serverTheaterPort, theaterConfig, dbSQL, redisClient, metricConnection, localMode)
+
+	adminServer := new(theater.Admin)
+	err = adminServer.New(adminAddrFlag, MyConfig.AdminSecret, theaterManager, servertheaterManager)
+	if err != nil {
+		log.Fatalln("Error serving admin endpoint:", err)
+	}
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	for sig := range c {
 		log.Noteln("Captured" + sig.String() + ". Shutting down.")
+		theaterManager.Stop()
+		servertheaterManager.Stop()
 		os.Exit(0)
 	}
 }
@@ -5,13 +5,78 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/HeroesAwaken/GoFesl/GameSpy"
 	"github.com/HeroesAwaken/GoFesl/log"
 )
 
-// Games - a list of available games
-var Games = make(map[string]*GameSpy.Client)
+// games - the connected game servers by the key of their game
+var (
+	games      = make(map[string]*GameSpy.Client)
+	gamesMutex sync.RWMutex
+)
+
+// Game returns the game server hosting the game with key
+func Game(key string) (*GameSpy.Client, bool) {
+	gamesMutex.RLock()
+	defer gamesMutex.RUnlock()
+
+	gameServer, ok := games[key]
+	return gameServer, ok
+}
+
+// SetGame makes client the game server hosting the game with key
+func SetGame(key string, client *GameSpy.Client) {
+	gamesMutex.Lock()
+	defer gamesMutex.Unlock()
+
+	games[key] = client
+}
+
+// ReplaceGame makes client the game server hosting the game with key,
+// returning the one hosting it before
+func ReplaceGame(key string, client *GameSpy.Client) (*GameSpy.Client, bool) {
+	gamesMutex.Lock()
+	defer gamesMutex.Unlock()
+
+	previous, ok := games[key]
+	games[key] = client
+	return previous, ok
+}
+
+// RemoveGame forgets the game server hosting the game with key
+func RemoveGame(key string) {
+	gamesMutex.Lock()
+	defer gamesMutex.Unlock()
+
+	delete(games, key)
+}
+
+// RemoveGameOf forgets the game with key if client is hosting it, returning
+// whether it was
+func RemoveGameOf(key string, client *GameSpy.Client) bool {
+	gamesMutex.Lock()
+	defer gamesMutex.Unlock()
+
+	if games[key] != client {
+		return false
+	}
+	delete(games, key)
+	return true
+}
+
+// Games returns a copy of all connected game servers by the key of their game
+func Games() map[string]*GameSpy.Client {
+	gamesMutex.RLock()
+	defer gamesMutex.RUnlock()
+
+	copied := make(map[string]*GameSpy.Client, len(games))
+	for key, client := range games {
+		copied[key] = client
+	}
+	return copied
+}
 
 var Shard string
 
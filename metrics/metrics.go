@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// ClientsConnected - clients currently connected, by manager
+	ClientsConnected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gofesl_clients_connected",
+		Help: "Clients currently connected.",
+	}, []string{"manager"})
+
+	// GameServersActive - game servers currently registered, by manager
+	GameServersActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gofesl_game_servers_active",
+		Help: "Game servers currently registered.",
+	}, []string{"manager"})
+
+	// QueueLength - players waiting in the queues of all game servers
+	QueueLength = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gofesl_queue_length",
+		Help: "Players waiting in the queues of all game servers.",
+	}, []string{"manager"})
+
+	// GamesCreated - games created through CGAM
+	GamesCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gofesl_games_created_total",
+		Help: "Games created through CGAM.",
+	})
+
+	// Joins - joins through EGAM, by result (attempted, succeeded, failed,
+	// timed_out)
+	Joins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gofesl_joins_total",
+		Help: "Joins through EGAM, by result.",
+	}, []string{"result"})
+
+	// PlayersEntered - players which entered a game through PENT
+	PlayersEntered = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gofesl_players_entered_total",
+		Help: "Players which entered a game through PENT.",
+	})
+
+	// GetStatsCalls - GetStats commands handled
+	GetStatsCalls = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gofesl_getstats_total",
+		Help: "GetStats commands handled.",
+	})
+
+	// Commands - commands dispatched, by manager and command
+	Commands = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gofesl_commands_total",
+		Help: "Commands dispatched, by manager and command.",
+	}, []string{"manager", "command"})
+
+	// CommandOutcomes - commands answered, by manager, command, outcome and
+	// the reason of errors and rejections
+	CommandOutcomes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gofesl_command_outcomes_total",
+		Help: "Commands answered, by outcome and reason.",
+	}, []string{"manager", "command", "outcome", "reason"})
+
+	// QueryDuration - latency of database queries, by query
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gofesl_db_query_duration_seconds",
+		Help:    "Latency of database queries.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"query"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		ClientsConnected,
+		GameServersActive,
+		QueueLength,
+		GamesCreated,
+		Joins,
+		PlayersEntered,
+		GetStatsCalls,
+		Commands,
+		CommandOutcomes,
+		QueryDuration,
+	)
+}
+
+// Outcomes of commands
+const (
+	// OutcomeSuccess - the command did what was asked
+	OutcomeSuccess = "success"
+	// OutcomeError - the command was understood but couldn't be done
+	OutcomeError = "error"
+	// OutcomeRejected - the command wasn't even looked at
+	OutcomeRejected = "rejected"
+)
+
+// UnknownCommand - label of commands a manager doesn't know, so clients
+// can't create new series by sending made up ones
+const UnknownCommand = "unknown"
+
+// CommandLabel returns command if it's one of known, UnknownCommand otherwise
+func CommandLabel(command string, known map[string]bool) string {
+	if known[command] {
+		return command
+	}
+	return UnknownCommand
+}
+
+// CommandOutcome counts how a command ended, reason is empty for successes
+func CommandOutcome(manager string, command string, outcome string, reason string) {
+	CommandOutcomes.WithLabelValues(manager, command, outcome, reason).Inc()
+}
+
+// ObserveQuery records the time since start as the latency of a query
+func ObserveQuery(query string, start time.Time) {
+	QueryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+}
+
+// Server serves the metrics over HTTP
+type Server struct {
+	http *http.Server
+}
+
+// New starts serving /metrics on addr. An empty addr disables the endpoint.
+func (s *Server) New(addr string) error {
+	if addr == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	s.http = &http.Server{Handler: mux}
+
+	go func() {
+		err := s.http.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorln("Metrics endpoint stopped", err.Error())
+		}
+	}()
+
+	log.Noteln("Serving metrics on " + listener.Addr().String())
+	return nil
+}
+
+// Close stops serving the metrics
+func (s *Server) Close() error {
+	if s.http == nil {
+		return nil
+	}
+	return s.http.Close()
+}
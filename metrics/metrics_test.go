@@ -0,0 +1,42 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/HeroesAwaken/GoFesl/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCommandLabel(t *testing.T) {
+	known := map[string]bool{"EGAM": true, "GDAT": true}
+
+	tables := []struct {
+		command string
+		label   string
+	}{
+		{"EGAM", "EGAM"},
+		{"GDAT", "GDAT"},
+		{"XXXX", metrics.UnknownCommand},
+		{"egam", metrics.UnknownCommand},
+		{"", metrics.UnknownCommand},
+	}
+
+	for _, table := range tables {
+		if label := metrics.CommandLabel(table.command, known); label != table.label {
+			t.Errorf("CommandLabel of %q was incorrect, got: %s, want: %s.", table.command, label, table.label)
+		}
+	}
+}
+
+func TestCommandOutcome(t *testing.T) {
+	outcome := metrics.CommandOutcomes.WithLabelValues("test", "EGAM", metrics.OutcomeError, "banned")
+	before := testutil.ToFloat64(outcome)
+
+	metrics.CommandOutcome("test", "EGAM", metrics.OutcomeError, "banned")
+	metrics.CommandOutcome("test", "EGAM", metrics.OutcomeError, "banned")
+	metrics.CommandOutcome("test", "EGAM", metrics.OutcomeSuccess, "")
+
+	if count := testutil.ToFloat64(outcome) - before; count != 2 {
+		t.Errorf("CommandOutcome count was incorrect, got: %v, want: %v.", count, 2)
+	}
+}
@@ -0,0 +1,51 @@
+package theater
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// clientAddress returns the IP and port of addr, which may be IPv4 or IPv6.
+// IPv4 clients connecting to an IPv6 socket (::ffff:a.b.c.d) are reported
+// with their IPv4 address, so they're stored and advertised the same way
+// either way.
+func clientAddress(addr net.Addr) (string, string, bool) {
+	var ip net.IP
+	var port int
+
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		ip, port = addr.IP, addr.Port
+	case *net.UDPAddr:
+		ip, port = addr.IP, addr.Port
+	default:
+		if addr == nil {
+			return "", "", false
+		}
+		host, portString, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return "", "", false
+		}
+		ip = net.ParseIP(host)
+		port, err = strconv.Atoi(portString)
+		if err != nil {
+			return "", "", false
+		}
+	}
+
+	if ip == nil {
+		return "", "", false
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+	}
+
+	return ip.String(), strconv.Itoa(port), true
+}
+
+// displayAddress formats ip and port like the N field of GDAT expects them,
+// ip%3aport for IPv4 and [ip]%3aport for IPv6, with its colons escaped too
+func displayAddress(ip string, port string) string {
+	return strings.Replace(net.JoinHostPort(ip, port), ":", "%3a", -1)
+}
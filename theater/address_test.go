@@ -0,0 +1,107 @@
+package theater
+
+import (
+	"net"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+)
+
+func TestClientAddress(t *testing.T) {
+	tables := []struct {
+		addr net.Addr
+		ip   string
+		port string
+		ok   bool
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 18567}, "203.0.113.5", "18567", true},
+		{&net.TCPAddr{IP: net.ParseIP("::ffff:203.0.113.5"), Port: 18567}, "203.0.113.5", "18567", true},
+		{&net.TCPAddr{IP: net.ParseIP("2001:DB8::1"), Port: 18567}, "2001:db8::1", "18567", true},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 18275}, "2001:db8::1", "18275", true},
+		{&net.IPAddr{IP: net.ParseIP("2001:db8::1")}, "", "", false},
+		{&net.TCPAddr{}, "", "", false},
+		{nil, "", "", false},
+	}
+
+	for _, table := range tables {
+		ip, port, ok := clientAddress(table.addr)
+		if ip != table.ip || port != table.port || ok != table.ok {
+			t.Errorf("clientAddress(%v) was incorrect, got: %s, %s, %t, want: %s, %s, %t.", table.addr, ip, port, ok, table.ip, table.port, table.ok)
+		}
+	}
+}
+
+func TestServerDisplayNameAddress(t *testing.T) {
+	tables := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.5", "iad-server(203.0.113.5%3a18567)"},
+		{"2001:db8::1", "iad-server([2001%3adb8%3a%3a1]%3a18567)"},
+	}
+
+	for _, table := range tables {
+		if name := serverDisplayName("iad", "server", table.ip, "18567"); name != table.want {
+			t.Errorf("serverDisplayName for %s was incorrect, got: %s, want: %s.", table.ip, name, table.want)
+		}
+	}
+}
+
+func TestECHOIPv6(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	recorder := new(GameSpy.Recorder)
+	tM.socketUDP = recorder.UDP()
+
+	tM.ECHO(GameSpy.SocketUDPEvent{
+		Name: "command.ECHO",
+		Addr: &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 18275},
+		Data: &GameSpy.CommandFESL{Query: "ECHO", Message: map[string]string{"TID": "8", "TXN": "ECHO"}},
+	})
+
+	packets := recorder.Packets()
+	if len(packets) != 1 || packets[0].Message["IP"] != "2001:db8::1" || packets[0].Message["PORT"] != "18275" {
+		t.Errorf("ECHO was incorrect, got: %v, want IP: %s, PORT: %s.", packets, "2001:db8::1", "18275")
+	}
+}
+
+func TestCGAMRejectsUnknownAddress(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	server, recorder := newRecordedClient()
+	server.IpAddr = &net.IPAddr{IP: net.ParseIP("2001:db8::1")}
+
+	tM.CGAM(testCommand(server, "CGAM", map[string]string{"TID": "5", "NAME": "Server", "PORT": "18567"}))
+
+	packets := recorder.Packets()
+	if len(packets) != 1 || packets[0].Message["errorCode"] != "99" || packets[0].Message["TID"] != "5" {
+		t.Errorf("CGAM was incorrect, got: %v, want errorCode: %s.", packets, "99")
+	}
+}
+
+func TestCGAMIPv6(t *testing.T) {
+	l, cleanup := newTestLifecycle(t)
+	defer cleanup()
+
+	server := l.connect("2001:db8::1", 40000)
+
+	l.mock.ExpectPrepare("INSERT INTO game_server_stats").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	l.mock.ExpectExec("INSERT INTO games").WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "2001:db8::1", "18567",
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+		sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	created := l.send(server, "CGAM", map[string]string{"TID": "2", "NAME": "Server", "PORT": "18567", "HN": "server"})
+
+	client := l.connect("2001:db8::2", 50000)
+	data := l.send(client, "GDAT", map[string]string{"TID": "3", "GID": created["GID"]})
+	if data["IP"] != "2001:db8::1" || data["N"] != "iad-server([2001%3adb8%3a%3a1]%3a18567)" {
+		t.Errorf("GDAT was incorrect, got IP: %s, N: %s, want: %s, %s.", data["IP"], data["N"], "2001:db8::1", "iad-server([2001%3adb8%3a%3a1]%3a18567)")
+	}
+
+	if err := l.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("CGAM database calls were incorrect: %s", err)
+	}
+}
@@ -0,0 +1,223 @@
+package theater
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/HeroesAwaken/GoFesl/matchmaking"
+)
+
+var errNotFound = errors.New("not found")
+
+// Admin serves the operator endpoint to kick players, close lobbies and
+// change the log level
+type Admin struct {
+	http *http.Server
+	// secret has to be sent as bearer token, the endpoint refuses to start
+	// without one
+	secret   string
+	managers []*TheaterManager
+}
+
+// New starts serving the admin endpoint for managers on addr, accepting
+// requests authorized with secret. An empty addr disables the endpoint.
+func (a *Admin) New(addr string, secret string, managers ...*TheaterManager) error {
+	if addr == "" {
+		return nil
+	}
+	if secret == "" {
+		return errors.New("no AdminSecret configured")
+	}
+
+	a.secret = secret
+	a.managers = managers
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	a.http = &http.Server{Handler: a.handler()}
+
+	go func() {
+		err := a.http.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorln("Admin endpoint stopped", err.Error())
+		}
+	}()
+
+	log.Noteln("Serving admin endpoint on " + listener.Addr().String())
+	return nil
+}
+
+// Close stops serving the admin endpoint
+func (a *Admin) Close() error {
+	if a.http == nil {
+		return nil
+	}
+	return a.http.Close()
+}
+
+func (a *Admin) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/kick", a.authorized(func(w http.ResponseWriter, r *http.Request) {
+		a.respond(w, a.KickPlayer(r.FormValue("pid")))
+	}))
+	mux.HandleFunc("/close", a.authorized(func(w http.ResponseWriter, r *http.Request) {
+		a.respond(w, a.CloseLobby(r.FormValue("shard"), r.FormValue("gid")))
+	}))
+	mux.HandleFunc("/loglevel", a.authorized(func(w http.ResponseWriter, r *http.Request) {
+		a.respond(w, setLogLevel(r.FormValue("level")))
+	}))
+	return mux
+}
+
+// authorized only lets POSTs with the secret through
+func (a *Admin) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if a.secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.secret)) != 1 {
+			log.Warningln("Unauthorized admin request from " + r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (a *Admin) respond(w http.ResponseWriter, err error) {
+	switch err {
+	case nil:
+		w.Write([]byte("ok\n"))
+	case errNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// KickPlayer tells the server hosting a player to drop them and disconnects
+// the player from theater
+func (a *Admin) KickPlayer(pid string) error {
+	if pid == "" {
+		return errors.New("missing pid")
+	}
+
+	player := a.findClient(func(client *GameSpy.Client) bool {
+		return !client.State.IsServer && client.RedisState != nil && client.RedisState.Get("id") == pid
+	})
+	if player == nil {
+		return errNotFound
+	}
+
+	tM := a.managerOf(player)
+	if gameID := tM.playerGame(player); gameID != "" {
+		if gameServer, ok := matchmaking.Game(shardKey(player.State.Shard, gameID)); ok {
+			answer := make(map[string]string)
+			answer["TID"] = "0"
+			answer["PID"] = pid
+			answer["LID"] = player.State.LobbyID
+			answer["GID"] = gameID
+			gameServer.WriteFESL("QLVT", answer, 0x0)
+		}
+	}
+
+	log.Noteln("Kicking player " + pid)
+	player.Close()
+	return nil
+}
+
+// CloseLobby removes a game server, ends the GDAT subscriptions to it and
+// disconnects it
+func (a *Admin) CloseLobby(shard string, gameID string) error {
+	if gameID == "" {
+		return errors.New("missing gid")
+	}
+
+	gameServer, ok := matchmaking.Game(shardKey(shard, gameID))
+	if !ok {
+		return errNotFound
+	}
+
+	log.Noteln("Closing game server " + gameID)
+
+	tM := a.managerOf(gameServer)
+	if tM == nil {
+		return errNotFound
+	}
+
+	// Removed here already so the server's own close has nothing left to do
+	if !matchmaking.RemoveGameOf(shardKey(shard, gameID), gameServer) {
+		return errNotFound
+	}
+	tM.removeGameServer(shard, gameID)
+	if gameServer.RedisState != nil {
+		tM.forgetGameID(gameServer, gameID)
+	}
+
+	// Clients of the other managers may be watching it as well
+	for _, manager := range a.managers {
+		manager.unsubscribeGame(shard, gameID)
+	}
+
+	gameServer.Close()
+	return nil
+}
+
+// setLogLevel changes what gets logged at runtime, see log.SetLevel
+func setLogLevel(level string) error {
+	if level == "" {
+		return errors.New("missing level")
+	}
+
+	if err := log.SetLevel(level); err != nil {
+		return err
+	}
+	log.Warningln("Log level set to " + level)
+	return nil
+}
+
+// findClient looks through the clients of all managers
+func (a *Admin) findClient(match func(client *GameSpy.Client) bool) *GameSpy.Client {
+	for _, tM := range a.managers {
+		if tM.socket == nil {
+			continue
+		}
+		for _, client := range tM.socket.ConnectedClients() {
+			if client.IsActive && match(client) {
+				return client
+			}
+		}
+	}
+	return nil
+}
+
+// managerOf returns the manager a client is connected to, or the first one
+// if it can't be found
+func (a *Admin) managerOf(client *GameSpy.Client) *TheaterManager {
+	for _, tM := range a.managers {
+		if tM.socket == nil {
+			continue
+		}
+		for _, other := range tM.socket.ConnectedClients() {
+			if other == client {
+				return tM
+			}
+		}
+	}
+	if len(a.managers) == 0 {
+		return nil
+	}
+	return a.managers[0]
+}
@@ -0,0 +1,142 @@
+package theater
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/matchmaking"
+)
+
+func adminRequest(a *Admin, method string, target string, secret string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, nil)
+	if secret != "" {
+		request.Header.Set("Authorization", "Bearer "+secret)
+	}
+
+	response := httptest.NewRecorder()
+	a.handler().ServeHTTP(response, request)
+	return response
+}
+
+func TestAdminRequiresSecret(t *testing.T) {
+	a := new(Admin)
+	a.secret = "secret"
+
+	if response := adminRequest(a, http.MethodPost, "/kick?pid=1", ""); response.Code != http.StatusUnauthorized {
+		t.Errorf("Admin was incorrect, got: %d, want: %d.", response.Code, http.StatusUnauthorized)
+	}
+	if response := adminRequest(a, http.MethodPost, "/kick?pid=1", "wrong"); response.Code != http.StatusUnauthorized {
+		t.Errorf("Admin was incorrect, got: %d, want: %d.", response.Code, http.StatusUnauthorized)
+	}
+	if response := adminRequest(a, http.MethodGet, "/kick?pid=1", "secret"); response.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Admin was incorrect, got: %d, want: %d.", response.Code, http.StatusMethodNotAllowed)
+	}
+	if response := adminRequest(a, http.MethodPost, "/kick?pid=1", "secret"); response.Code != http.StatusNotFound {
+		t.Errorf("Admin was incorrect, got: %d, want: %d.", response.Code, http.StatusNotFound)
+	}
+}
+
+func TestAdminKickPlayer(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	gameServer, serverRecorder := newRecordedClient()
+	matchmaking.SetGame("1", gameServer)
+	defer matchmaking.RemoveGame("1")
+
+	player, _ := newRecordedClient()
+	player.RedisState = new(core.RedisState)
+	player.RedisState.New(tM.redis, "mm:player")
+	player.RedisState.Set("id", "7")
+	player.State.LobbyID = "1"
+	player.State.GameID = "1"
+
+	tM.socket = new(GameSpy.Socket)
+	tM.socket.Clients = append(tM.socket.Clients, player)
+
+	a := new(Admin)
+	a.secret = "secret"
+	a.managers = []*TheaterManager{tM}
+
+	if response := adminRequest(a, http.MethodPost, "/kick?pid=7", "secret"); response.Code != http.StatusOK {
+		t.Fatalf("Admin was incorrect, got: %d, want: %d.", response.Code, http.StatusOK)
+	}
+
+	packets := serverRecorder.Packets()
+	if len(packets) != 1 || packets[0].Type != "QLVT" || packets[0].Message["PID"] != "7" || packets[0].Message["GID"] != "1" {
+		t.Errorf("Admin was incorrect, got: %v, want a QLVT for PID 7.", packets)
+	}
+	if player.IsActive {
+		t.Errorf("Admin was incorrect, player is still active.")
+	}
+}
+
+func TestAdminCloseLobby(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	mock := newTestDB(t, tM)
+	mock.ExpectPrepare("DELETE FROM game_server_stats")
+	mock.ExpectPrepare("DELETE FROM games")
+	tM.stmtDeleteServerStatsByGIDAndShard, _ = tM.db.Prepare("DELETE FROM game_server_stats WHERE gid = ? AND shard = ?")
+	tM.stmtDeleteGameByGIDAndShard, _ = tM.db.Prepare("DELETE FROM games WHERE gid = ? AND shard = ?")
+	mock.ExpectExec("DELETE FROM game_server_stats").WithArgs("1", dbShard("")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM games").WithArgs("1", dbShard("")).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+
+	gameServer, _ := newRecordedClient()
+	matchmaking.SetGame("1", gameServer)
+	defer matchmaking.RemoveGame("1")
+
+	subscriber, subscriberRecorder := newRecordedClient()
+	tM.gdatSubscriptions[subscriber] = "1"
+
+	tM.socket = new(GameSpy.Socket)
+	tM.socket.Clients = append(tM.socket.Clients, gameServer, subscriber)
+
+	a := new(Admin)
+	a.secret = "secret"
+	a.managers = []*TheaterManager{tM}
+
+	if response := adminRequest(a, http.MethodPost, "/close?gid=1", "secret"); response.Code != http.StatusOK {
+		t.Fatalf("Admin was incorrect, got: %d, want: %d.", response.Code, http.StatusOK)
+	}
+
+	if exists := tM.redis.Exists("gdata:1").Val(); exists != 0 {
+		t.Errorf("Admin was incorrect, game server is still in redis.")
+	}
+	if _, ok := matchmaking.Game("1"); ok {
+		t.Errorf("Admin was incorrect, game server is still registered.")
+	}
+	if gameServer.IsActive {
+		t.Errorf("Admin was incorrect, game server is still active.")
+	}
+
+	if packets := subscriberRecorder.Packets(); len(packets) != 0 {
+		t.Errorf("Admin was incorrect, got: %v, want nothing for the subscriber.", packets)
+	}
+	if _, ok := tM.gdatSubscriptions[subscriber]; ok {
+		t.Errorf("Admin was incorrect, subscriber is still subscribed.")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Admin was incorrect, %s", err)
+	}
+}
+
+func TestAdminSetLogLevel(t *testing.T) {
+	a := new(Admin)
+	a.secret = "secret"
+
+	if response := adminRequest(a, http.MethodPost, "/loglevel?level=verbose", "secret"); response.Code != http.StatusBadRequest {
+		t.Errorf("Admin was incorrect, got: %d, want: %d.", response.Code, http.StatusBadRequest)
+	}
+	if response := adminRequest(a, http.MethodPost, "/loglevel?level=error", "secret"); response.Code != http.StatusOK {
+		t.Errorf("Admin was incorrect, got: %d, want: %d.", response.Code, http.StatusOK)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/HeroesAwaken/GoFesl/lib"
 	"github.com/HeroesAwaken/GoFesl/log"
 	"github.com/HeroesAwaken/GoFesl/matchmaking"
+	"github.com/HeroesAwaken/GoFesl/metrics"
 )
 
 // CGAM - SERVER called to create a game
@@ -17,58 +18,101 @@ func (tM *TheaterManager) CGAM(event GameSpy.EventClientFESLCommand) {
 		return
 	}
 
-	addr, ok := event.Client.IpAddr.(*net.TCPAddr)
-
+	ip, _, ok := clientAddress(event.Client.IpAddr)
 	if !ok {
-		log.Errorln("Failed turning IpAddr to net.TCPAddr")
+		log.Errorln("Failed reading the address of game server", event.Client.IpAddr)
+		tM.writeError(event.Client, "CGAM", event.Command.Message["TID"], GameSpy.ErrorCodeInvalid, "The server address is invalid.")
+		metrics.CommandOutcome(tM.name, "CGAM", metrics.OutcomeError, "bad_address")
 		return
 	}
 
-	gameIDInt, _ := tM.redis.Incr(COUNTER_GID_KEY).Result()
-	gameID := strconv.Itoa(int(gameIDInt))
+	tM.rememberAdvertisedPort(event.Client, ip, event.Command.Message["PORT"])
+
+	shard := event.Client.State.Shard
+
+	// Servers not asking for a known lobby end up in the first one
+	lobbyID := event.Command.Message["LID"]
+	if _, ok := tM.findLobby(lobbyID); !ok && len(tM.config.Lobbies) > 0 {
+		lobbyID = tM.config.Lobbies[0].ID
+	}
+
+	name := GameSpy.StripQuotes(event.Command.Message["NAME"])
+	identities := serverIdentities(shard, event.Client.RedisState.Get("userID"), event.Command.Message["UGID"], ip, event.Command.Message["PORT"])
+
+	// Held until the name is stored, so two servers can't claim the same one
+	tM.serverNamesMutex.Lock()
+
+	// A server creating its game again gets its GID back, once what's left
+	// of its previous game is gone. Its old name then isn't taken anymore.
+	gameID := tM.knownGameID(identities)
+	if gameID != "" {
+		tM.takeOverGameServer(event.Client, shard, gameID)
+	} else {
+		gameIDInt, _ := tM.redis.Incr(shardKey(shard, COUNTER_GID_KEY)).Result()
+		gameID = strconv.Itoa(int(gameIDInt))
+	}
+
+	name, err := tM.claimServerName(shard, gameID, name)
+	if err != nil {
+		// Taking the game over already made it ours
+		matchmaking.RemoveGameOf(shardKey(shard, gameID), event.Client)
+		tM.serverNamesMutex.Unlock()
+		log.Noteln("Rejecting server " + net.JoinHostPort(ip, event.Command.Message["PORT"]) + ", name " + event.Command.Message["NAME"] + " is taken")
+		tM.writeError(event.Client, "CGAM", event.Command.Message["TID"], GameSpy.ErrorCodeNameTaken, "A server with this name already exists.")
+		metrics.CommandOutcome(tM.name, "CGAM", metrics.OutcomeError, "name_taken")
+		return
+	}
+
+	tM.rememberGameID(event.Client, identities, gameID)
 
 	// Store our server for easy access later
-	matchmaking.Games[gameID] = event.Client
+	matchmaking.SetGame(shardKey(shard, gameID), event.Client)
 
 	var args []interface{}
 
 	// Setup a new key for our game
 	gameServer := new(lib.RedisObject)
-	gameServer.New(tM.redis, "gdata", gameID)
+	gameServer.New(tM.redis, gameDataPrefix(shard), gameID)
 
 	keys := 0
 
 	// Stores what we know about this game in the redis db
 	for index, value := range event.Command.Message {
-		if index == "TID" {
+		if !storedInRedis(index) {
 			continue
 		}
 
-		keys++
-
-		// Strip quotes
-		if len(value) > 0 && value[0] == '"' {
-			value = value[1:]
-		}
-		if len(value) > 0 && value[len(value)-1] == '"' {
-			value = value[:len(value)-1]
+		value = GameSpy.StripQuotes(value)
+		if index == "NAME" {
+			value = name
 		}
 		gameServer.Set(index, value)
 
+		if !storedInDB(index) {
+			continue
+		}
+
+		keys++
 		args = append(args, gameID)
+		args = append(args, dbShard(shard))
 		args = append(args, index)
 		args = append(args, value)
 	}
 
-	gameServer.Set("LID", "1")
+	gameServer.Set("LID", lobbyID)
 	gameServer.Set("GID", gameID)
-	gameServer.Set("IP", addr.IP.String())
+	gameServer.Set("IP", ip)
 	gameServer.Set("AP", "0")
 	gameServer.Set("QUEUE-LENGTH", "0")
+	tM.rememberRegion(gameServer)
+
+	tM.serverNamesMutex.Unlock()
 
 	event.Client.RedisState.Set("gdata:GID", gameID)
+	event.Client.State.IsServer = true
+	metrics.GamesCreated.Inc()
+	metrics.CommandOutcome(tM.name, "CGAM", metrics.OutcomeSuccess, "")
 
-	var err error
 	_, err = tM.setServerStatsStatement(keys).Exec(args...)
 	if err != nil {
 		log.Errorln("Failed setting stats for game server "+gameID, err.Error())
@@ -76,12 +120,12 @@ func (tM *TheaterManager) CGAM(event GameSpy.EventClientFESLCommand) {
 
 	answer := make(map[string]string)
 	answer["TID"] = event.Command.Message["TID"]
-	answer["LID"] = "1"
+	answer["LID"] = lobbyID
 	answer["UGID"] = event.Command.Message["UGID"]
 	answer["MAX-PLAYERS"] = event.Command.Message["MAX-PLAYERS"] // Validate this
-	answer["EKEY"] = "O65zZ2D2A58mNrZw1hmuJw%3d%3d"              // Eventually generate this
+	answer["EKEY"] = tM.config.EncryptionKey                     // Eventually generate this
 	answer["UGID"] = event.Command.Message["UGID"]               // Verify these against some auth shit
-	answer["SECRET"] = "2587913"                                 // Eventually generate this too
+	answer["SECRET"] = tM.config.Secret                          // Eventually generate this too
 	answer["JOIN"] = event.Command.Message["JOIN"]
 	answer["J"] = event.Command.Message["JOIN"]
 	answer["GID"] = gameID
@@ -89,8 +133,8 @@ func (tM *TheaterManager) CGAM(event GameSpy.EventClientFESLCommand) {
 	tM.logAnswer("CGAM", answer, 0x0)
 
 	// Create game in database
-	_, err = tM.stmtAddGame.Exec(gameID, Shard, addr.IP.String(), event.Command.Message["PORT"], event.Command.Message["B-version"], event.Command.Message["JOIN"], event.Command.Message["B-U-map"], 0, 0, event.Command.Message["MAX-PLAYERS"], 0, 0, "")
+	_, err = tM.stmtAddGame.Exec(gameID, dbShard(shard), ip, event.Command.Message["PORT"], event.Command.Message["B-version"], event.Command.Message["JOIN"], event.Command.Message["B-U-map"], 0, 0, event.Command.Message["MAX-PLAYERS"], 0, 0, "")
 	if err != nil {
-		log.Panicln(err)
+		log.Errorln("Failed adding game server "+gameID, err.Error())
 	}
 }
@@ -0,0 +1,207 @@
+package theater
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/matchmaking"
+)
+
+func TestCGAM(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tables := []struct {
+		message map[string]string
+		answer  map[string]string
+	}{
+		{
+			map[string]string{"TID": "5", "LID": "1", "NAME": "\"Server\"", "PORT": "18567", "UGID": "abc", "MAX-PLAYERS": "16", "JOIN": "O"},
+			map[string]string{"TID": "5", "LID": "1", "UGID": "abc", "MAX-PLAYERS": "16", "EKEY": "O65zZ2D2A58mNrZw1hmuJw%3d%3d", "SECRET": "2587913", "JOIN": "O", "J": "O", "GID": "1"},
+		},
+		{
+			map[string]string{"TID": "6", "LID": "99", "NAME": "Other", "PORT": "18568", "UGID": "def", "MAX-PLAYERS": "32", "JOIN": "C"},
+			map[string]string{"TID": "6", "LID": "1", "UGID": "def", "MAX-PLAYERS": "32", "EKEY": "O65zZ2D2A58mNrZw1hmuJw%3d%3d", "SECRET": "2587913", "JOIN": "C", "J": "C", "GID": "2"},
+		},
+	}
+
+	mock := newTestDB(t, tM)
+	mock.ExpectPrepare("INSERT INTO games")
+	stmt, err := tM.db.Prepare("INSERT INTO games")
+	if err != nil {
+		t.Fatalf("Preparing stmtAddGame failed: %s", err)
+	}
+	tM.stmtAddGame = stmt
+
+	// Both servers send the same amount of keys, so they share a statement
+	statsStmt := mock.ExpectPrepare("INSERT INTO game_server_stats")
+	tM.setServerStatsStatement(6)
+
+	for _, table := range tables {
+		client, recorder := newRecordedClient()
+		client.IpAddr = &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 40000}
+		client.RedisState = new(core.RedisState)
+		client.RedisState.New(tM.redis, "mm:test")
+
+		statsStmt.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO games").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		tM.CGAM(testCommand(client, "CGAM", table.message))
+
+		packets := recorder.Packets()
+		if len(packets) != 1 || packets[0].Type != "CGAM" {
+			t.Fatalf("CGAM packets were incorrect, got: %v, want: one CGAM.", packets)
+		}
+		if !reflect.DeepEqual(packets[0].Message, table.answer) {
+			t.Errorf("CGAM was incorrect, got: %v, want: %v.", packets[0].Message, table.answer)
+		}
+
+		gdata := tM.redis.HGetAll("gdata:" + table.answer["GID"]).Val()
+		if gdata["IP"] != "203.0.113.5" || gdata["LID"] != table.answer["LID"] {
+			t.Errorf("CGAM stored game was incorrect, got: %v, want IP: %s, LID: %s.", gdata, "203.0.113.5", table.answer["LID"])
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("CGAM database calls were incorrect: %s", err)
+	}
+}
+
+func TestCGAMReusesGameServer(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	mock := newTestDB(t, tM)
+	mock.ExpectPrepare("INSERT INTO games")
+	mock.ExpectPrepare("DELETE FROM game_server_stats")
+	mock.ExpectPrepare("DELETE FROM games")
+	tM.stmtAddGame, _ = tM.db.Prepare("INSERT INTO games")
+	tM.stmtDeleteServerStatsByGIDAndShard, _ = tM.db.Prepare("DELETE FROM game_server_stats WHERE gid = ? AND shard = ?")
+	tM.stmtDeleteGameByGIDAndShard, _ = tM.db.Prepare("DELETE FROM games WHERE gid = ? AND shard = ?")
+	statsStmt := mock.ExpectPrepare("INSERT INTO game_server_stats")
+	tM.setServerStatsStatement(5)
+
+	message := map[string]string{"TID": "5", "NAME": "Server", "PORT": "18567", "UGID": "abc", "MAX-PLAYERS": "16", "JOIN": "O"}
+
+	// The first connection creates the game, then stops answering
+	statsStmt.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO games").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	first, _ := newRecordedClient()
+	first.IpAddr = &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 40000}
+	first.RedisState = new(core.RedisState)
+	first.RedisState.New(tM.redis, "mm:first")
+	tM.CGAM(testCommand(first, "CGAM", message))
+	defer matchmaking.RemoveGame("1")
+
+	tM.redis.HSet("gdata:1", "AP", "5")
+	tM.redis.HSet("gdata:1", "B-U-stale", "1")
+
+	// The server reconnects and creates its game again
+	mock.ExpectExec("DELETE FROM game_server_stats").WithArgs("1", dbShard("")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM games").WithArgs("1", dbShard("")).WillReturnResult(sqlmock.NewResult(0, 1))
+	statsStmt.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO games").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	second, recorder := newRecordedClient()
+	second.IpAddr = &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 40001}
+	second.RedisState = new(core.RedisState)
+	second.RedisState.New(tM.redis, "mm:second")
+	tM.CGAM(testCommand(second, "CGAM", message))
+
+	packets := recorder.Packets()
+	if len(packets) != 1 || packets[0].Message["GID"] != "1" {
+		t.Fatalf("CGAM was incorrect, got: %v, want GID: %s.", packets, "1")
+	}
+	if first.IsActive {
+		t.Errorf("CGAM was incorrect, the stale connection is still active.")
+	}
+
+	gdata := tM.redis.HGetAll("gdata:1").Val()
+	if gdata["AP"] != "0" || gdata["B-U-stale"] != "" || gdata["NAME"] != "Server" {
+		t.Errorf("CGAM was incorrect, got: %v, want the stale stats reset.", gdata)
+	}
+	if counter := tM.redis.Get(COUNTER_GID_KEY).Val(); counter != "1" {
+		t.Errorf("CGAM GID counter was incorrect, got: %s, want: %s.", counter, "1")
+	}
+
+	// Closing the stale connection leaves the game alone
+	tM.close(GameSpy.EventClientClose{Client: first})
+	if owner, _ := matchmaking.Game("1"); owner != second || tM.redis.HGet("gdata:1", "NAME").Val() != "Server" {
+		t.Errorf("close was incorrect, the reused game server got removed.")
+	}
+
+	// The identities of a server which went away expire
+	identity := "gserver:addr:203.0.113.5:18567"
+	if ttl := tM.redis.TTL(identity).Val(); ttl >= 0 {
+		t.Errorf("CGAM was incorrect, identity of a connected server expires in %s.", ttl)
+	}
+
+	mock.ExpectExec("DELETE FROM game_server_stats").WithArgs("1", dbShard("")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM games").WithArgs("1", dbShard("")).WillReturnResult(sqlmock.NewResult(0, 1))
+	tM.close(GameSpy.EventClientClose{Client: second})
+	if ttl := tM.redis.TTL(identity).Val(); ttl <= 0 || ttl > serverIdentityTTL {
+		t.Errorf("close was incorrect, identity expires in %s, want within %s.", ttl, serverIdentityTTL)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("CGAM database calls were incorrect: %s", err)
+	}
+}
+
+func TestCGAMUGIDNeedsSameAccount(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	mock := newTestDB(t, tM)
+	mock.ExpectPrepare("INSERT INTO games")
+	tM.stmtAddGame, _ = tM.db.Prepare("INSERT INTO games")
+	statsStmt := mock.ExpectPrepare("INSERT INTO game_server_stats")
+	tM.setServerStatsStatement(5)
+
+	servers := []struct {
+		ip      string
+		account string
+		name    string
+		gameID  string
+	}{
+		{"203.0.113.5", "1", "First", "1"},
+		// Someone else sending the same UGID doesn't get the game
+		{"198.51.100.7", "2", "Second", "2"},
+	}
+
+	var clients []*GameSpy.Client
+	for _, server := range servers {
+		statsStmt.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO games").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		client, recorder := newRecordedClient()
+		client.IpAddr = &net.TCPAddr{IP: net.ParseIP(server.ip), Port: 40000}
+		client.RedisState = new(core.RedisState)
+		client.RedisState.New(tM.redis, "mm:"+server.account)
+		client.RedisState.Set("userID", server.account)
+		tM.CGAM(testCommand(client, "CGAM", map[string]string{"TID": "5", "NAME": server.name, "PORT": "18567", "UGID": "abc", "MAX-PLAYERS": "16", "JOIN": "O"}))
+		defer matchmaking.RemoveGame(server.gameID)
+
+		packets := recorder.Packets()
+		if len(packets) != 1 || packets[0].Message["GID"] != server.gameID {
+			t.Errorf("CGAM of account %s was incorrect, got: %v, want GID: %s.", server.account, packets, server.gameID)
+		}
+		clients = append(clients, client)
+	}
+
+	if !clients[0].IsActive {
+		t.Errorf("CGAM was incorrect, the server of another account got closed.")
+	}
+	if owner, _ := matchmaking.Game("1"); owner != clients[0] {
+		t.Errorf("CGAM was incorrect, the game of another account got taken over.")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("CGAM database calls were incorrect: %s", err)
+	}
+}
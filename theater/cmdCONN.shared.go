@@ -15,10 +15,14 @@ func (tM *TheaterManager) CONN(event GameSpy.EventClientFESLCommand) {
 		return
 	}
 
+	// Used to hide servers running a different build
+	event.Client.State.ClientVersion = event.Command.Message["VERS"]
+	event.Client.State.Locale = event.Command.Message["LOCALE"]
+
 	answer := make(map[string]string)
 	answer["TID"] = event.Command.Message["TID"]
 	answer["TIME"] = strconv.FormatInt(time.Now().UTC().Unix(), 10)
-	answer["activityTimeoutSecs"] = "3600"
+	answer["activityTimeoutSecs"] = strconv.Itoa(int(tM.config.ActivityTimeout.Seconds()))
 	answer["PROT"] = event.Command.Message["PROT"]
 	event.Client.WriteFESL(event.Command.Query, answer, 0x0)
 	tM.logAnswer(event.Command.Query, answer, 0x0)
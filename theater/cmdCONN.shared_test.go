@@ -0,0 +1,56 @@
+package theater
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCONN(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tables := []struct {
+		message map[string]string
+		answer  map[string]string
+	}{
+		{
+			map[string]string{"TID": "1", "PROT": "2", "VERS": "1.46.222034.0", "LOCALE": "en_US"},
+			map[string]string{"TID": "1", "PROT": "2", "activityTimeoutSecs": "3600"},
+		},
+		{
+			map[string]string{"TID": "2"},
+			map[string]string{"TID": "2", "PROT": "", "activityTimeoutSecs": "3600"},
+		},
+	}
+
+	for _, table := range tables {
+		client, recorder := newRecordedClient()
+
+		before := time.Now().UTC().Unix()
+		tM.CONN(testCommand(client, "CONN", table.message))
+
+		packets := recorder.Packets()
+		if len(packets) != 1 || packets[0].Type != "CONN" {
+			t.Fatalf("CONN packets were incorrect, got: %v, want: one CONN.", packets)
+		}
+
+		answer := packets[0].Message
+		answerTime, err := strconv.ParseInt(answer["TIME"], 10, 64)
+		if err != nil || answerTime < before || answerTime > time.Now().UTC().Unix() {
+			t.Errorf("CONN TIME was incorrect, got: %s, want: about %d.", answer["TIME"], before)
+		}
+		delete(answer, "TIME")
+
+		if !reflect.DeepEqual(answer, table.answer) {
+			t.Errorf("CONN was incorrect, got: %v, want: %v.", answer, table.answer)
+		}
+		if client.State.ClientVersion != table.message["VERS"] {
+			t.Errorf("CONN client version was incorrect, got: %s, want: %s.", client.State.ClientVersion, table.message["VERS"])
+		}
+		if client.State.Locale != table.message["LOCALE"] {
+			t.Errorf("CONN client locale was incorrect, got: %s, want: %s.", client.State.Locale, table.message["LOCALE"])
+		}
+	}
+}
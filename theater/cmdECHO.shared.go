@@ -1,23 +1,32 @@
 package theater
 
 import (
-	"strconv"
-
 	"github.com/HeroesAwaken/GoFesl/GameSpy"
 	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/HeroesAwaken/GoFesl/metrics"
 )
 
 // ECHO - SHARED called like some heartbeat
 func (tM *TheaterManager) ECHO(event GameSpy.SocketUDPEvent) {
 	command := event.Data.(*GameSpy.CommandFESL)
 
+	ip, port, ok := clientAddress(event.Addr)
+	if !ok {
+		log.Errorln("Failed reading the address of ECHO", event.Addr)
+		metrics.CommandOutcome(tM.name, "ECHO", metrics.OutcomeRejected, "unreadable_address")
+		return
+	}
+
 	answer := make(map[string]string)
 	answer["TID"] = command.Message["TID"]
 	answer["TXN"] = command.Message["TXN"]
-	answer["IP"] = event.Addr.IP.String()
-	answer["PORT"] = strconv.Itoa(event.Addr.Port)
+	answer["IP"] = tM.advertisedIP(ip)
+	answer["PORT"] = port
 	answer["ERR"] = "0"
 	answer["TYPE"] = "1"
+
+	tM.checkAdvertisedPort(ip, port)
+
 	err := tM.socketUDP.WriteFESL("ECHO", answer, 0x0, event.Addr)
 	if err != nil {
 		log.Errorln(err)
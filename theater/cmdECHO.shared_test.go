@@ -0,0 +1,64 @@
+package theater
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestECHO(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	recorder := new(GameSpy.Recorder)
+	tM.socketUDP = recorder.UDP()
+
+	addr := &net.UDPAddr{IP: net.ParseIP("203.0.113.5"), Port: 18275}
+	tM.ECHO(GameSpy.SocketUDPEvent{
+		Name: "command.ECHO",
+		Addr: addr,
+		Data: &GameSpy.CommandFESL{Query: "ECHO", Message: map[string]string{"TID": "8", "TXN": "ECHO"}},
+	})
+
+	want := map[string]string{"TID": "8", "TXN": "ECHO", "IP": "203.0.113.5", "PORT": "18275", "ERR": "0", "TYPE": "1"}
+
+	packets := recorder.Packets()
+	if len(packets) != 1 || packets[0].Type != "ECHO" {
+		t.Fatalf("ECHO packets were incorrect, got: %v, want: one ECHO.", packets)
+	}
+	if !reflect.DeepEqual(packets[0].Message, want) {
+		t.Errorf("ECHO was incorrect, got: %v, want: %v.", packets[0].Message, want)
+	}
+	if packets[0].Addr != addr {
+		t.Errorf("ECHO address was incorrect, got: %v, want: %v.", packets[0].Addr, addr)
+	}
+}
+
+func TestECHOCountsUnreadableAddresses(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+	tM.name = "echo"
+
+	recorder := new(GameSpy.Recorder)
+	tM.socketUDP = recorder.UDP()
+
+	unreadable := metrics.CommandOutcomes.WithLabelValues("echo", "ECHO", metrics.OutcomeRejected, "unreadable_address")
+	before := testutil.ToFloat64(unreadable)
+
+	tM.ECHO(GameSpy.SocketUDPEvent{
+		Name: "command.ECHO",
+		Addr: &net.UDPAddr{},
+		Data: &GameSpy.CommandFESL{Query: "ECHO", Message: map[string]string{"TID": "8", "TXN": "ECHO"}},
+	})
+
+	if packets := recorder.Packets(); len(packets) != 0 {
+		t.Errorf("ECHO was incorrect, got: %v, want no answer.", packets)
+	}
+	if count := testutil.ToFloat64(unreadable) - before; count != 1 {
+		t.Errorf("ECHO unreadable_address count was incorrect, got: %f, want: %d.", count, 1)
+	}
+}
@@ -1,13 +1,14 @@
 package theater
 
 import (
-	"net"
-	"strconv"
+	"database/sql"
+	"time"
 
 	"github.com/HeroesAwaken/GoFesl/GameSpy"
 	"github.com/HeroesAwaken/GoFesl/lib"
 	"github.com/HeroesAwaken/GoFesl/log"
 	"github.com/HeroesAwaken/GoFesl/matchmaking"
+	"github.com/HeroesAwaken/GoFesl/metrics"
 )
 
 // EGAM - CLIENT called when a client wants to join a gameserver
@@ -16,11 +17,112 @@ func (tM *TheaterManager) EGAM(event GameSpy.EventClientFESLCommand) {
 		log.Noteln("Client left")
 		return
 	}
-	externalIP := event.Client.IpAddr.(*net.TCPAddr).IP.String()
-	lobbyID := event.Command.Message["LID"]
+	externalIP, externalPort, ok := clientAddress(event.Client.IpAddr)
+	if !ok {
+		log.Errorln("Failed reading the address of joining client", event.Client.IpAddr)
+		tM.writeError(event.Client, "EGAM", event.Command.Message["TID"], GameSpy.ErrorCodeInvalid, "Your address is invalid.")
+		metrics.CommandOutcome(tM.name, "EGAM", metrics.OutcomeError, "bad_address")
+		return
+	}
 	gameID := event.Command.Message["GID"]
 	pid := event.Client.RedisState.Get("id")
 
+	metrics.Joins.WithLabelValues("attempted").Inc()
+
+	tM.rememberAdvertisedPort(event.Client, externalIP, event.Command.Message["PORT"])
+
+	gsData := new(lib.RedisObject)
+	gsData.New(tM.redis, gameDataPrefix(event.Client.State.Shard), gameID)
+
+	// Servers without a known LID are listed in the first lobby
+	lobbyID := tM.serverLobby(gsData)
+	if !tM.canJoinLobby(event.Client.State.LobbyID, lobbyID) {
+		log.Noteln("Client in lobby " + event.Client.State.LobbyID + " tried to join " + gameID + " in lobby " + lobbyID)
+		tM.writeError(event.Client, "EGAM", event.Command.Message["TID"], GameSpy.ErrorCodeOtherLobby, "The server is in a different lobby.")
+		metrics.Joins.WithLabelValues("failed").Inc()
+		metrics.CommandOutcome(tM.name, "EGAM", metrics.OutcomeError, "other_lobby")
+		return
+	}
+
+	password := GameSpy.StripQuotes(event.Command.Message["PASSWORD"])
+
+	if !checkPassword(gsData, password) {
+		log.Noteln("Wrong password for " + gameID + " from " + externalIP)
+		tM.writeError(event.Client, "EGAM", event.Command.Message["TID"], GameSpy.ErrorCodeWrongGamePassword, "The password is incorrect.")
+		metrics.Joins.WithLabelValues("failed").Inc()
+		metrics.CommandOutcome(tM.name, "EGAM", metrics.OutcomeError, "wrong_password")
+		return
+	}
+
+	if joinRefusedMidRound(gsData) {
+		log.Noteln("Server " + gameID + " doesn't allow joining mid-round, refusing " + externalIP)
+		tM.writeError(event.Client, "EGAM", event.Command.Message["TID"], GameSpy.ErrorCodeJoinInProgress, "The round is in progress and the server doesn't allow joining.")
+		metrics.Joins.WithLabelValues("failed").Inc()
+		metrics.CommandOutcome(tM.name, "EGAM", metrics.OutcomeError, "in_progress")
+		return
+	}
+
+	banned, err := tM.bans.IsBanned(event.Client.RedisState.Get("userID"))
+	if err != nil {
+		log.Errorln("Failed checking bans for "+event.Client.RedisState.Get("userID"), err.Error())
+		tM.writeError(event.Client, "EGAM", event.Command.Message["TID"], GameSpy.ErrorCodeInternal, "Your account couldn't be checked.")
+		metrics.Joins.WithLabelValues("failed").Inc()
+		metrics.CommandOutcome(tM.name, "EGAM", metrics.OutcomeError, "ban_check_failed")
+		return
+	}
+	if banned {
+		log.Noteln("Banned user " + event.Client.RedisState.Get("userID") + " tried to join " + gameID)
+		tM.writeError(event.Client, "EGAM", event.Command.Message["TID"], GameSpy.ErrorCodeBanned, "Your account is banned.")
+		metrics.Joins.WithLabelValues("failed").Inc()
+		metrics.CommandOutcome(tM.name, "EGAM", metrics.OutcomeError, "banned")
+		return
+	}
+
+	if !versionCompatible(event.Client.State.ClientVersion, serverVersion(gsData)) {
+		log.Noteln("Client " + event.Client.State.ClientVersion + " can't join " + gameID + " running " + serverVersion(gsData))
+		tM.writeError(event.Client, "EGAM", event.Command.Message["TID"], GameSpy.ErrorCodeVersionMismatch, "The server runs a different version of the game.")
+		metrics.Joins.WithLabelValues("failed").Inc()
+		metrics.CommandOutcome(tM.name, "EGAM", metrics.OutcomeError, "version_mismatch")
+		return
+	}
+
+	observer := joinsAsObserver(event.Command.Message)
+
+	gameServer, ok := matchmaking.Game(shardKey(event.Client.State.Shard, gameID))
+	if !ok {
+		log.Noteln("Game server " + gameID + " isn't connected anymore")
+		tM.writeError(event.Client, "EGAM", event.Command.Message["TID"], GameSpy.ErrorCodeNotFound, "The server isn't available anymore.")
+		metrics.Joins.WithLabelValues("failed").Inc()
+		metrics.CommandOutcome(tM.name, "EGAM", metrics.OutcomeError, "server_gone")
+		return
+	}
+
+	// Without the player the server would be asked to let nobody in
+	stats, err := tM.playerStats(statsTable(event.Client), pid)
+	if err != nil {
+		log.Errorln("Failed looking up hero "+pid+" of account "+event.Client.RedisState.Get("userID"), err.Error())
+		tM.writeError(event.Client, "EGAM", event.Command.Message["TID"], GameSpy.ErrorCodeInternal, "Your soldier couldn't be loaded.")
+		metrics.Joins.WithLabelValues("failed").Inc()
+		metrics.CommandOutcome(tM.name, "EGAM", metrics.OutcomeError, "lookup_failed")
+		return
+	}
+	if stats["heroName"] == "" {
+		log.Noteln("Hero " + pid + " of account " + event.Client.RedisState.Get("userID") + " doesn't exist, refusing to join " + gameID)
+		tM.writeError(event.Client, "EGAM", event.Command.Message["TID"], GameSpy.ErrorCodeNotFound, "Your soldier couldn't be found.")
+		metrics.Joins.WithLabelValues("failed").Inc()
+		metrics.CommandOutcome(tM.name, "EGAM", metrics.OutcomeError, "player_not_found")
+		return
+	}
+
+	// Taken last, so no later refusal has to give the slot back
+	if observer && !tM.takeObserverSlot(event.Client.State.Shard, gameID, pid, gsData) {
+		log.Noteln("No observer slot left on " + gameID + " for " + externalIP)
+		tM.writeError(event.Client, "EGAM", event.Command.Message["TID"], GameSpy.ErrorCodeObserversFull, "The server has no observer slots left.")
+		metrics.Joins.WithLabelValues("failed").Inc()
+		metrics.CommandOutcome(tM.name, "EGAM", metrics.OutcomeError, "observers_full")
+		return
+	}
+
 	clientAnswer := make(map[string]string)
 	clientAnswer["TID"] = event.Command.Message["TID"]
 	clientAnswer["LID"] = lobbyID
@@ -28,97 +130,122 @@ func (tM *TheaterManager) EGAM(event GameSpy.EventClientFESLCommand) {
 	event.Client.WriteFESL("EGAM", clientAnswer, 0x0)
 	tM.logAnswer("EGAM", clientAnswer, 0x0)
 
-	// Get 4 stats for PID
-	rows, err := tM.getStatsStatement(4).Query(pid, "c_kit", "c_team", "elo", "level")
-	if err != nil {
-		log.Errorln("Failed gettings stats for hero "+pid, err.Error())
+	// todo: get game data and check if full
+
+	serverEGRQ := make(map[string]string)
+	serverEGRQ["TID"] = "0"
+
+	heroName := sanitizeNickname(stats["heroName"], tM.config.FallbackNickname)
+
+	serverEGRQ["NAME"] = heroName
+	serverEGRQ["UID"] = stats["userID"]
+	//serverEGRQ["PID"] = event.Command.Message["R-U-accid"]
+	serverEGRQ["PID"] = pid
+	serverEGRQ["TICKET"] = tM.config.Ticket
+
+	//serverEGRQ["IP"] = event.Command.Message["R-U-externalIp"]
+	serverEGRQ["IP"] = externalIP
+	serverEGRQ["PORT"] = externalPort
+	//serverEGRQ["PORT"] = event.Command.Message["PORT"]
+
+	serverEGRQ["INT-IP"] = event.Command.Message["R-INT-IP"]
+	serverEGRQ["INT-PORT"] = event.Command.Message["R-INT-PORT"]
+
+	serverEGRQ["PTYPE"] = playerTypePlayer
+	if observer {
+		serverEGRQ["PTYPE"] = playerTypeObserver
+	}
+	// maybe do CID here?
+	serverEGRQ["R-USER"] = heroName
+	serverEGRQ["R-UID"] = stats["userID"]
+	serverEGRQ["R-U-accid"] = stats["userID"]
+	serverEGRQ["R-U-elo"] = statOrDefault(stats, "elo", "1000")
+	if !observer {
+		// Observers don't play for either army
+		serverEGRQ["R-U-team"] = balancedTeam(gsData)
+	}
+	serverEGRQ["R-U-kit"] = statOrDefault(stats, "c_kit", "0")
+	serverEGRQ["R-U-lvl"] = statOrDefault(stats, "level", "1")
+	serverEGRQ["R-U-dataCenter"] = tM.serverDataCenter(gsData)
+	//serverEGRQ["R-U-externalIp"] = event.Command.Message["R-U-externalIp"]
+	serverEGRQ["R-U-externalIp"] = externalIP
+	serverEGRQ["R-U-internalIp"] = event.Command.Message["R-INT-IP"]
+	serverEGRQ["R-U-category"] = event.Command.Message["R-U-category"]
+	serverEGRQ["R-INT-IP"] = event.Command.Message["R-INT-IP"]
+	serverEGRQ["R-INT-PORT"] = event.Command.Message["R-INT-PORT"]
+
+	serverEGRQ["XUID"] = tM.config.XUID
+	serverEGRQ["R-XUID"] = tM.config.XUID
+
+	serverEGRQ["LID"] = lobbyID
+	serverEGRQ["GID"] = gameID
+
+	gameServer.WriteFESL("EGRQ", serverEGRQ, 0x0)
+	tM.logAnswer("EGRQ", serverEGRQ, 0x0)
+
+	clientEGEG := make(map[string]string)
+	clientEGEG["TID"] = event.Command.Message["TID"]
+	clientEGEG["PL"] = tM.serverPlatform(gsData)
+	clientEGEG["TICKET"] = tM.config.Ticket
+
+	// That is the ServerID, was/is a test
+	clientEGEG["PID"] = pid
+	clientEGEG["I"] = tM.advertisedIP(gsData.Get("IP"))
+	clientEGEG["P"] = gsData.Get("PORT")
+	clientEGEG["HUID"] = tM.config.HostUserID // find via GID soon
+	clientEGEG["EKEY"] = tM.config.EncryptionKey
+	clientEGEG["INT-IP"] = gsData.Get("INT-IP")
+	clientEGEG["INT-PORT"] = gsData.Get("INT-PORT")
+	clientEGEG["SECRET"] = tM.config.Secret
+	clientEGEG["UGID"] = gsData.Get("UGID")
+	clientEGEG["LID"] = lobbyID
+	clientEGEG["GID"] = gameID
+	if welcome := welcomeMessage(gsData); welcome != "" {
+		clientEGEG["WELCOME"] = "\"" + welcome + "\""
 	}
 
+	event.Client.WriteFESL("EGEG", clientEGEG, 0x0)
+	tM.logAnswer("EGEG", clientEGEG, 0x0)
+	tM.setPlayerGame(event.Client, gameID)
+	tM.startJoin(event.Client, event.Command.Message["TID"], lobbyID, gameID, pid, observer)
+	metrics.Joins.WithLabelValues("succeeded").Inc()
+	metrics.CommandOutcome(tM.name, "EGAM", metrics.OutcomeSuccess, "")
+
+}
+
+// playerStats looks up hero pid in table with the stats EGRQ needs. Heroes
+// which don't exist come back without a heroName.
+func (tM *TheaterManager) playerStats(table string, pid string) (map[string]string, error) {
 	stats := make(map[string]string)
+	if pid == "" {
+		return stats, nil
+	}
+
+	// Get 4 stats for PID, the keys are bound before the hero id
+	start := time.Now()
+	rows, err := tM.getStatsStatement(table, 4).Query("c_kit", "c_team", "elo", "level", pid)
+	metrics.ObserveQuery("getStats", start)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var userID, heroID, heroName, statsKey, statsValue string
+		// A hero without any of the stats yet comes back as a single row
+		// without a stat
+		var userID, heroID, heroName string
+		var statsKey, statsValue sql.NullString
 		err := rows.Scan(&userID, &heroID, &heroName, &statsKey, &statsValue)
 		if err != nil {
-			log.Errorln("Issue with database:", err.Error())
+			return nil, err
 		}
 
 		stats["heroName"] = heroName
 		stats["userID"] = userID
-		stats[statsKey] = statsValue
-	}
-
-	// todo: get game data and check if full
-
-	if gameServer, ok := matchmaking.Games[gameID]; ok {
-		gsData := new(lib.RedisObject)
-		gsData.New(tM.redis, "gdata", gameID)
-
-		//gameServer := matchmaking.Games[gameID]
-
-		serverEGRQ := make(map[string]string)
-		serverEGRQ["TID"] = "0"
-
-		serverEGRQ["NAME"] = stats["heroName"]
-		serverEGRQ["UID"] = stats["userID"]
-		//serverEGRQ["PID"] = event.Command.Message["R-U-accid"]
-		serverEGRQ["PID"] = pid
-		serverEGRQ["TICKET"] = "2018751182"
-
-		//serverEGRQ["IP"] = event.Command.Message["R-U-externalIp"]
-		serverEGRQ["IP"] = externalIP
-		serverEGRQ["PORT"] = strconv.Itoa(event.Client.IpAddr.(*net.TCPAddr).Port)
-		//serverEGRQ["PORT"] = event.Command.Message["PORT"]
-
-		serverEGRQ["INT-IP"] = event.Command.Message["R-INT-IP"]
-		serverEGRQ["INT-PORT"] = event.Command.Message["R-INT-PORT"]
-
-		serverEGRQ["PTYPE"] = "P"
-		// maybe do CID here?
-		serverEGRQ["R-USER"] = stats["heroName"]
-		serverEGRQ["R-UID"] = stats["userID"]
-		serverEGRQ["R-U-accid"] = stats["userID"]
-		serverEGRQ["R-U-elo"] = stats["elo"]
-		serverEGRQ["R-U-team"] = stats["c_team"]
-		serverEGRQ["R-U-kit"] = stats["c_kit"]
-		serverEGRQ["R-U-lvl"] = stats["level"]
-		serverEGRQ["R-U-dataCenter"] = "iad"
-		//serverEGRQ["R-U-externalIp"] = event.Command.Message["R-U-externalIp"]
-		serverEGRQ["R-U-externalIp"] = externalIP
-		serverEGRQ["R-U-internalIp"] = event.Command.Message["R-INT-IP"]
-		serverEGRQ["R-U-category"] = event.Command.Message["R-U-category"]
-		serverEGRQ["R-INT-IP"] = event.Command.Message["R-INT-IP"]
-		serverEGRQ["R-INT-PORT"] = event.Command.Message["R-INT-PORT"]
-
-		serverEGRQ["XUID"] = "24"
-		serverEGRQ["R-XUID"] = "24"
-
-		serverEGRQ["LID"] = lobbyID
-		serverEGRQ["GID"] = gameID
-
-		gameServer.WriteFESL("EGRQ", serverEGRQ, 0x0)
-		tM.logAnswer("EGRQ", serverEGRQ, 0x0)
-
-		clientEGEG := make(map[string]string)
-		clientEGEG["TID"] = event.Command.Message["TID"]
-		clientEGEG["PL"] = "pc"
-		clientEGEG["TICKET"] = "2018751182"
-
-		// That is the ServerID, was/is a test
-		clientEGEG["PID"] = pid
-		clientEGEG["I"] = gsData.Get("IP")
-		clientEGEG["P"] = gsData.Get("PORT")
-		clientEGEG["HUID"] = "1" // find via GID soon
-		clientEGEG["EKEY"] = "O65zZ2D2A58mNrZw1hmuJw%3d%3d"
-		clientEGEG["INT-IP"] = gsData.Get("INT-IP")
-		clientEGEG["INT-PORT"] = gsData.Get("INT-PORT")
-		clientEGEG["SECRET"] = "2587913"
-		clientEGEG["UGID"] = gsData.Get("UGID")
-		clientEGEG["LID"] = lobbyID
-		clientEGEG["GID"] = gameID
-
-		event.Client.WriteFESL("EGEG", clientEGEG, 0x0)
-		tM.logAnswer("EGEG", clientEGEG, 0x0)
+		if statsKey.Valid {
+			stats[statsKey.String] = statsValue.String
+		}
 	}
 
+	return stats, rows.Err()
 }
@@ -0,0 +1,296 @@
+package theater
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/lib"
+	"github.com/HeroesAwaken/GoFesl/matchmaking"
+)
+
+func TestEGAMRejectsOtherLobby(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.config.Lobbies = []Lobby{
+		{ID: "1", Name: "bfwestPC02", Locale: "en_US", MaxGames: 10000},
+		{ID: "2", Name: "bfeuPC01", Locale: "de_DE", MaxGames: 500},
+	}
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("gdata:1", "LID", "2")
+
+	// Clients which never listed a lobby can't name the one they're in
+	for _, clientLobby := range []string{"1", ""} {
+		client, conn := newTestClient(t)
+		client.IpAddr = &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 40000}
+		client.RedisState = new(core.RedisState)
+		client.RedisState.New(tM.redis, "mm:test")
+		client.State.LobbyID = clientLobby
+
+		go tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "4", "LID": "2", "GID": "1", "PORT": "40000"}))
+
+		_, answer := readTestPacket(t, conn)
+		if answer["errorCode"] != "104" {
+			t.Errorf("EGAM from lobby %q was incorrect, got errorCode: %s, want: %s.", clientLobby, answer["errorCode"], "104")
+		}
+		conn.Close()
+	}
+}
+
+func TestEGAMRejectsWrongPassword(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("gdata:1", "PASSWORD", "secret")
+
+	client, conn := newTestClient(t)
+	defer conn.Close()
+	client.IpAddr = &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 40000}
+	client.RedisState = new(core.RedisState)
+	client.RedisState.New(tM.redis, "mm:test")
+	client.State.LobbyID = "1"
+
+	go tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "4", "GID": "1", "PORT": "40000", "PASSWORD": "\"wrong\""}))
+
+	_, answer := readTestPacket(t, conn)
+	if answer["errorCode"] != "106" {
+		t.Errorf("EGAM was incorrect, got errorCode: %s, want: %s.", answer["errorCode"], "106")
+	}
+}
+
+func TestEGAMRejectsJoinInProgress(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("gdata:1", "B-U-jip", "0")
+	tM.redis.HSet("gdata:1", "B-U-server_state", "in_round")
+
+	client, recorder := newRecordedClient()
+	client.IpAddr = &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 40000}
+	client.RedisState = new(core.RedisState)
+	client.RedisState.New(tM.redis, "mm:test")
+	client.State.LobbyID = "1"
+
+	tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "4", "GID": "1", "PORT": "40000"}))
+
+	packets := recorder.Packets()
+	if len(packets) != 1 || packets[0].Message["errorCode"] != "107" {
+		t.Fatalf("EGAM was incorrect, got: %v, want errorCode: %s.", packets, "107")
+	}
+
+	tM.GDAT(testCommand(client, "GDAT", map[string]string{"TID": "5", "GID": "1"}))
+
+	packets = recorder.Packets()
+	if packets[1].Message["JIP"] != "0" {
+		t.Errorf("GDAT JIP was incorrect, got: %s, want: %s.", packets[1].Message["JIP"], "0")
+	}
+}
+
+func TestEGAMRejectsUnknownPlayer(t *testing.T) {
+	tables := []struct {
+		rows      *sqlmock.Rows
+		err       error
+		errorCode string
+	}{
+		{sqlmock.NewRows([]string{"user_id", "id", "heroName", "statsKey", "statsValue"}), nil, "111"},
+		{nil, errors.New("connection lost"), "112"},
+	}
+
+	for _, table := range tables {
+		tM, cleanup := newTestTheater(t)
+
+		mock := newTestDB(t, tM)
+		mock.ExpectPrepare("SELECT count").ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		tM.bans = new(lib.BanChecker)
+		if err := tM.bans.New(tM.db.Conn(), time.Minute); err != nil {
+			t.Fatalf("Preparing bans failed: %s", err)
+		}
+		query := mock.ExpectPrepare("SELECT game_heroes").ExpectQuery()
+		if table.err != nil {
+			query.WillReturnError(table.err)
+		} else {
+			query.WillReturnRows(table.rows)
+		}
+
+		tM.redis.HSet("gdata:1", "GID", "1")
+		server, serverRecorder := newRecordedClient()
+		matchmaking.SetGame("1", server)
+
+		client, recorder := newJoiningClient(tM)
+		tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "4", "GID": "1", "PORT": "40000"}))
+
+		packets := recorder.Packets()
+		if len(packets) != 1 || packets[0].Message["errorCode"] != table.errorCode {
+			t.Errorf("EGAM was incorrect, got: %v, want one EGAM with errorCode: %s.", packets, table.errorCode)
+		}
+		if len(serverRecorder.Packets()) != 0 {
+			t.Errorf("EGAM was incorrect, the server was asked to let in %v.", serverRecorder.Packets())
+		}
+		if client.State.GameID != "" {
+			t.Errorf("EGAM was incorrect, client joined %s.", client.State.GameID)
+		}
+
+		matchmaking.RemoveGame("1")
+		cleanup()
+	}
+}
+
+func TestEGAMAdmitsHeroWithoutStats(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	mock := newTestDB(t, tM)
+	mock.ExpectPrepare("SELECT count").ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	tM.bans = new(lib.BanChecker)
+	if err := tM.bans.New(tM.db.Conn(), time.Minute); err != nil {
+		t.Fatalf("Preparing bans failed: %s", err)
+	}
+
+	// A fresh hero has none of the stats yet, filtering them while joining
+	// still returns the hero once
+	rows := sqlmock.NewRows([]string{"user_id", "id", "heroName", "statsKey", "statsValue"}).
+		AddRow("42", "7", "Fresh", nil, nil)
+	mock.ExpectPrepare(`SELECT game_heroes.*AND stats.statsKey IN \(\?, \?, \?, \?\)\s+WHERE game_heroes.id=\?$`).ExpectQuery().WithArgs("c_kit", "c_team", "elo", "level", "7").WillReturnRows(rows)
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	server, serverRecorder := newRecordedClient()
+	matchmaking.SetGame("1", server)
+	defer matchmaking.RemoveGame("1")
+
+	client, recorder := newJoiningClient(tM)
+	tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "4", "GID": "1", "PORT": "40000"}))
+
+	packets := recorder.Packets()
+	if len(packets) == 0 || packets[0].Type != "EGAM" || packets[0].Message["errorCode"] != "" {
+		t.Fatalf("EGAM was incorrect, got: %v, want an EGAM without errorCode.", packets)
+	}
+
+	serverPackets := serverRecorder.Packets()
+	if len(serverPackets) != 1 || serverPackets[0].Type != "EGRQ" || serverPackets[0].Message["NAME"] != "Fresh" {
+		t.Errorf("EGAM was incorrect, got: %v, want an EGRQ for %s.", serverPackets, "Fresh")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("EGAM database calls were incorrect: %s", err)
+	}
+}
+
+func TestJoinRefusedMidRound(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tables := []struct {
+		jip     string
+		state   string
+		refused bool
+	}{
+		{"0", "in_round", true},
+		{"0", "pre_round", false},
+		{"1", "in_round", false},
+		{"", "in_round", false},
+	}
+
+	for i, table := range tables {
+		gameID := strconv.Itoa(i)
+		tM.redis.HSet("gdata:"+gameID, "B-U-jip", table.jip)
+		tM.redis.HSet("gdata:"+gameID, "B-U-server_state", table.state)
+
+		gameServer := new(lib.RedisObject)
+		gameServer.New(tM.redis, "gdata", gameID)
+
+		if refused := joinRefusedMidRound(gameServer); refused != table.refused {
+			t.Errorf("joinRefusedMidRound(%s, %s) was incorrect, got: %t, want: %t.", table.jip, table.state, refused, table.refused)
+		}
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("gdata:1", "B-U-password", "secret")
+	gameServer := new(lib.RedisObject)
+	gameServer.New(tM.redis, "gdata", "1")
+
+	tables := []struct {
+		password string
+		ok       bool
+	}{
+		{"secret", true},
+		{"wrong", false},
+		{"", false},
+	}
+
+	for _, table := range tables {
+		if ok := checkPassword(gameServer, table.password); ok != table.ok {
+			t.Errorf("checkPassword(%q) was incorrect, got: %t, want: %t.", table.password, ok, table.ok)
+		}
+	}
+
+	gameServer.New(tM.redis, "gdata", "2")
+	if !checkPassword(gameServer, "") {
+		t.Errorf("checkPassword without a stored password was incorrect, got: %t, want: %t.", false, true)
+	}
+}
+
+func TestCanJoinLobby(t *testing.T) {
+	tables := []struct {
+		clientLobby string
+		gameLobby   string
+		allowCross  bool
+		canJoin     bool
+	}{
+		{"1", "1", false, true},
+		{"1", "2", false, false},
+		{"", "2", false, false},
+		{"", "", false, false},
+		{"1", "2", true, true},
+		{"", "2", true, true},
+	}
+
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	for _, table := range tables {
+		tM.config.AllowCrossLobbyJoins = table.allowCross
+		canJoin := tM.canJoinLobby(table.clientLobby, table.gameLobby)
+		if canJoin != table.canJoin {
+			t.Errorf("canJoinLobby(%s, %s) was incorrect, got: %t, want: %t.", table.clientLobby, table.gameLobby, canJoin, table.canJoin)
+		}
+	}
+}
+
+func TestEGAMRefusedWhenBanCheckFails(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	mock := newTestDB(t, tM)
+	mock.ExpectPrepare("SELECT count").ExpectQuery().WillReturnError(errors.New("connection lost"))
+	tM.bans = new(lib.BanChecker)
+	if err := tM.bans.New(tM.db.Conn(), time.Minute); err != nil {
+		t.Fatalf("Preparing bans failed: %s", err)
+	}
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	server, serverRecorder := newRecordedClient()
+	matchmaking.SetGame("1", server)
+	defer matchmaking.RemoveGame("1")
+
+	client, recorder := newJoiningClient(tM)
+	tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "4", "GID": "1", "PORT": "40000"}))
+
+	packets := recorder.Packets()
+	if len(packets) != 1 || packets[0].Message["errorCode"] != "112" {
+		t.Errorf("EGAM was incorrect, got: %v, want one EGAM with errorCode: %s.", packets, "112")
+	}
+	if len(serverRecorder.Packets()) != 0 {
+		t.Errorf("EGAM was incorrect, the server was asked to let in %v.", serverRecorder.Packets())
+	}
+}
@@ -12,10 +12,11 @@ func (tM *TheaterManager) EGRS(event GameSpy.EventClientFESLCommand) {
 	}
 
 	if event.Command.Message["ALLOWED"] == "1" {
-		_, err := tM.stmtGameIncreaseJoining.Exec(event.Command.Message["GID"], Shard)
+		_, err := tM.stmtGameIncreaseJoining.Exec(event.Command.Message["GID"], dbShard(event.Client.State.Shard))
 		if err != nil {
-			log.Panicln(err)
+			log.Errorln("Failed increasing joining players of "+event.Command.Message["GID"], err.Error())
 		}
+		tM.reserveJoin(event.Client.State.Shard, event.Command.Message["GID"], event.Command.Message["PID"])
 	}
 
 	answer := make(map[string]string)
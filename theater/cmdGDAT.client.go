@@ -13,28 +13,46 @@ func (tM *TheaterManager) GDAT(event GameSpy.EventClientFESLCommand) {
 		return
 	}
 
-	gameID := event.Command.Message["GID"]
+	gameID := GameSpy.StripQuotes(event.Command.Message["GID"])
+	if tM.redis.Exists(gameDataPrefix(event.Client.State.Shard)+":"+gameID).Val() == 0 {
+		tM.writeError(event.Client, "GDAT", event.Command.Message["TID"], GameSpy.ErrorCodeNotFound, "The server doesn't exist.")
+		return
+	}
+
+	answer := tM.gameData(event.Client.State.Shard, gameID)
+	answer["TID"] = event.Command.Message["TID"]
+	answer["B-U-map_name"] = tM.mapDisplayName(clientLocale(event.Client.State.Locale), answer["B-U-map"])
+
+	event.Client.WriteFESL("GDAT", answer, 0x0)
+	tM.logAnswer("GDAT", answer, 0x0)
+
+}
 
+// gameData builds the GDAT answer (without TID) for a server of a shard
+func (tM *TheaterManager) gameData(shard string, gameID string) map[string]string {
 	gameServer := new(lib.RedisObject)
-	gameServer.New(tM.redis, "gdata", gameID)
+	gameServer.New(tM.redis, gameDataPrefix(shard), gameID)
 
 	answer := make(map[string]string)
 
-	answer["TID"] = event.Command.Message["TID"]
-
 	for _, dataKey := range gameServer.HKeys() {
-		// Strip quotes
-		if len(dataKey) > 0 && dataKey[0] == '"' {
-			dataKey = dataKey[1:]
-		}
-		if len(dataKey) > 0 && dataKey[len(dataKey)-1] == '"' {
-			dataKey = dataKey[:len(dataKey)-1]
+		dataKey = GameSpy.StripQuotes(dataKey)
+
+		if passwordKeys[dataKey] {
+			continue
 		}
 
 		answer[dataKey] = gameServer.Get(dataKey)
 	}
 
-	event.Client.WriteFESL("GDAT", answer, 0x0)
-	tM.logAnswer("GDAT", answer, 0x0)
+	answer["PW"] = passwordFlag(gameServer)
+	answer["JIP"] = joinInProgressFlag(gameServer)
+	answer["PL"] = tM.serverPlatform(gameServer)
+	answer["V"] = serverVersion(gameServer)
+
+	answer[dataCenterKey] = tM.serverDataCenter(gameServer)
+	answer["HN"] = tM.normalizeHostname(gameServer.Get("HN"), gameServer.Get("IP"))
+	answer["N"] = serverDisplayName(answer[dataCenterKey], answer["HN"], gameServer.Get("IP"), gameServer.Get("PORT"))
 
+	return answer
 }
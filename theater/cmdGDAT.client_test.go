@@ -0,0 +1,201 @@
+package theater
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGDATPlatform(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("gdata:1", "PL", "PS3")
+	tM.redis.HSet("gdata:2", "GID", "2")
+
+	client, conn := newTestClient(t)
+	defer conn.Close()
+
+	go tM.GDAT(testCommand(client, "GDAT", map[string]string{"TID": "4", "GID": "1"}))
+	_, answer := readTestPacket(t, conn)
+	if answer["PL"] != "PS3" {
+		t.Errorf("GDAT PL was incorrect, got: %s, want: %s.", answer["PL"], "PS3")
+	}
+
+	go tM.GDAT(testCommand(client, "GDAT", map[string]string{"TID": "5", "GID": "2"}))
+	_, answer = readTestPacket(t, conn)
+	if answer["PL"] != tM.config.Platform {
+		t.Errorf("GDAT PL was incorrect, got: %s, want: %s.", answer["PL"], tM.config.Platform)
+	}
+}
+
+func TestGDATMapDisplayName(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.config.MapDisplayNames = map[string]map[string]string{
+		"en_US": {"no_vehicles": "Infantry Only", "village": "Victory Village"},
+		"de_DE": {"no_vehicles": "Nur Infanterie"},
+	}
+
+	tables := []struct {
+		locale string
+		mapID  string
+		name   string
+	}{
+		{"de_DE", "no_vehicles", "Nur Infanterie"},
+		{"en_US", "no_vehicles", "Infantry Only"},
+		{"", "no_vehicles", "Infantry Only"},
+		{"de_DE", "village", "Victory Village"},
+		{"de_DE", "unknown_map", "unknown_map"},
+	}
+
+	for _, table := range tables {
+		tM.redis.HSet("gdata:1", "B-U-map", table.mapID)
+
+		client, conn := newTestClient(t)
+		client.State.Locale = table.locale
+
+		go tM.GDAT(testCommand(client, "GDAT", map[string]string{"TID": "4", "GID": "1"}))
+		_, answer := readTestPacket(t, conn)
+		if answer["B-U-map"] != table.mapID {
+			t.Errorf("GDAT B-U-map was incorrect, got: %s, want: %s.", answer["B-U-map"], table.mapID)
+		}
+		if answer["B-U-map_name"] != table.name {
+			t.Errorf("GDAT B-U-map_name for %s was incorrect, got: %s, want: %s.", table.locale, answer["B-U-map_name"], table.name)
+		}
+		conn.Close()
+	}
+}
+
+func TestGDATPasswordFlag(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("gdata:1", "PASSWORD", "secret")
+	tM.redis.HSet("gdata:2", "GID", "2")
+	tM.redis.HSet("gdata:2", "PASSWORD", "")
+
+	tables := []struct {
+		gameID string
+		pw     string
+	}{
+		{"1", "1"},
+		{"2", "0"},
+	}
+
+	for _, table := range tables {
+		client, conn := newTestClient(t)
+
+		go tM.GDAT(testCommand(client, "GDAT", map[string]string{"TID": "4", "GID": table.gameID}))
+		_, answer := readTestPacket(t, conn)
+		if answer["PW"] != table.pw {
+			t.Errorf("GDAT PW for %s was incorrect, got: %s, want: %s.", table.gameID, answer["PW"], table.pw)
+		}
+		if _, ok := answer["PASSWORD"]; ok {
+			t.Errorf("GDAT for %s leaked the password.", table.gameID)
+		}
+		conn.Close()
+	}
+}
+
+func TestGDAT(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("gdata:1", "IP", "203.0.113.5")
+	tM.redis.HSet("gdata:1", "PORT", "18567")
+	tM.redis.HSet("gdata:1", "B-version", "1.46.222034.0")
+	tM.redis.HSet("gdata:1", "B-U-map", "village")
+	tM.redis.HSet("gdata:1", "HN", "Heroes.Example.com")
+
+	tables := []struct {
+		gameID string
+		answer map[string]string
+	}{
+		{
+			"1",
+			map[string]string{
+				"TID": "7", "GID": "1", "IP": "203.0.113.5", "PORT": "18567", "B-version": "1.46.222034.0",
+				"B-U-map": "village", "B-U-map_name": "village", "HN": "heroes.example.com", "PW": "0", "JIP": "1", "PL": "PC",
+				"V": "1.46.222034.0", "N": "iad-heroes.example.com(203.0.113.5%3a18567)", "B-U-data_center": "iad",
+			},
+		},
+		{
+			"2",
+			map[string]string{
+				"TID": "7", "errorCode": "111", "localizedMessage": "\"The server doesn't exist.\"",
+			},
+		},
+	}
+
+	for _, table := range tables {
+		client, recorder := newRecordedClient()
+
+		tM.GDAT(testCommand(client, "GDAT", map[string]string{"TID": "7", "GID": table.gameID}))
+
+		packets := recorder.Packets()
+		if len(packets) != 1 || packets[0].Type != "GDAT" {
+			t.Fatalf("GDAT packets were incorrect, got: %v, want: one GDAT.", packets)
+		}
+		if !reflect.DeepEqual(packets[0].Message, table.answer) {
+			t.Errorf("GDAT for %s was incorrect, got: %v, want: %v.", table.gameID, packets[0].Message, table.answer)
+		}
+	}
+}
+
+func TestGDATConfiguredPlatformNames(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	var err error
+	tM.config.PlatformNames, err = ParsePlatformNames(map[string]string{"Win64": "PC64"})
+	if err != nil {
+		t.Fatalf("ParsePlatformNames failed: %s", err)
+	}
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("gdata:1", "B-U-platform", "WIN64")
+
+	if platform := tM.gameData("", "1")["PL"]; platform != "PC64" {
+		t.Errorf("gameData PL was incorrect, got: %s, want: %s.", platform, "PC64")
+	}
+
+	if _, err := ParsePlatformNames(map[string]string{"ps3": ""}); err == nil {
+		t.Errorf("ParsePlatformNames was incorrect, an empty platform was accepted.")
+	}
+}
+
+func TestGDATVersion(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("gdata:1", "B-version", "1.46.222034.0")
+	tM.redis.HSet("gdata:1", "V", "1.0")
+	tM.redis.HSet("gdata:2", "GID", "2")
+	tM.redis.HSet("gdata:2", "V", "1.46.222034.0")
+	tM.redis.HSet("gdata:3", "GID", "3")
+
+	tables := []struct {
+		gameID  string
+		version string
+	}{
+		{"1", "1.46.222034.0"},
+		{"2", "1.46.222034.0"},
+		{"3", ""},
+	}
+
+	client, conn := newTestClient(t)
+	defer conn.Close()
+
+	for _, table := range tables {
+		go tM.GDAT(testCommand(client, "GDAT", map[string]string{"TID": "4", "GID": table.gameID}))
+		_, answer := readTestPacket(t, conn)
+		if answer["V"] != table.version {
+			t.Errorf("GDAT V of %s was incorrect, got: %s, want: %s.", table.gameID, answer["V"], table.version)
+		}
+	}
+}
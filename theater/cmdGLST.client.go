@@ -1,15 +1,95 @@
 package theater
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/lib"
 	"github.com/HeroesAwaken/GoFesl/log"
 )
 
-// GLST - CLIENT called to get a list of game servers? Irrelevant for heroes.
+// GLST - CLIENT called to get a list of game servers, followed by a GDAT
+// for every server the client is able to join
 func (tM *TheaterManager) GLST(event GameSpy.EventClientFESLCommand) {
 	if !event.Client.IsActive {
 		log.Noteln("Client left")
 		return
 	}
-	log.Noteln("GLST was called")
+
+	lobbyID := event.Command.Message["LID"]
+	event.Client.State.LobbyID = lobbyID
+
+	shard := event.Client.State.Shard
+	allGameIDs := tM.listGameIDs(shard)
+
+	lobbyGames := 0
+	var gameIDs []string
+	for _, gameID := range allGameIDs {
+		gameServer := new(lib.RedisObject)
+		gameServer.New(tM.redis, gameDataPrefix(shard), gameID)
+
+		if tM.serverLobby(gameServer) != lobbyID {
+			continue
+		}
+		lobbyGames++
+
+		// Hide servers the client couldn't join anyway
+		if !versionCompatible(event.Client.State.ClientVersion, serverVersion(gameServer)) {
+			continue
+		}
+
+		gameIDs = append(gameIDs, gameID)
+	}
+
+	answer := make(map[string]string)
+	answer["TID"] = event.Command.Message["TID"]
+	answer["LID"] = lobbyID
+	answer["LOBBY-NUM-GAMES"] = strconv.Itoa(lobbyGames)
+	answer["LOBBY-MAX-GAMES"] = "10000"
+	if lobby, ok := tM.findLobby(lobbyID); ok {
+		answer["LOBBY-MAX-GAMES"] = strconv.Itoa(lobby.MaxGames)
+	}
+	answer["FAVORITE-GAMES"] = "0"
+	answer["FAVORITE-PLAYERS"] = "0"
+	answer["NUM-GAMES"] = strconv.Itoa(len(gameIDs))
+	event.Client.WriteFESL(event.Command.Query, answer, 0x0)
+	tM.logAnswer(event.Command.Query, answer, 0x0)
+
+	for _, gameID := range gameIDs {
+		gdatPacket := tM.gameData(shard, gameID)
+		gdatPacket["TID"] = event.Command.Message["TID"]
+		gdatPacket["LID"] = lobbyID
+		gdatPacket["B-U-map_name"] = tM.mapDisplayName(clientLocale(event.Client.State.Locale), gdatPacket["B-U-map"])
+		event.Client.WriteFESL("GDAT", gdatPacket, 0x0)
+	}
+}
+
+// listGameIDs returns the GIDs of all game servers registered in a shard.
+// Only MaxConcurrentScans of them run at the same time, everyone else waits.
+func (tM *TheaterManager) listGameIDs(shard string) []string {
+	prefix := gameDataPrefix(shard) + ":"
+
+	tM.scanSlots <- struct{}{}
+	defer func() { <-tM.scanSlots }()
+
+	var gameIDs []string
+	var cursor uint64
+
+	for {
+		keys, next, err := tM.redis.Scan(cursor, prefix+"*", 100).Result()
+		if err != nil {
+			log.Errorln("Failed listing game servers", err.Error())
+			return gameIDs
+		}
+
+		for _, key := range keys {
+			gameIDs = append(gameIDs, strings.TrimPrefix(key, prefix))
+		}
+
+		if next == 0 {
+			return gameIDs
+		}
+		cursor = next
+	}
 }
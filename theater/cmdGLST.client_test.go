@@ -0,0 +1,128 @@
+package theater
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGLSTWaitsForScanSlot(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+	tM.scanSlots = make(chan struct{}, 2)
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+
+	// Occupy every slot
+	tM.scanSlots <- struct{}{}
+	tM.scanSlots <- struct{}{}
+
+	client, conn := newTestClient(t)
+	defer conn.Close()
+
+	done := make(chan map[string]string)
+	go func() {
+		_, answer := readTestPacket(t, conn)
+		done <- answer
+	}()
+	go tM.GLST(testCommand(client, "GLST", map[string]string{"TID": "5", "LID": "1"}))
+
+	select {
+	case answer := <-done:
+		t.Fatalf("GLST was incorrect, answered while no scan slot was free: %v", answer)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-tM.scanSlots
+
+	select {
+	case answer := <-done:
+		if answer["NUM-GAMES"] != "1" {
+			t.Errorf("GLST was incorrect, got NUM-GAMES: %s, want: %s.", answer["NUM-GAMES"], "1")
+		}
+		readTestPacket(t, conn)
+	case <-time.After(time.Second):
+		t.Fatalf("GLST was incorrect, didn't answer after a scan slot was freed")
+	}
+}
+
+func TestGLSTConcurrentScans(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+	tM.scanSlots = make(chan struct{}, 3)
+
+	for i := 1; i <= 5; i++ {
+		tM.redis.HSet("gdata:"+strconv.Itoa(i), "GID", strconv.Itoa(i))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		client, conn := newTestClient(t)
+		wg.Add(1)
+		go func(conn net.Conn) {
+			defer wg.Done()
+			defer conn.Close()
+			// GLST followed by 5 GDAT
+			for j := 0; j < 6; j++ {
+				readTestPacket(t, conn)
+			}
+		}(conn)
+		go tM.GLST(testCommand(client, "GLST", map[string]string{"TID": strconv.Itoa(i), "LID": "1"}))
+	}
+	wg.Wait()
+
+	if len(tM.scanSlots) != 0 {
+		t.Errorf("GLST was incorrect, %d scan slots still taken", len(tM.scanSlots))
+	}
+}
+
+func TestGLSTOnlyListsOwnShard(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("eu:gdata:1", "GID", "1")
+	tM.redis.HSet("eu:gdata:2", "GID", "2")
+
+	client, conn := newTestClient(t)
+	defer conn.Close()
+	client.State.Shard = "eu"
+
+	go tM.GLST(testCommand(client, "GLST", map[string]string{"TID": "5", "LID": "1"}))
+
+	_, answer := readTestPacket(t, conn)
+	if answer["NUM-GAMES"] != "2" {
+		t.Fatalf("GLST was incorrect, got NUM-GAMES: %s, want: %s.", answer["NUM-GAMES"], "2")
+	}
+	readTestPacket(t, conn)
+	readTestPacket(t, conn)
+}
+
+func TestGLSTOnlyListsRequestedLobby(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.config.Lobbies = []Lobby{
+		{ID: "1", Name: "bfwestPC02", Locale: "en_US", MaxGames: 10000},
+		{ID: "2", Name: "bfeuPC01", Locale: "de_DE", MaxGames: 500},
+	}
+
+	tM.redis.HSet("gdata:1", "LID", "1")
+	tM.redis.HSet("gdata:2", "LID", "2")
+
+	client, conn := newTestClient(t)
+	defer conn.Close()
+
+	go tM.GLST(testCommand(client, "GLST", map[string]string{"TID": "5", "LID": "2"}))
+
+	_, answer := readTestPacket(t, conn)
+	if answer["NUM-GAMES"] != "1" || answer["LOBBY-NUM-GAMES"] != "1" || answer["LOBBY-MAX-GAMES"] != "500" {
+		t.Fatalf("GLST was incorrect, got: %v.", answer)
+	}
+	_, gdat := readTestPacket(t, conn)
+	if gdat["LID"] != "2" {
+		t.Errorf("GLST was incorrect, got GDAT for lobby: %s, want: %s.", gdat["LID"], "2")
+	}
+}
@@ -0,0 +1,20 @@
+package theater
+
+import (
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/log"
+)
+
+// GPOP - CLIENT called to get the population history of a server
+func (tM *TheaterManager) GPOP(event GameSpy.EventClientFESLCommand) {
+	if !event.Client.IsActive {
+		log.Noteln("Client left")
+		return
+	}
+
+	gameID := event.Command.Message["GID"]
+
+	answer := populationAnswer(event.Command.Message["TID"], gameID, tM.populationHistory(event.Client.State.Shard, gameID))
+	event.Client.WriteFESL(event.Command.Query, answer, 0x0)
+	tM.logAnswer(event.Command.Query, answer, 0x0)
+}
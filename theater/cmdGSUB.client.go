@@ -0,0 +1,85 @@
+package theater
+
+import (
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/log"
+)
+
+// GSUB - CLIENT called when showing the details of a server, the client
+// then gets a fresh GDAT whenever the server updates. An empty GID ends the
+// subscription.
+func (tM *TheaterManager) GSUB(event GameSpy.EventClientFESLCommand) {
+	if !event.Client.IsActive {
+		log.Noteln("Client left")
+		return
+	}
+
+	gameID := event.Command.Message["GID"]
+
+	tM.gdatSubscriptionsMutex.Lock()
+	if gameID == "" {
+		delete(tM.gdatSubscriptions, event.Client)
+	} else {
+		// A client only ever looks at one server, so this replaces any
+		// previous subscription
+		tM.gdatSubscriptions[event.Client] = gameID
+	}
+	tM.gdatSubscriptionsMutex.Unlock()
+
+	answer := make(map[string]string)
+	answer["TID"] = event.Command.Message["TID"]
+	answer["GID"] = gameID
+	event.Client.WriteFESL(event.Command.Query, answer, 0x0)
+	tM.logAnswer(event.Command.Query, answer, 0x0)
+}
+
+// unsubscribeGDAT ends the subscription of a client, if it has one
+func (tM *TheaterManager) unsubscribeGDAT(client *GameSpy.Client) {
+	tM.gdatSubscriptionsMutex.Lock()
+	delete(tM.gdatSubscriptions, client)
+	tM.gdatSubscriptionsMutex.Unlock()
+}
+
+// unsubscribeGame ends all subscriptions to a server which is gone, there's
+// no GDAT left to send them
+func (tM *TheaterManager) unsubscribeGame(shard string, gameID string) {
+	tM.gdatSubscriptionsMutex.Lock()
+	defer tM.gdatSubscriptionsMutex.Unlock()
+
+	for client, subscribedGameID := range tM.gdatSubscriptions {
+		if subscribedGameID == gameID && client.State.Shard == shard {
+			delete(tM.gdatSubscriptions, client)
+		}
+	}
+}
+
+// notifyGDATSubscribers sends the current GDAT of a server to everyone in
+// its shard subscribed to it
+func (tM *TheaterManager) notifyGDATSubscribers(shard string, gameID string) {
+	var subscribers []*GameSpy.Client
+
+	tM.gdatSubscriptionsMutex.Lock()
+	for client, subscribedGameID := range tM.gdatSubscriptions {
+		if subscribedGameID == gameID && client.State.Shard == shard {
+			subscribers = append(subscribers, client)
+		}
+	}
+	tM.gdatSubscriptionsMutex.Unlock()
+
+	if len(subscribers) == 0 {
+		return
+	}
+
+	answer := tM.gameData(shard, gameID)
+	answer["TID"] = "0"
+
+	for _, client := range subscribers {
+		if !client.IsActive {
+			tM.unsubscribeGDAT(client)
+			continue
+		}
+		answer["B-U-map_name"] = tM.mapDisplayName(clientLocale(client.State.Locale), answer["B-U-map"])
+		client.WriteFESL("GDAT", answer, 0x0)
+	}
+	tM.logAnswer("GDAT", answer, 0x0)
+}
@@ -0,0 +1,43 @@
+package theater
+
+import "testing"
+
+func TestGSUBReceivesGDATOnUGAM(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("gdata:1", "AP", "3")
+
+	client, conn := newTestClient(t)
+	defer conn.Close()
+	server, serverConn := newTestClient(t)
+	defer serverConn.Close()
+
+	go tM.GSUB(testCommand(client, "GSUB", map[string]string{"TID": "6", "GID": "1"}))
+	query, answer := readTestPacket(t, conn)
+	if query != "GSUB" || answer["GID"] != "1" {
+		t.Fatalf("GSUB was incorrect, got: %s %v", query, answer)
+	}
+
+	go tM.UGAM(testCommand(server, "UGAM", map[string]string{"TID": "7", "GID": "1", "AP": "\"4\""}))
+	query, answer = readTestPacket(t, conn)
+	if query != "GDAT" {
+		t.Fatalf("GSUB was incorrect, got query: %s, want: %s.", query, "GDAT")
+	}
+	if answer["AP"] != "4" || answer["GID"] != "1" {
+		t.Errorf("GSUB was incorrect, got: %v", answer)
+	}
+
+	// Unsubscribed clients don't get updates anymore
+	go tM.GSUB(testCommand(client, "GSUB", map[string]string{"TID": "8", "GID": ""}))
+	readTestPacket(t, conn)
+
+	tM.UGAM(testCommand(server, "UGAM", map[string]string{"TID": "9", "GID": "1", "AP": "5"}))
+	tM.gdatSubscriptionsMutex.Lock()
+	gameID, ok := tM.gdatSubscriptions[client]
+	tM.gdatSubscriptionsMutex.Unlock()
+	if ok {
+		t.Errorf("GSUB was incorrect, client still subscribed to %s", gameID)
+	}
+}
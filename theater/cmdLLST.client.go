@@ -1,33 +1,42 @@
 package theater
 
 import (
+	"strconv"
+
 	"github.com/HeroesAwaken/GoFesl/GameSpy"
 	"github.com/HeroesAwaken/GoFesl/log"
 )
 
-// LLST - CLIENT (???) unknown, potentially bookmarks
+// LLST - CLIENT called to get the list of lobbies, followed by a LDAT for
+// every lobby
 func (tM *TheaterManager) LLST(event GameSpy.EventClientFESLCommand) {
 	if !event.Client.IsActive {
 		log.Noteln("Client left")
 		return
 	}
 
+	// Validated at startup, so there are at most MaxLobbies
+	lobbies := tM.config.Lobbies
+	gameCounts := tM.lobbyGameCounts(event.Client.State.Shard)
+
 	answer := make(map[string]string)
 	answer["TID"] = event.Command.Message["TID"]
-	answer["NUM-LOBBIES"] = "1"
+	answer["NUM-LOBBIES"] = strconv.Itoa(len(lobbies))
 	event.Client.WriteFESL(event.Command.Query, answer, 0x0)
+	tM.logAnswer(event.Command.Query, answer, 0x0)
 
-	// Todo: create dataset for lobbies, iterate through and send one for each lobby (LDAT>)()
-	ldatPacket := make(map[string]string)
-	ldatPacket["TID"] = "5"
-	ldatPacket["FAVORITE-GAMES"] = "0"
-	ldatPacket["FAVORITE-PLAYERS"] = "0"
-	ldatPacket["LID"] = "1"
-	ldatPacket["LOCALE"] = "en_US"
-	ldatPacket["MAX-GAMES"] = "10000"
-	ldatPacket["NAME"] = "bfwestPC02"
-	ldatPacket["NUM-GAMES"] = "1"
-	ldatPacket["PASSING"] = "0"
-	event.Client.WriteFESL("LDAT", ldatPacket, 0x0)
-	tM.logAnswer("LDAT", ldatPacket, 0x0)
+	for _, lobby := range lobbies {
+		ldatPacket := make(map[string]string)
+		ldatPacket["TID"] = event.Command.Message["TID"]
+		ldatPacket["FAVORITE-GAMES"] = "0"
+		ldatPacket["FAVORITE-PLAYERS"] = "0"
+		ldatPacket["LID"] = lobby.ID
+		ldatPacket["LOCALE"] = lobby.Locale
+		ldatPacket["MAX-GAMES"] = strconv.Itoa(lobby.MaxGames)
+		ldatPacket["NAME"] = lobby.Name
+		ldatPacket["NUM-GAMES"] = strconv.Itoa(gameCounts[lobby.ID])
+		ldatPacket["PASSING"] = "0"
+		event.Client.WriteFESL("LDAT", ldatPacket, 0x0)
+		tM.logAnswer("LDAT", ldatPacket, 0x0)
+	}
 }
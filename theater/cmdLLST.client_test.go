@@ -0,0 +1,58 @@
+package theater
+
+import "testing"
+
+func TestValidateLobbies(t *testing.T) {
+	tables := []struct {
+		lobbies    []Lobby
+		maxLobbies int
+		valid      bool
+	}{
+		{[]Lobby{{ID: "1"}, {ID: "2"}}, 16, true},
+		{[]Lobby{{ID: "1"}, {ID: "2"}}, 2, true},
+		{[]Lobby{{ID: "1"}, {ID: "2"}}, 1, false},
+		{[]Lobby{}, 16, false},
+		{[]Lobby{{ID: "1"}, {ID: "1"}}, 16, false},
+		{[]Lobby{{ID: "", Name: "bfwestPC02"}}, 16, false},
+	}
+
+	for i, table := range tables {
+		if err := ValidateLobbies(table.lobbies, table.maxLobbies); (err == nil) != table.valid {
+			t.Errorf("ValidateLobbies %d was incorrect, got error: %v, want valid: %t.", i, err, table.valid)
+		}
+	}
+}
+
+func TestLLSTCountsGamesPerLobby(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.config.Lobbies = []Lobby{
+		{ID: "1", Name: "bfwestPC02", Locale: "en_US", MaxGames: 10000},
+		{ID: "2", Name: "bfeuPC01", Locale: "de_DE", MaxGames: 500},
+		{ID: "3", Name: "bfeuPC02", Locale: "de_DE", MaxGames: 500},
+	}
+
+	tM.redis.HSet("gdata:1", "LID", "1")
+	tM.redis.HSet("gdata:2", "LID", "2")
+	tM.redis.HSet("gdata:3", "LID", "2")
+	// Unknown lobbies count towards the first one
+	tM.redis.HSet("gdata:4", "LID", "9")
+
+	client, conn := newTestClient(t)
+	defer conn.Close()
+	go tM.LLST(testCommand(client, "LLST", map[string]string{"TID": "3"}))
+
+	_, answer := readTestPacket(t, conn)
+	if answer["NUM-LOBBIES"] != "3" {
+		t.Errorf("LLST was incorrect, got NUM-LOBBIES: %s, want: %s.", answer["NUM-LOBBIES"], "3")
+	}
+
+	want := map[string]string{"1": "2", "2": "2", "3": "0"}
+	for range tM.config.Lobbies {
+		_, ldat := readTestPacket(t, conn)
+		if ldat["NUM-GAMES"] != want[ldat["LID"]] {
+			t.Errorf("LDAT for lobby %s was incorrect, got NUM-GAMES: %s, want: %s.", ldat["LID"], ldat["NUM-GAMES"], want[ldat["LID"]])
+		}
+	}
+}
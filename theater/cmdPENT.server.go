@@ -3,6 +3,7 @@ package theater
 import (
 	"github.com/HeroesAwaken/GoFesl/GameSpy"
 	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/HeroesAwaken/GoFesl/metrics"
 )
 
 // PENT - SERVER sent up when a player joins (entitle player?)
@@ -13,33 +14,34 @@ func (tM *TheaterManager) PENT(event GameSpy.EventClientFESLCommand) {
 
 	pid := event.Command.Message["PID"]
 
-	// Get 4 stats for PID
-	rows, err := tM.getStatsStatement(4).Query(pid, "c_kit", "c_team", "elo", "level")
-	if err != nil {
-		log.Errorln("Failed gettings stats for hero "+pid, err.Error())
-	}
+	metrics.PlayersEntered.Inc()
+	tM.finishJoin(event.Client.State.Shard, event.Command.Message["GID"], pid)
 
-	stats := make(map[string]string)
+	if tM.isObserver(event.Client.State.Shard, event.Command.Message["GID"], pid) {
+		answer := make(map[string]string)
+		answer["TID"] = event.Command.Message["TID"]
+		answer["PID"] = pid
+		event.Client.WriteFESL("PENT", answer, 0x0)
+		return
+	}
 
-	for rows.Next() {
-		var userID, heroID, heroName, statsKey, statsValue string
-		err := rows.Scan(&userID, &heroID, &heroName, &statsKey, &statsValue)
-		if err != nil {
-			log.Errorln("Issue with database:", err.Error())
-		}
-		stats[statsKey] = statsValue
+	stats, err := tM.playerStats(statsTable(event.Client), pid)
+	if err != nil {
+		log.Errorln("Failed gettings stats for hero "+pid, err.Error())
+		tM.writeError(event.Client, "PENT", event.Command.Message["TID"], GameSpy.ErrorCodeInternal, "The player couldn't be loaded.")
+		return
 	}
 
 	switch stats["c_team"] {
 	case "1":
-		_, err = tM.stmtGameIncreaseTeam1.Exec(event.Command.Message["GID"], Shard)
+		_, err = tM.stmtGameIncreaseTeam1.Exec(event.Command.Message["GID"], dbShard(event.Client.State.Shard))
 		if err != nil {
-			log.Panicln(err)
+			log.Errorln("Failed adding "+pid+" to team 1 of "+event.Command.Message["GID"], err.Error())
 		}
 	case "2":
-		_, err = tM.stmtGameIncreaseTeam2.Exec(event.Command.Message["GID"], Shard)
+		_, err = tM.stmtGameIncreaseTeam2.Exec(event.Command.Message["GID"], dbShard(event.Client.State.Shard))
 		if err != nil {
-			log.Panicln(err)
+			log.Errorln("Failed adding "+pid+" to team 2 of "+event.Command.Message["GID"], err.Error())
 		}
 	default:
 		log.Errorln("Invalid team " + stats["c_team"] + " for " + pid)
@@ -0,0 +1,38 @@
+package theater
+
+import (
+	"time"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+)
+
+// heartbeatInterval is how often clients get pinged and checked for idling
+var heartbeatInterval = time.Second * 15
+
+// heartbeatTID is the TID of our heartbeat PINGs, which clients answer with
+const heartbeatTID = "0"
+
+// PING - SHARED keepalive sent by the client, or its answer to ours
+func (tM *TheaterManager) PING(event GameSpy.EventClientFESLCommand) {
+	if !event.Client.IsActive {
+		return
+	}
+
+	event.Client.Touch()
+
+	// Answering the answers to our heartbeat would ping-pong forever
+	if !tM.config.AnswerPing || event.Command.Message["TID"] == heartbeatTID {
+		return
+	}
+
+	answer := make(map[string]string)
+	answer["TID"] = event.Command.Message["TID"]
+	event.Client.WriteFESL("PING", answer, 0x0)
+	tM.logAnswer("PING", answer, 0x0)
+}
+
+// isIdle tells whether a client has been quiet for longer than the
+// IdleTimeout
+func (tM *TheaterManager) isIdle(client *GameSpy.Client, now time.Time) bool {
+	return tM.config.IdleTimeout > 0 && now.Sub(client.LastActivity()) > tM.config.IdleTimeout
+}
@@ -0,0 +1,80 @@
+package theater
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+)
+
+func TestPINGKeepsClientAlive(t *testing.T) {
+	heartbeatInterval = time.Millisecond * 10
+	defer func() { heartbeatInterval = time.Second * 15 }()
+
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+	tM.config.IdleTimeout = time.Millisecond * 100
+
+	recorder := new(GameSpy.Recorder)
+	client := new(GameSpy.Client)
+	events := client.NewWithWriter("test", recorder)
+	tM.newClient(GameSpy.EventNewClient{Client: client})
+	defer stopHeartbeat(client)
+
+	// Quiet apart from keepalives for well over the idle timeout
+	for i := 0; i < 10; i++ {
+		started := client.LastActivity()
+		tM.PING(testCommand(client, "PING", map[string]string{"TID": "0"}))
+		if !client.LastActivity().After(started) {
+			t.Fatalf("PING was incorrect, the idle timer wasn't reset.")
+		}
+		time.Sleep(time.Millisecond * 30)
+	}
+
+	// The heartbeat closes the client, which is only seen through its events
+	// as the heartbeat goroutine does the closing
+	select {
+	case event := <-events:
+		t.Fatalf("PING was incorrect, got event: %s despite keepalives.", event.Name)
+	default:
+	}
+
+	select {
+	case event := <-events:
+		if event.Name != "close" {
+			t.Errorf("PING was incorrect, got event: %s, want: %s.", event.Name, "close")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("PING was incorrect, the idle client didn't get disconnected.")
+	}
+
+	if packets := recorder.Packets(); len(packets) == 0 || packets[0].Message["TID"] != heartbeatTID {
+		t.Errorf("PING was incorrect, got: %v, want heartbeat PINGs.", packets)
+	}
+}
+
+func TestPINGAnswer(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	client, recorder := newRecordedClient()
+
+	tM.PING(testCommand(client, "PING", map[string]string{"TID": "3"}))
+	if packets := recorder.Packets(); len(packets) != 0 {
+		t.Errorf("PING was incorrect, got: %v, want no answer.", packets)
+	}
+
+	tM.config.AnswerPing = true
+
+	tM.PING(testCommand(client, "PING", map[string]string{"TID": "3"}))
+	packets := recorder.Packets()
+	if len(packets) != 1 || packets[0].Type != "PING" || packets[0].Message["TID"] != "3" {
+		t.Errorf("PING was incorrect, got: %v, want a PING with TID 3.", packets)
+	}
+
+	// Answers to our heartbeat don't get answered again
+	tM.PING(testCommand(client, "PING", map[string]string{"TID": heartbeatTID}))
+	if packets := recorder.Packets(); len(packets) != 1 {
+		t.Errorf("PING was incorrect, got: %v, want no answer to a heartbeat answer.", packets)
+	}
+}
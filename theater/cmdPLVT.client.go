@@ -12,39 +12,40 @@ func (tM *TheaterManager) PLVT(event GameSpy.EventClientFESLCommand) {
 	}
 
 	pid := event.Command.Message["PID"]
+	tM.playerLeft(event.Client.State.Shard, event.Command.Message["GID"], pid)
 
-	// Get 4 stats for PID
-	rows, err := tM.getStatsStatement(4).Query(pid, "c_kit", "c_team", "elo", "level")
-	if err != nil {
-		log.Errorln("Failed gettings stats for hero "+pid, err.Error())
+	if tM.removeObserver(event.Client.State.Shard, event.Command.Message["GID"], pid) {
+		tM.answerPLVT(event)
+		return
 	}
 
-	stats := make(map[string]string)
-
-	for rows.Next() {
-		var userID, heroID, heroName, statsKey, statsValue string
-		err := rows.Scan(&userID, &heroID, &heroName, &statsKey, &statsValue)
-		if err != nil {
-			log.Errorln("Issue with database:", err.Error())
-		}
-		stats[statsKey] = statsValue
+	stats, err := tM.playerStats(statsTable(event.Client), pid)
+	if err != nil {
+		log.Errorln("Failed gettings stats for hero "+pid, err.Error())
+		tM.writeError(event.Client, "PLVT", event.Command.Message["TID"], GameSpy.ErrorCodeInternal, "The player couldn't be loaded.")
+		return
 	}
 
 	switch stats["c_team"] {
 	case "1":
-		_, err = tM.stmtGameDecreaseTeam1.Exec(event.Command.Message["GID"], Shard)
+		_, err = tM.stmtGameDecreaseTeam1.Exec(event.Command.Message["GID"], dbShard(event.Client.State.Shard))
 		if err != nil {
-			log.Panicln(err)
+			log.Errorln("Failed removing "+pid+" from team 1 of "+event.Command.Message["GID"], err.Error())
 		}
 	case "2":
-		_, err = tM.stmtGameDecreaseTeam2.Exec(event.Command.Message["GID"], Shard)
+		_, err = tM.stmtGameDecreaseTeam2.Exec(event.Command.Message["GID"], dbShard(event.Client.State.Shard))
 		if err != nil {
-			log.Panicln(err)
+			log.Errorln("Failed removing "+pid+" from team 2 of "+event.Command.Message["GID"], err.Error())
 		}
 	default:
 		log.Errorln("Invalid team " + stats["c_team"] + " for " + pid)
 	}
 
+	tM.answerPLVT(event)
+}
+
+// answerPLVT tells the server a player is gone and acknowledges the PLVT
+func (tM *TheaterManager) answerPLVT(event GameSpy.EventClientFESLCommand) {
 	answer := make(map[string]string)
 	answer["PID"] = event.Command.Message["PID"]
 	answer["LID"] = event.Command.Message["LID"]
@@ -20,7 +20,7 @@ func (tM *TheaterManager) UBRA(event GameSpy.EventClientFESLCommand) {
 	tM.logAnswer(event.Command.Query, answer, 0x0)
 
 	gdata := new(lib.RedisObject)
-	gdata.New(tM.redis, "gdata", event.Command.Message["GID"])
+	gdata.New(tM.redis, gameDataPrefix(event.Client.State.Shard), event.Command.Message["GID"])
 
 	if event.Command.Message["START"] == "1" {
 		gdata.Set("AP", "0")
@@ -1,6 +1,8 @@
 package theater
 
 import (
+	"strings"
+
 	"github.com/HeroesAwaken/GoFesl/GameSpy"
 
 	"github.com/HeroesAwaken/GoFesl/lib"
@@ -17,46 +19,59 @@ func (tM *TheaterManager) UGAM(event GameSpy.EventClientFESLCommand) {
 	gameID := event.Command.Message["GID"]
 
 	gdata := new(lib.RedisObject)
-	gdata.New(tM.redis, "gdata", gameID)
+	gdata.New(tM.redis, gameDataPrefix(event.Client.State.Shard), gameID)
 
 	log.Noteln("Updating GameServer " + gameID)
 
-	var args []interface{}
-
-	keys := 0
 	for index, value := range event.Command.Message {
-		if index == "TID" {
+		if !storedInRedis(index) {
 			continue
 		}
 
-		keys++
+		value = GameSpy.StripQuotes(value)
 
-		// Strip quotes
-		if len(value) > 0 && value[0] == '"' {
-			value = value[1:]
-		}
-		if len(value) > 0 && value[len(value)-1] == '"' {
-			value = value[:len(value)-1]
+		if index == "NAME" {
+			renamed, ok := tM.renameGameServer(event.Client.State.Shard, gameID, gdata, value)
+			if !ok {
+				continue
+			}
+			value = renamed
 		}
 
 		gdata.Set(index, value)
-		args = append(args, gameID)
-		args = append(args, index)
-		args = append(args, value)
+		if index == dataCenterKey {
+			tM.rememberRegion(gdata)
+		}
+
+		// Written to the db with the next batchTicker flush
+		if storedInDB(index) {
+			tM.queueServerStats(event.Client.State.Shard, gameID, index, value)
+		}
 	}
-	_, err := tM.stmtUpdateGame.Exec(event.Command.Message["GID"], Shard)
-	if err != nil {
-		log.Panicln(err)
+
+	tM.notifyGDATSubscribers(event.Client.State.Shard, gameID)
+}
+
+// renameGameServer applies the ServerNamePolicy to a new name of a game
+// server, like CGAM does. Returns false if the name is taken.
+func (tM *TheaterManager) renameGameServer(shard string, gameID string, gdata *lib.RedisObject, name string) (string, bool) {
+	tM.serverNamesMutex.Lock()
+	defer tM.serverNamesMutex.Unlock()
+
+	previous := gdata.Get("NAME")
+	if strings.EqualFold(previous, name) {
+		return name, true
 	}
 
-	_, err = tM.setServerStatsStatement(keys).Exec(args...)
+	renamed, err := tM.claimServerName(shard, gameID, name)
 	if err != nil {
-		log.Errorln("Failed to update stats for game server "+gameID, err.Error())
-		if err.Error() == "Error 1213: Deadlock found when trying to get lock; try restarting transaction" {
-			_, err = tM.setServerStatsStatement(keys).Exec(args...)
-			if err != nil {
-				log.Errorln("Failed to update stats for game server "+gameID+" on the second try", err.Error())
-			}
-		}
+		log.Noteln("Not renaming game server " + gameID + " to " + name + ", the name is taken")
+		return "", false
 	}
+
+	// Stored right away, so the old name is free once it's released
+	gdata.Set("NAME", renamed)
+	tM.releaseServerName(shard, gameID, previous)
+
+	return renamed, true
 }
@@ -0,0 +1,42 @@
+package theater
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUGAMStoredKeys(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	server, _ := newRecordedClient()
+
+	tM.UGAM(testCommand(server, "UGAM", map[string]string{
+		"TID":          "7",
+		"TXN":          "UpdateGame",
+		"GID":          "1",
+		"NAME":         "\"Server\"",
+		"B-U-map":      "\"village\"",
+		"B-U-password": "secret",
+	}))
+
+	redisKeys := tM.redis.HGetAll("gdata:1").Val()
+	wantRedis := map[string]string{
+		"GID":          "1",
+		"NAME":         "Server",
+		"B-U-map":      "village",
+		"B-U-password": "secret",
+	}
+	if !reflect.DeepEqual(redisKeys, wantRedis) {
+		t.Errorf("UGAM redis keys were incorrect, got: %v, want: %v.", redisKeys, wantRedis)
+	}
+
+	dbKeys := tM.pendingServerStats[serverRef{"", "1"}]
+	wantDB := map[string]string{
+		"NAME":    "Server",
+		"B-U-map": "village",
+	}
+	if !reflect.DeepEqual(dbKeys, wantDB) {
+		t.Errorf("UGAM db keys were incorrect, got: %v, want: %v.", dbKeys, wantDB)
+	}
+}
@@ -28,13 +28,7 @@ func (tM *TheaterManager) UPLA(event GameSpy.EventClientFESLCommand) {
 
 		keys++
 
-		// Strip quotes
-		if len(value) > 0 && value[0] == '"' {
-			value = value[1:]
-		}
-		if len(value) > 0 && value[len(value)-1] == '"' {
-			value = value[:len(value)-1]
-		}
+		value = GameSpy.StripQuotes(value)
 
 		args = append(args, gid)
 		args = append(args, pid)
@@ -48,8 +42,13 @@ func (tM *TheaterManager) UPLA(event GameSpy.EventClientFESLCommand) {
 		log.Errorln("Failed to update stats for player "+pid, err.Error())
 	}
 
+	// Observers count towards B-numObservers instead
+	if tM.isObserver(event.Client.State.Shard, gid, pid) {
+		return
+	}
+
 	gdata := new(lib.RedisObject)
-	gdata.New(tM.redis, "gdata", event.Command.Message["GID"])
+	gdata.New(tM.redis, gameDataPrefix(event.Client.State.Shard), event.Command.Message["GID"])
 
 	num, _ := strconv.Atoi(gdata.Get("AP"))
 
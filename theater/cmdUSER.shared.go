@@ -14,16 +14,22 @@ func (tM *TheaterManager) USER(event GameSpy.EventClientFESLCommand) {
 		return
 	}
 
+	lkey := GameSpy.StripQuotes(event.Command.Message["LKEY"])
+
 	lkeyRedis := new(lib.RedisObject)
-	lkeyRedis.New(tM.redis, "lkeys", event.Command.Message["LKEY"])
+	lkeyRedis.New(tM.redis, "lkeys", lkey)
 
 	redisState := new(core.RedisState)
-	redisState.New(tM.redis, "mm:"+event.Command.Message["LKEY"])
+	redisState.New(tM.redis, "mm:"+lkey)
 	event.Client.RedisState = redisState
 
 	redisState.Set("id", lkeyRedis.Get("id"))
 	redisState.Set("userID", lkeyRedis.Get("userID"))
 	redisState.Set("name", lkeyRedis.Get("name"))
+	redisState.Set("clientString", lkeyRedis.Get("clientString"))
+
+	// Clients only ever see servers of their own shard
+	event.Client.State.Shard = shardForAddr(event.Client.IpAddr)
 
 	answer := make(map[string]string)
 	answer["TID"] = event.Command.Message["TID"]
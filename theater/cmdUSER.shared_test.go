@@ -0,0 +1,64 @@
+package theater
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUSER(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("lkeys:abc", "id", "7")
+	tM.redis.HSet("lkeys:abc", "userID", "42")
+	tM.redis.HSet("lkeys:abc", "name", "Hero")
+
+	tables := []struct {
+		message map[string]string
+		answer  map[string]string
+		userID  string
+	}{
+		{
+			map[string]string{"TID": "3", "LKEY": "abc"},
+			map[string]string{"TID": "3", "NAME": "Hero", "CID": ""},
+			"42",
+		},
+		{
+			map[string]string{"TID": "4", "LKEY": "unknown"},
+			map[string]string{"TID": "4", "NAME": "", "CID": ""},
+			"",
+		},
+	}
+
+	for _, table := range tables {
+		client, recorder := newRecordedClient()
+
+		tM.USER(testCommand(client, "USER", table.message))
+
+		packets := recorder.Packets()
+		if len(packets) != 1 || packets[0].Type != "USER" {
+			t.Fatalf("USER packets were incorrect, got: %v, want: one USER.", packets)
+		}
+		if !reflect.DeepEqual(packets[0].Message, table.answer) {
+			t.Errorf("USER was incorrect, got: %v, want: %v.", packets[0].Message, table.answer)
+		}
+		if client.RedisState.Get("userID") != table.userID {
+			t.Errorf("USER userID was incorrect, got: %s, want: %s.", client.RedisState.Get("userID"), table.userID)
+		}
+	}
+}
+
+func TestUSERQuotedLKEY(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("lkeys:abc", "name", "Hero")
+
+	client, recorder := newRecordedClient()
+	tM.USER(testCommand(client, "USER", map[string]string{"TID": "3", "LKEY": "\"abc\""}))
+
+	packets := recorder.Packets()
+	if len(packets) != 1 || packets[0].Message["NAME"] != "Hero" {
+		t.Errorf("USER with a quoted LKEY was incorrect, got: %v, want NAME: %s.", packets, "Hero")
+	}
+}
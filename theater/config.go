@@ -0,0 +1,179 @@
+package theater
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// Config are the settings of a TheaterManager, from what it hands out to
+// clients and game servers to how it treats them
+type Config struct {
+	// PublicIP is advertised instead of private addresses when the theater
+	// or a game server sits behind a NAT or load balancer. Private addresses
+	// are advertised as they are if it's empty.
+	PublicIP string
+	// DataCenter is reported for servers which didn't advertise their own
+	DataCenter string
+	// ActivityTimeout is how long clients may stay silent, sent in CONN
+	ActivityTimeout time.Duration
+	// JoinTimeout is how long a player may take from EGAM until the server
+	// reports it entered through PENT
+	JoinTimeout time.Duration
+	// IdleTimeout closes clients which sent nothing for that long, 0
+	// disables it
+	IdleTimeout time.Duration
+	// AnswerPing makes the theater answer keepalives sent by clients,
+	// instead of only taking note of them
+	AnswerPing bool
+
+	// Lobbies are advertised through LLST, at most MaxLobbies of them
+	Lobbies    []Lobby
+	MaxLobbies int
+	// AllowCrossLobbyJoins lets clients join games outside of their lobby
+	AllowCrossLobbyJoins bool
+	// ServerNamePolicy is one of ServerNamesAllow, ServerNamesReject or
+	// ServerNamesSuffix
+	ServerNamePolicy string
+	// MaxConcurrentScans limits how many server lists are built from redis
+	// at the same time, so a burst of GLSTs can't starve everything else
+	MaxConcurrentScans int
+
+	// CommandsPerSecond and CommandBurst limit how many commands a client
+	// may send
+	CommandsPerSecond float64
+	CommandBurst      float64
+	// ServerCommandsPerSecond and ServerCommandBurst are the limits for game
+	// servers, which legitimately send frequent UGAM/UBRA updates
+	ServerCommandsPerSecond float64
+	ServerCommandBurst      float64
+	// AnswerRateLimited answers dropped commands with an error instead of
+	// silently ignoring them
+	AnswerRateLimited bool
+
+	// ResolveHostnames makes GDAT only report hostnames which actually
+	// resolve
+	ResolveHostnames bool
+	// Platform is reported for servers which didn't advertise their own
+	Platform string
+	// PlatformNames maps what servers advertise, in lowercase, to what
+	// clients expect in PL
+	PlatformNames map[string]string
+	// MapDisplayNames maps a locale to the display names of the map ids
+	// servers advertise in B-U-map
+	MapDisplayNames map[string]map[string]string
+	// FallbackNickname is used when nothing is left of a nickname after
+	// sanitizing
+	FallbackNickname string
+
+	// Ticket, EncryptionKey and Secret are handed to game servers and the
+	// players joining them, which only pass them on to each other
+	Ticket        string
+	EncryptionKey string
+	Secret        string
+	// HostUserID and XUID identify the host of a game towards its players
+	HostUserID string
+	XUID       string
+
+	// WarmGetStatsKeys are the key counts whose getStats statements get
+	// prepared at startup for every stats table, so the first request of
+	// that size doesn't pay for it
+	WarmGetStatsKeys []int
+	// WarmServerStatsKeys are the amounts of stats game servers usually
+	// send, whose server stats statements get prepared at startup
+	WarmServerStatsKeys []int
+}
+
+// DefaultConfig returns the settings used for anything left unconfigured
+func DefaultConfig() Config {
+	return Config{
+		DataCenter:      "iad",
+		ActivityTimeout: time.Hour,
+		JoinTimeout:     time.Minute,
+
+		Lobbies: []Lobby{
+			{ID: "1", Name: "bfwestPC02", Locale: "en_US", MaxGames: 10000},
+		},
+		MaxLobbies:         16,
+		ServerNamePolicy:   ServerNamesAllow,
+		MaxConcurrentScans: 8,
+
+		CommandsPerSecond:       10,
+		CommandBurst:            20,
+		ServerCommandsPerSecond: 50,
+		ServerCommandBurst:      100,
+
+		Platform: "PC",
+		PlatformNames: map[string]string{
+			"pc":      "PC",
+			"win32":   "PC",
+			"ps3":     "PS3",
+			"xenon":   "XBOX360",
+			"xbox360": "XBOX360",
+		},
+		MapDisplayNames:  map[string]map[string]string{},
+		FallbackNickname: "Hero",
+
+		Ticket:        "2018751182",
+		EncryptionKey: "O65zZ2D2A58mNrZw1hmuJw%3d%3d",
+		Secret:        "2587913",
+		HostUserID:    "1",
+		XUID:          "24",
+	}
+}
+
+// Validate checks for settings a TheaterManager can't work with
+func (config Config) Validate() error {
+	if config.PublicIP != "" && net.ParseIP(config.PublicIP) == nil {
+		return errors.New("invalid PublicIP " + config.PublicIP)
+	}
+	if !dataCenterPattern.MatchString(config.DataCenter) {
+		return errors.New("invalid DataCenter " + config.DataCenter)
+	}
+	if config.ActivityTimeout < time.Second {
+		return errors.New("ActivityTimeout must be at least a second")
+	}
+	if config.JoinTimeout <= 0 {
+		return errors.New("JoinTimeout must be positive")
+	}
+	if config.IdleTimeout < 0 {
+		return errors.New("IdleTimeout can't be negative")
+	}
+
+	if err := ValidateLobbies(config.Lobbies, config.MaxLobbies); err != nil {
+		return err
+	}
+	switch config.ServerNamePolicy {
+	case ServerNamesAllow, ServerNamesReject, ServerNamesSuffix:
+	default:
+		return errors.New("invalid ServerNamePolicy " + config.ServerNamePolicy)
+	}
+	if config.MaxConcurrentScans <= 0 {
+		return errors.New("MaxConcurrentScans must be positive")
+	}
+
+	if config.CommandsPerSecond <= 0 || config.ServerCommandsPerSecond <= 0 {
+		return errors.New("CommandsPerSecond and ServerCommandsPerSecond must be positive")
+	}
+	if config.CommandBurst < 1 || config.ServerCommandBurst < 1 {
+		return errors.New("CommandBurst and ServerCommandBurst must be at least 1")
+	}
+
+	if config.Platform == "" {
+		return errors.New("Platform is missing")
+	}
+	if _, err := ParsePlatformNames(config.PlatformNames); err != nil {
+		return err
+	}
+	if config.FallbackNickname == "" || sanitizeNickname(config.FallbackNickname, "") != config.FallbackNickname {
+		return errors.New("invalid FallbackNickname " + config.FallbackNickname)
+	}
+
+	if config.Ticket == "" || config.EncryptionKey == "" || config.Secret == "" {
+		return errors.New("Ticket, EncryptionKey and Secret are required")
+	}
+	if config.HostUserID == "" || config.XUID == "" {
+		return errors.New("HostUserID and XUID are required")
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package theater
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tables := []struct {
+		change func(*Config)
+		valid  bool
+	}{
+		{func(config *Config) {}, true},
+		{func(config *Config) { config.PublicIP = "203.0.113.5" }, true},
+		{func(config *Config) { config.PublicIP = "theater.example.com" }, false},
+		{func(config *Config) { config.DataCenter = "" }, false},
+		{func(config *Config) { config.ActivityTimeout = 0 }, false},
+		{func(config *Config) { config.JoinTimeout = -time.Second }, false},
+		{func(config *Config) { config.IdleTimeout = -time.Second }, false},
+		{func(config *Config) { config.Lobbies = nil }, false},
+		{func(config *Config) { config.MaxLobbies = 0 }, false},
+		{func(config *Config) { config.ServerNamePolicy = "rename" }, false},
+		{func(config *Config) { config.MaxConcurrentScans = 0 }, false},
+		{func(config *Config) { config.CommandsPerSecond = 0 }, false},
+		{func(config *Config) { config.ServerCommandBurst = 0.5 }, false},
+		{func(config *Config) { config.Platform = "" }, false},
+		{func(config *Config) { config.PlatformNames = map[string]string{"ps3": ""} }, false},
+		{func(config *Config) { config.FallbackNickname = "" }, false},
+		{func(config *Config) { config.FallbackNickname = "Evil\nTICKET=1" }, false},
+		{func(config *Config) { config.Ticket = "" }, false},
+		{func(config *Config) { config.XUID = "" }, false},
+	}
+
+	for i, table := range tables {
+		config := DefaultConfig()
+		table.change(&config)
+
+		if err := config.Validate(); (err == nil) != table.valid {
+			t.Errorf("Validate of config %d was incorrect, got: %v, want valid: %t.", i, err, table.valid)
+		}
+	}
+}
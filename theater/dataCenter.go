@@ -0,0 +1,33 @@
+package theater
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+// dataCenterKey is where servers advertise the data center they run in
+const dataCenterKey = "B-U-data_center"
+
+// regionKey keeps the data center of a server in its game data, checked and
+// lowercased, so servers can be grouped by it
+const regionKey = "REGION"
+
+// dataCenterPattern is what data centers look like, e.g. iad or eu-west
+var dataCenterPattern = regexp.MustCompile("^[a-z0-9-]{1,16}$")
+
+// serverDataCenter returns the data center a game server runs in, falling
+// back to the configured DataCenter when it didn't advertise a valid one
+func (tM *TheaterManager) serverDataCenter(gameServer *lib.RedisObject) string {
+	advertised := strings.ToLower(gameServer.Get(dataCenterKey))
+	if dataCenterPattern.MatchString(advertised) {
+		return advertised
+	}
+	return tM.config.DataCenter
+}
+
+// rememberRegion keeps the data center of a server in its regionKey
+func (tM *TheaterManager) rememberRegion(gameServer *lib.RedisObject) {
+	gameServer.Set(regionKey, tM.serverDataCenter(gameServer))
+}
@@ -0,0 +1,91 @@
+package theater
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+func TestServerDataCenter(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tables := []struct {
+		advertised string
+		want       string
+	}{
+		{"gva", "gva"},
+		{"EU-West", "eu-west"},
+		{"", "iad"},
+		{"gva; drop", "iad"},
+		{"a-data-center-name-too-long", "iad"},
+	}
+
+	for i, table := range tables {
+		gameID := strconv.Itoa(i)
+		if table.advertised != "" {
+			tM.redis.HSet("gdata:"+gameID, dataCenterKey, table.advertised)
+		}
+
+		gameServer := new(lib.RedisObject)
+		gameServer.New(tM.redis, "gdata", gameID)
+
+		if dataCenter := tM.serverDataCenter(gameServer); dataCenter != table.want {
+			t.Errorf("serverDataCenter(%q) was incorrect, got: %s, want: %s.", table.advertised, dataCenter, table.want)
+		}
+	}
+}
+
+func TestGDATDataCenter(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("gdata:1", dataCenterKey, "GVA")
+	tM.redis.HSet("gdata:2", "GID", "2")
+
+	if dataCenter := tM.gameData("", "1")[dataCenterKey]; dataCenter != "gva" {
+		t.Errorf("gameData data center of a server advertising one was incorrect, got: %s, want: %s.", dataCenter, "gva")
+	}
+	if dataCenter := tM.gameData("", "2")[dataCenterKey]; dataCenter != "iad" {
+		t.Errorf("gameData data center of a server advertising none was incorrect, got: %s, want: %s.", dataCenter, "iad")
+	}
+}
+
+func TestUGAMRemembersRegion(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	server, _ := newRecordedClient()
+
+	tM.UGAM(testCommand(server, "UGAM", map[string]string{
+		"TID":         "7",
+		"GID":         "1",
+		dataCenterKey: "\"AMS\"",
+	}))
+
+	if region := tM.redis.HGet("gdata:1", regionKey).Val(); region != "ams" {
+		t.Errorf("UGAM region was incorrect, got: %s, want: %s.", region, "ams")
+	}
+}
+
+func TestUGAMKeepsRegionTheaterOwned(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("gdata:1", regionKey, "gva")
+
+	server, _ := newRecordedClient()
+
+	tM.UGAM(testCommand(server, "UGAM", map[string]string{
+		"TID":     "7",
+		"GID":     "1",
+		regionKey: "\"ams\"",
+	}))
+
+	if region := tM.redis.HGet("gdata:1", regionKey).Val(); region != "gva" {
+		t.Errorf("UGAM region sent by the server was incorrect, got: %s, want: %s.", region, "gva")
+	}
+}
@@ -0,0 +1,14 @@
+package theater
+
+import "github.com/HeroesAwaken/GoFesl/GameSpy"
+
+// writeError answers the command query with tid with an error, see the
+// GameSpy.ErrorCode constants for the codes
+func (tM *TheaterManager) writeError(client *GameSpy.Client, query string, tid string, code string, message string) {
+	answer := make(map[string]string)
+	answer["TID"] = tid
+	answer["errorCode"] = code
+	answer["localizedMessage"] = "\"" + message + "\""
+	client.WriteFESL(query, answer, 0x0)
+	tM.logAnswer(query, answer, 0x0)
+}
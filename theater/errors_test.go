@@ -0,0 +1,27 @@
+package theater
+
+import "testing"
+
+func TestEGAMServerGone(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	expectJoin(t, tM, "Joiner")
+
+	// Known to redis, but its connection is gone
+	tM.redis.HSet("gdata:1", "GID", "1")
+
+	client, recorder := newJoiningClient(tM)
+	tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "4", "GID": "1", "PORT": "40000"}))
+
+	packets := recorder.Packets()
+	if len(packets) != 1 || packets[0].Type != "EGAM" {
+		t.Fatalf("EGAM packets were incorrect, got: %v, want: one EGAM.", packets)
+	}
+	if packets[0].Message["errorCode"] != "111" || packets[0].Message["TID"] != "4" {
+		t.Errorf("EGAM was incorrect, got: %v, want errorCode: %s for TID: %s.", packets[0].Message, "111", "4")
+	}
+	if client.State.GameID != "" {
+		t.Errorf("EGAM was incorrect, client joined %s.", client.State.GameID)
+	}
+}
@@ -0,0 +1,37 @@
+package theater
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+)
+
+func TestHeartbeatStopsOnClose(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	baseline := runtime.NumGoroutine()
+
+	for i := 0; i < 100; i++ {
+		client, conn := newTestClient(t)
+		tM.newClient(GameSpy.EventNewClient{Client: client})
+		conn.Close()
+		if i%2 == 0 {
+			tM.close(GameSpy.EventClientClose{Client: client})
+		} else {
+			tM.error(GameSpy.EventClientError{Client: client, Error: errors.New("connection reset")})
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if runtime.NumGoroutine() > baseline {
+		t.Errorf("Heartbeat was incorrect, got goroutines: %d, want: %d.", runtime.NumGoroutine(), baseline)
+	}
+}
@@ -0,0 +1,161 @@
+package theater
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/lib"
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+)
+
+// TestMain runs the tests in a temporary directory, which is where answers
+// logged by the handlers end up. Handlers may still be logging after their
+// test is done, so it's only removed once all tests ran.
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "theater")
+	if err != nil {
+		panic(err)
+	}
+	os.Chdir(dir)
+
+	code := m.Run()
+
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestTheater returns a TheaterManager backed by an in-memory redis
+func newTestTheater(t *testing.T) (*TheaterManager, func()) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Starting miniredis failed: %s", err)
+	}
+
+	tM := new(TheaterManager)
+	tM.redis = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	tM.config = DefaultConfig()
+	tM.advertisedPorts = make(map[string]map[*GameSpy.Client]string)
+	tM.pendingServerStats = make(map[serverRef]map[string]string)
+	tM.pendingJoins = make(map[joinRef]*pendingJoin)
+	tM.gdatSubscriptions = make(map[*GameSpy.Client]string)
+	tM.rateLimits = make(map[*GameSpy.Client]*tokenBucket)
+	tM.scanSlots = make(chan struct{}, tM.config.MaxConcurrentScans)
+
+	return tM, func() {
+		mr.Close()
+	}
+}
+
+// newTestClient returns a client whose answers can be read from conn. It
+// waits for the read loop of the client to take a first message, like
+// handlers only run after the loop passed them a command, so tests can run
+// handlers right away.
+func newTestClient(t *testing.T) (*GameSpy.Client, net.Conn) {
+	server, conn := net.Pipe()
+
+	client := new(GameSpy.Client)
+	events, err := client.New("test", &server)
+	if err != nil {
+		t.Fatalf("Creating client failed: %s", err)
+	}
+
+	if _, err := conn.Write([]byte("\\ready\\final\\")); err != nil {
+		t.Fatalf("Writing to client failed: %s", err)
+	}
+	if event := <-events; event.Name != "data" {
+		t.Fatalf("Reading from client was incorrect, got: %s, want: %s.", event.Name, "data")
+	}
+
+	return client, conn
+}
+
+// newRecordedClient returns a client whose answers are captured by recorder
+func newRecordedClient() (*GameSpy.Client, *GameSpy.Recorder) {
+	recorder := new(GameSpy.Recorder)
+
+	client := new(GameSpy.Client)
+	client.NewWithWriter("test", recorder)
+
+	return client, recorder
+}
+
+// newTestDB gives tM a mocked database
+func newTestDB(t *testing.T, tM *TheaterManager) sqlmock.Sqlmock {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Creating sqlmock failed: %s", err)
+	}
+	tM.db = new(lib.DB)
+	tM.db.New(db, 0)
+	tM.prepareStatsStatements()
+
+	return mock
+}
+
+// expectJoin gives tM a mocked database answering the queries of one EGAM by
+// hero 7 of user 42
+func expectJoin(t *testing.T, tM *TheaterManager, heroName string) sqlmock.Sqlmock {
+	mock := newTestDB(t, tM)
+	mock.ExpectPrepare("SELECT count").ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	tM.bans = new(lib.BanChecker)
+	if err := tM.bans.New(tM.db.Conn(), time.Minute); err != nil {
+		t.Fatalf("Preparing bans failed: %s", err)
+	}
+
+	rows := sqlmock.NewRows([]string{"user_id", "id", "heroName", "statsKey", "statsValue"}).
+		AddRow("42", "7", heroName, "elo", "1200")
+	mock.ExpectPrepare("SELECT game_heroes").ExpectQuery().WillReturnRows(rows)
+
+	return mock
+}
+
+// newJoiningClient returns a recorded client logged in as hero 7 of user 42
+func newJoiningClient(tM *TheaterManager) (*GameSpy.Client, *GameSpy.Recorder) {
+	client, recorder := newRecordedClient()
+	client.IpAddr = &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 40000}
+	client.RedisState = new(core.RedisState)
+	client.RedisState.New(tM.redis, "mm:test")
+	client.RedisState.Set("id", "7")
+	client.RedisState.Set("userID", "42")
+	client.State.LobbyID = "1"
+
+	return client, recorder
+}
+
+// readTestPacket reads and decodes the next FESL packet written to a client
+func readTestPacket(t *testing.T, conn net.Conn) (string, map[string]string) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatalf("Reading packet header failed: %s", err)
+	}
+
+	var length uint32
+	binary.Read(bytes.NewReader(header[8:]), binary.BigEndian, &length)
+
+	payload := make([]byte, length-12)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		t.Fatalf("Reading packet payload failed: %s", err)
+	}
+
+	return string(header[:4]), GameSpy.ProcessFESL(string(bytes.TrimRight(payload, "\x00")))
+}
+
+func testCommand(client *GameSpy.Client, query string, message map[string]string) GameSpy.EventClientFESLCommand {
+	return GameSpy.EventClientFESLCommand{
+		Client: client,
+		Command: &GameSpy.CommandFESL{
+			Query:   query,
+			Message: message,
+		},
+	}
+}
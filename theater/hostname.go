@@ -0,0 +1,104 @@
+package theater
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HeroesAwaken/GoFesl/log"
+)
+
+const maxHostnameLength = 253
+
+const (
+	// hostnameCacheTTL is how long the result of resolving a hostname is kept
+	hostnameCacheTTL = time.Minute * 5
+	// maxCachedHostnames bounds the cache, expired results are dropped
+	// once it's reached
+	maxCachedHostnames = 4096
+)
+
+// lookupHost resolves hostnames, replaced in tests
+var lookupHost = net.LookupHost
+
+// resolvedHostname is the cached result of resolving a hostname
+type resolvedHostname struct {
+	resolves bool
+	expires  time.Time
+}
+
+var (
+	resolvedHostnames      = make(map[string]resolvedHostname)
+	resolvedHostnamesMutex sync.Mutex
+)
+
+// hostnameResolves tells whether hostname resolves, looking it up at most
+// once per hostnameCacheTTL
+func hostnameResolves(hostname string) bool {
+	now := time.Now()
+
+	resolvedHostnamesMutex.Lock()
+	cached, ok := resolvedHostnames[hostname]
+	resolvedHostnamesMutex.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.resolves
+	}
+
+	_, err := lookupHost(hostname)
+	resolves := err == nil
+
+	resolvedHostnamesMutex.Lock()
+	defer resolvedHostnamesMutex.Unlock()
+
+	if len(resolvedHostnames) >= maxCachedHostnames {
+		for other, result := range resolvedHostnames {
+			if now.After(result.expires) {
+				delete(resolvedHostnames, other)
+			}
+		}
+		if len(resolvedHostnames) >= maxCachedHostnames {
+			resolvedHostnames = make(map[string]resolvedHostname)
+		}
+	}
+	resolvedHostnames[hostname] = resolvedHostname{resolves, now.Add(hostnameCacheTTL)}
+
+	return resolves
+}
+
+// normalizeHostname lowercases a server-advertised hostname and replaces
+// everything that isn't valid in a hostname. Falls back to ip if nothing
+// usable is left, or if it doesn't resolve while ResolveHostnames is set.
+func (tM *TheaterManager) normalizeHostname(hostname string, ip string) string {
+	hostname = strings.ToLower(strings.Trim(strings.TrimSpace(hostname), "\"."))
+
+	normalized := make([]byte, 0, len(hostname))
+	for i := 0; i < len(hostname) && len(normalized) < maxHostnameLength; i++ {
+		c := hostname[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '.', c == '-':
+			normalized = append(normalized, c)
+		default:
+			normalized = append(normalized, '-')
+		}
+	}
+	hostname = strings.Trim(string(normalized), "-.")
+
+	if hostname == "" {
+		return ip
+	}
+
+	if tM.config.ResolveHostnames {
+		if !hostnameResolves(hostname) {
+			log.Warningln("Hostname " + hostname + " doesn't resolve, using " + ip)
+			return ip
+		}
+	}
+
+	return hostname
+}
+
+// serverDisplayName builds the N field of GDAT
+func serverDisplayName(dataCenter string, hostname string, ip string, port string) string {
+	return dataCenter + "-" + hostname + "(" + displayAddress(ip, port) + ")"
+}
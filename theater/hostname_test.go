@@ -0,0 +1,88 @@
+package theater
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeHostname(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tests := []struct {
+		hostname string
+		want     string
+	}{
+		{"gs1-test.revive.systems", "gs1-test.revive.systems"},
+		{"\"GS1 Test.Revive.Systems.\"", "gs1-test.revive.systems"},
+		{"  my_server!! ", "my-server"},
+		{"", "10.0.0.1"},
+		{"!!!", "10.0.0.1"},
+	}
+
+	for _, test := range tests {
+		hostname := tM.normalizeHostname(test.hostname, "10.0.0.1")
+		if hostname != test.want {
+			t.Errorf("normalizeHostname was incorrect for %q, got: %s, want: %s.", test.hostname, hostname, test.want)
+		}
+	}
+}
+
+func TestGDATHostname(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("gdata:1", "HN", "My Server_01")
+	tM.redis.HSet("gdata:1", "IP", "45.77.79.240")
+	tM.redis.HSet("gdata:1", "PORT", "18569")
+	tM.redis.HSet("gdata:1", "B-U-data_center", "gva")
+
+	client, conn := newTestClient(t)
+	defer conn.Close()
+
+	go tM.GDAT(testCommand(client, "GDAT", map[string]string{"TID": "4", "GID": "1"}))
+	_, answer := readTestPacket(t, conn)
+
+	if answer["HN"] != "my-server-01" {
+		t.Errorf("GDAT HN was incorrect, got: %s, want: %s.", answer["HN"], "my-server-01")
+	}
+	if answer["N"] != "gva-my-server-01(45.77.79.240%3a18569)" {
+		t.Errorf("GDAT N was incorrect, got: %s, want: %s.", answer["N"], "gva-my-server-01(45.77.79.240%3a18569)")
+	}
+}
+
+func TestNormalizeHostnameCachesLookups(t *testing.T) {
+	defaultLookup := lookupHost
+	defer func() { lookupHost = defaultLookup }()
+
+	resolvedHostnamesMutex.Lock()
+	resolvedHostnames = make(map[string]resolvedHostname)
+	resolvedHostnamesMutex.Unlock()
+
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+	tM.config.ResolveHostnames = true
+
+	lookups := 0
+	lookupHost = func(hostname string) ([]string, error) {
+		lookups++
+		if hostname == "missing.example.com" {
+			return nil, errors.New("no such host")
+		}
+		return []string{"203.0.113.5"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if hostname := tM.normalizeHostname("cached.example.com", "10.0.0.1"); hostname != "cached.example.com" {
+			t.Errorf("normalizeHostname was incorrect, got: %s, want: %s.", hostname, "cached.example.com")
+		}
+		if hostname := tM.normalizeHostname("missing.example.com", "10.0.0.1"); hostname != "10.0.0.1" {
+			t.Errorf("normalizeHostname was incorrect, got: %s, want: %s.", hostname, "10.0.0.1")
+		}
+	}
+
+	if lookups != 2 {
+		t.Errorf("normalizeHostname lookups were incorrect, got: %d, want: %d.", lookups, 2)
+	}
+}
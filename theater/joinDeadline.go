@@ -0,0 +1,146 @@
+package theater
+
+import (
+	"time"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/HeroesAwaken/GoFesl/matchmaking"
+	"github.com/HeroesAwaken/GoFesl/metrics"
+)
+
+// joinRef identifies the join of a player into a game
+type joinRef struct {
+	shard  string
+	gameID string
+	pid    string
+}
+
+// pendingJoin is a join which hasn't reached PENT yet
+type pendingJoin struct {
+	client   *GameSpy.Client
+	tid      string
+	lobbyID  string
+	observer bool
+	// reserved is set once the server allowed the join through EGRS, which
+	// counts the player as joining
+	reserved bool
+	timer    *time.Timer
+}
+
+// startJoin starts the deadline of a join EGAM just handed to the server
+func (tM *TheaterManager) startJoin(client *GameSpy.Client, tid string, lobbyID string, gameID string, pid string, observer bool) {
+	ref := joinRef{client.State.Shard, gameID, pid}
+	join := &pendingJoin{client: client, tid: tid, lobbyID: lobbyID, observer: observer}
+
+	tM.pendingJoinsMutex.Lock()
+	defer tM.pendingJoinsMutex.Unlock()
+
+	// Joining the same game again only restarts the deadline
+	if previous, ok := tM.pendingJoins[ref]; ok {
+		previous.timer.Stop()
+		join.reserved = previous.reserved
+	}
+
+	join.timer = time.AfterFunc(tM.config.JoinTimeout, func() {
+		tM.expireJoin(ref, join)
+	})
+	tM.pendingJoins[ref] = join
+}
+
+// reserveJoin notes that the server counted a pending join as joining
+func (tM *TheaterManager) reserveJoin(shard string, gameID string, pid string) {
+	tM.pendingJoinsMutex.Lock()
+	defer tM.pendingJoinsMutex.Unlock()
+
+	if join, ok := tM.pendingJoins[joinRef{shard, gameID, pid}]; ok {
+		join.reserved = true
+	}
+}
+
+// finishJoin stops the deadline of a join, returning whether there was one
+func (tM *TheaterManager) finishJoin(shard string, gameID string, pid string) bool {
+	tM.pendingJoinsMutex.Lock()
+	defer tM.pendingJoinsMutex.Unlock()
+
+	ref := joinRef{shard, gameID, pid}
+	join, ok := tM.pendingJoins[ref]
+	if !ok {
+		return false
+	}
+
+	join.timer.Stop()
+	delete(tM.pendingJoins, ref)
+	return true
+}
+
+// cancelJoins drops the pending joins into a game server which is gone. Its
+// game doesn't exist anymore, so there's no count to give back, but the
+// players still learn that joining failed.
+func (tM *TheaterManager) cancelJoins(shard string, gameID string) {
+	canceled := make(map[joinRef]*pendingJoin)
+
+	tM.pendingJoinsMutex.Lock()
+	for ref, join := range tM.pendingJoins {
+		if ref.shard == shard && ref.gameID == gameID {
+			join.timer.Stop()
+			delete(tM.pendingJoins, ref)
+			canceled[ref] = join
+		}
+	}
+	tM.pendingJoinsMutex.Unlock()
+
+	for ref, join := range canceled {
+		log.Noteln("Join of " + ref.pid + " into " + ref.gameID + " canceled, the server is gone")
+
+		tM.leavePlayerGame(join.client, ref.gameID)
+		if join.client.IsActive {
+			tM.writeError(join.client, "EGAM", join.tid, GameSpy.ErrorCodeNotFound, "The server isn't available anymore.")
+		}
+		metrics.Joins.WithLabelValues("failed").Inc()
+	}
+}
+
+// expireJoin aborts a join which ran past its deadline. The server is told to
+// drop the player, the slot the join took is freed and the player learns
+// that joining failed.
+func (tM *TheaterManager) expireJoin(ref joinRef, join *pendingJoin) {
+	tM.pendingJoinsMutex.Lock()
+	if tM.pendingJoins[ref] != join {
+		// Finished or restarted in the meantime
+		tM.pendingJoinsMutex.Unlock()
+		return
+	}
+	delete(tM.pendingJoins, ref)
+	tM.pendingJoinsMutex.Unlock()
+
+	log.Noteln("Join of " + ref.pid + " into " + ref.gameID + " timed out")
+
+	if gameServer, ok := matchmaking.Game(shardKey(ref.shard, ref.gameID)); ok {
+		answer := make(map[string]string)
+		answer["TID"] = "0"
+		answer["PID"] = ref.pid
+		answer["LID"] = join.lobbyID
+		answer["GID"] = ref.gameID
+		gameServer.WriteFESL("QLVT", answer, 0x0)
+		tM.logAnswer("QLVT", answer, 0x0)
+	}
+
+	if join.reserved {
+		_, err := tM.stmtGameDecreaseJoining.Exec(ref.gameID, dbShard(ref.shard))
+		if err != nil {
+			log.Errorln("Failed decreasing joining players of "+ref.gameID, err.Error())
+		}
+	}
+	if join.observer {
+		tM.removeObserver(ref.shard, ref.gameID, ref.pid)
+	}
+
+	tM.leavePlayerGame(join.client, ref.gameID)
+
+	if join.client.IsActive {
+		tM.writeError(join.client, "EGAM", join.tid, GameSpy.ErrorCodeJoinTimedOut, "Joining the server timed out.")
+	}
+
+	metrics.Joins.WithLabelValues("timed_out").Inc()
+}
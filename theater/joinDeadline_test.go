@@ -0,0 +1,130 @@
+package theater
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/matchmaking"
+	"github.com/HeroesAwaken/GoFesl/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestJoinDeadlineStalledAfterEGRS(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+	tM.config.JoinTimeout = time.Millisecond * 50
+
+	mock := expectJoin(t, tM, "Joiner")
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+
+	server, serverRecorder := newRecordedClient()
+	matchmaking.SetGame("1", server)
+	defer matchmaking.RemoveGame("1")
+
+	timedOut := testutil.ToFloat64(metrics.Joins.WithLabelValues("timed_out"))
+
+	client, recorder := newJoiningClient(tM)
+	tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "4", "GID": "1", "PORT": "40000"}))
+
+	mock.ExpectPrepare("players_joining \\+ 1")
+	mock.ExpectPrepare("players_joining - 1")
+	tM.stmtGameIncreaseJoining, _ = tM.db.Prepare("UPDATE games SET players_joining = players_joining + 1 WHERE gid = ? AND shard = ?")
+	tM.stmtGameDecreaseJoining, _ = tM.db.Prepare("UPDATE games SET players_joining = players_joining - 1 WHERE gid = ? AND shard = ?")
+	mock.ExpectExec("players_joining \\+ 1").WithArgs("1", dbShard("")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("players_joining - 1").WithArgs("1", dbShard("")).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// The server lets the player in, who then never shows up through PENT
+	tM.EGRS(testCommand(server, "EGRS", map[string]string{"TID": "5", "GID": "1", "PID": "7", "ALLOWED": "1"}))
+
+	var packets []GameSpy.Packet
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond * 10) {
+		if packets = recorder.Packets(); len(packets) == 3 {
+			break
+		}
+	}
+
+	if len(packets) != 3 || packets[2].Type != "EGAM" || packets[2].Message["errorCode"] != "110" || packets[2].Message["TID"] != "4" {
+		t.Fatalf("Join deadline was incorrect, got: %v, want errorCode: %s.", packets, "110")
+	}
+
+	serverPackets := serverRecorder.Packets()
+	last := serverPackets[len(serverPackets)-1]
+	if last.Type != "QLVT" || last.Message["PID"] != "7" || last.Message["GID"] != "1" {
+		t.Errorf("Join deadline was incorrect, got: %v, want a QLVT for PID 7.", last)
+	}
+
+	if client.State.GameID != "" {
+		t.Errorf("Join deadline was incorrect, client still joined %s.", client.State.GameID)
+	}
+	if tM.finishJoin("", "1", "7") {
+		t.Errorf("Join deadline was incorrect, the join is still pending.")
+	}
+	if count := testutil.ToFloat64(metrics.Joins.WithLabelValues("timed_out")) - timedOut; count != 1 {
+		t.Errorf("Join deadline timed_out count was incorrect, got: %f, want: %d.", count, 1)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Join deadline database calls were incorrect: %s", err)
+	}
+}
+
+func TestJoinDeadlineStoppedByPENT(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+	tM.config.JoinTimeout = time.Millisecond * 20
+
+	client, recorder := newJoiningClient(tM)
+	tM.startJoin(client, "4", "1", "1", "7", false)
+
+	if !tM.finishJoin("", "1", "7") {
+		t.Fatalf("finishJoin was incorrect, found no pending join.")
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	if packets := recorder.Packets(); len(packets) != 0 {
+		t.Errorf("Join deadline was incorrect, got: %v, want no packets.", packets)
+	}
+}
+
+func TestJoinDeadlineCanceledByRemovedServer(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+	tM.config.JoinTimeout = time.Millisecond * 20
+
+	mock := newTestDB(t, tM)
+	mock.ExpectPrepare("DELETE FROM game_server_stats")
+	mock.ExpectPrepare("DELETE FROM games")
+	tM.stmtDeleteServerStatsByGIDAndShard, _ = tM.db.Prepare("DELETE FROM game_server_stats WHERE gid = ? AND shard = ?")
+	tM.stmtDeleteGameByGIDAndShard, _ = tM.db.Prepare("DELETE FROM games WHERE gid = ? AND shard = ?")
+	mock.ExpectExec("DELETE FROM game_server_stats").WithArgs("1", dbShard("")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM games").WithArgs("1", dbShard("")).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	client, recorder := newJoiningClient(tM)
+	tM.setPlayerGame(client, "1")
+	tM.startJoin(client, "4", "1", "1", "7", false)
+	tM.reserveJoin("", "1", "7")
+
+	// The game server goes away before the player shows up, its GID may be
+	// handed out again right after
+	tM.removeGameServer("", "1")
+
+	if tM.finishJoin("", "1", "7") {
+		t.Errorf("Removing the server was incorrect, the join is still pending.")
+	}
+	if gameID := tM.playerGame(client); gameID != "" {
+		t.Errorf("Removing the server was incorrect, client still joined %s.", gameID)
+	}
+
+	// Past the deadline, nothing gives back a joining player anymore
+	time.Sleep(time.Millisecond * 50)
+
+	packets := recorder.Packets()
+	if len(packets) != 1 || packets[0].Type != "EGAM" || packets[0].Message["errorCode"] != "111" || packets[0].Message["TID"] != "4" {
+		t.Errorf("Removing the server was incorrect, got: %v, want errorCode: %s.", packets, "111")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Removing the server database calls were incorrect: %s", err)
+	}
+}
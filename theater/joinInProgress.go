@@ -0,0 +1,25 @@
+package theater
+
+import "github.com/HeroesAwaken/GoFesl/lib"
+
+// roundStateInProgress is the B-U-server_state of a server that is mid-round
+const roundStateInProgress = "in_round"
+
+// joinInProgressAllowed tells whether a server lets players join mid-round.
+// Servers report it in B-U-jip, "0" disallows it.
+func joinInProgressAllowed(gameServer *lib.RedisObject) bool {
+	return gameServer.Get("B-U-jip") != "0"
+}
+
+// joinInProgressFlag is the JIP field of GDAT
+func joinInProgressFlag(gameServer *lib.RedisObject) string {
+	if joinInProgressAllowed(gameServer) {
+		return "1"
+	}
+	return "0"
+}
+
+// joinRefusedMidRound tells whether a join has to wait for the next round
+func joinRefusedMidRound(gameServer *lib.RedisObject) bool {
+	return !joinInProgressAllowed(gameServer) && gameServer.Get("B-U-server_state") == roundStateInProgress
+}
@@ -0,0 +1,200 @@
+package theater
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/matchmaking"
+)
+
+// testLifecycle drives the handlers of a theater the way connected game
+// servers and clients would, against an in-memory redis and a mocked
+// database. Handlers run one after the other, so the database expectations
+// of a step are set up right before it.
+type testLifecycle struct {
+	t        *testing.T
+	tM       *TheaterManager
+	mock     sqlmock.Sqlmock
+	handlers map[string]func(GameSpy.EventClientFESLCommand)
+	clients  int
+}
+
+// lifecycleClient is a client connected to a testLifecycle
+type lifecycleClient struct {
+	*GameSpy.Client
+	recorder *GameSpy.Recorder
+}
+
+// newTestLifecycle returns a theater with the statements of the handlers
+// prepared on a mocked database
+func newTestLifecycle(t *testing.T) (*testLifecycle, func()) {
+	tM, cleanup := newTestTheater(t)
+	mock := newTestDB(t, tM)
+
+	mock.ExpectPrepare("INSERT INTO games")
+	mock.ExpectPrepare("team_1 = team_1")
+	mock.ExpectPrepare("team_2 = team_2")
+	tM.stmtAddGame, _ = tM.db.Prepare("INSERT INTO games")
+	tM.stmtGameIncreaseTeam1, _ = tM.db.Prepare("UPDATE games SET team_1 = team_1 + 1")
+	tM.stmtGameIncreaseTeam2, _ = tM.db.Prepare("UPDATE games SET team_2 = team_2 + 1")
+
+	l := &testLifecycle{t: t, tM: tM, mock: mock}
+	l.handlers = map[string]func(GameSpy.EventClientFESLCommand){
+		"CONN": tM.CONN,
+		"GDAT": tM.GDAT,
+		"CGAM": tM.CGAM,
+		"UGAM": tM.UGAM,
+		"PENT": tM.PENT,
+		"UPLA": tM.UPLA,
+	}
+
+	return l, func() {
+		for key, client := range matchmaking.Games() {
+			if client.RedisState != nil && client.RedisState.Get("lifecycle") == "1" {
+				matchmaking.RemoveGame(key)
+			}
+		}
+		cleanup()
+	}
+}
+
+// connect returns a new client at ip which went through CONN
+func (l *testLifecycle) connect(ip string, port int) *lifecycleClient {
+	l.clients++
+
+	client, recorder := newRecordedClient()
+	client.IpAddr = &net.TCPAddr{IP: net.ParseIP(ip), Port: port}
+	client.RedisState = new(core.RedisState)
+	client.RedisState.New(l.tM.redis, "mm:lifecycle"+strconv.Itoa(l.clients))
+	client.RedisState.Set("lifecycle", "1")
+
+	connected := &lifecycleClient{client, recorder}
+	answer := l.send(connected, "CONN", map[string]string{"TID": "1", "PROT": "2", "VERS": "1.46.222034", "LOCALE": "en_US"})
+	if answer["TID"] != "1" || answer["PROT"] != "2" {
+		l.t.Fatalf("CONN was incorrect, got: %v.", answer)
+	}
+
+	return connected
+}
+
+// send runs the handler of query for client and returns its answer, failing
+// the test when there's none
+func (l *testLifecycle) send(client *lifecycleClient, query string, message map[string]string) map[string]string {
+	answer, ok := l.sendQuiet(client, query, message)
+	if !ok {
+		l.t.Fatalf("%s wasn't answered.", query)
+	}
+	return answer
+}
+
+// sendQuiet runs the handler of query for client and returns its answer, if
+// it got one. Some commands, like UGAM, aren't answered.
+func (l *testLifecycle) sendQuiet(client *lifecycleClient, query string, message map[string]string) (map[string]string, bool) {
+	handler, ok := l.handlers[query]
+	if !ok {
+		l.t.Fatalf("No handler for %s.", query)
+	}
+
+	sent := len(client.recorder.Packets())
+	handler(testCommand(client.Client, query, message))
+
+	packets := client.recorder.Packets()
+	for i := len(packets) - 1; i >= sent; i-- {
+		if packets[i].Type == query {
+			return packets[i].Message, true
+		}
+	}
+	return nil, false
+}
+
+func TestServerLifecycle(t *testing.T) {
+	l, cleanup := newTestLifecycle(t)
+	defer cleanup()
+
+	// The server creates its game
+	server := l.connect("203.0.113.5", 40000)
+
+	l.mock.ExpectPrepare("INSERT INTO game_server_stats").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	l.mock.ExpectExec("INSERT INTO games").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	created := l.send(server, "CGAM", map[string]string{
+		"TID": "2", "LID": "1", "NAME": "\"Lifecycle\"", "PORT": "18567", "UGID": "lifecycle",
+		"MAX-PLAYERS": "16", "JOIN": "O", "B-version": "1.46.222034.0", "B-U-map": "village",
+	})
+	gameID := created["GID"]
+	if gameID == "" || created["LID"] != "1" {
+		t.Fatalf("CGAM was incorrect, got GID: %s, LID: %s, want a GID in LID %s.", gameID, created["LID"], "1")
+	}
+
+	// ... and updates it
+	if _, answered := l.sendQuiet(server, "UGAM", map[string]string{
+		"TID": "3", "GID": gameID, "B-U-map": "\"bridge\"", "B-U-data_center": "gva", "B-U-jip": "1",
+	}); answered {
+		t.Errorf("UGAM was incorrect, it was answered.")
+	}
+
+	// A client sees what the server sent
+	client := l.connect("198.51.100.7", 50000)
+
+	data := l.send(client, "GDAT", map[string]string{"TID": "4", "GID": gameID})
+	want := map[string]string{
+		"TID": "4", "GID": gameID, "LID": created["LID"], "NAME": "Lifecycle", "IP": "203.0.113.5", "PORT": "18567",
+		"B-U-map": "bridge", "B-U-data_center": "gva", "AP": "0", "MAX-PLAYERS": "16", "JOIN": "O",
+	}
+	for key, value := range want {
+		if data[key] != value {
+			t.Errorf("GDAT %s was incorrect, got: %s, want: %s.", key, data[key], value)
+		}
+	}
+
+	// Players enter the game, each counting as connected to their team
+	l.mock.ExpectPrepare("SELECT game_heroes")
+	for _, player := range []struct {
+		pid  string
+		team string
+	}{
+		{"7", "1"},
+		{"8", "2"},
+	} {
+		rows := sqlmock.NewRows([]string{"user_id", "id", "heroName", "statsKey", "statsValue"}).
+			AddRow("42", player.pid, "Hero", "c_team", player.team)
+		l.mock.ExpectQuery("SELECT game_heroes").WithArgs("c_kit", "c_team", "elo", "level", player.pid).WillReturnRows(rows)
+		l.mock.ExpectExec("team_"+player.team+" = team_"+player.team).WithArgs(gameID, dbShard("")).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		entered := l.send(server, "PENT", map[string]string{"TID": "5", "GID": gameID, "PID": player.pid})
+		if entered["PID"] != player.pid {
+			t.Errorf("PENT was incorrect, got: %v, want PID: %s.", entered, player.pid)
+		}
+		if err := l.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("PENT of %s didn't count it on team %s: %s", player.pid, player.team, err)
+		}
+	}
+
+	// Entering only counts players in the db, the active players clients see
+	// follow the UPLA the server sends for each of them
+	data = l.send(client, "GDAT", map[string]string{"TID": "6", "GID": gameID})
+	if data["AP"] != "0" {
+		t.Errorf("GDAT after PENT was incorrect, got AP: %s, want: %s.", data["AP"], "0")
+	}
+
+	l.mock.ExpectPrepare("INSERT INTO game_server_player_stats")
+	for _, pid := range []string{"7", "8"} {
+		l.mock.ExpectExec("INSERT INTO game_server_player_stats").WithArgs(gameID, pid, "P-cid", "1").WillReturnResult(sqlmock.NewResult(0, 1))
+		if _, answered := l.sendQuiet(server, "UPLA", map[string]string{"TID": "7", "GID": gameID, "PID": pid, "P-cid": "1"}); answered {
+			t.Errorf("UPLA was incorrect, it was answered.")
+		}
+	}
+
+	data = l.send(client, "GDAT", map[string]string{"TID": "8", "GID": gameID})
+	if data["AP"] != "2" || data["GID"] != gameID || data["LID"] != created["LID"] {
+		t.Errorf("GDAT after UPLA was incorrect, got AP: %s, GID: %s, LID: %s, want: %s, %s, %s.", data["AP"], data["GID"], data["LID"], "2", gameID, created["LID"])
+	}
+
+	if err := l.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Lifecycle database calls were incorrect: %s", err)
+	}
+}
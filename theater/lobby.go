@@ -0,0 +1,83 @@
+package theater
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+// Lobby is a lobby clients can list and join games in
+type Lobby struct {
+	ID       string
+	Name     string
+	Locale   string
+	MaxGames int
+}
+
+// ValidateLobbies checks configured lobbies before they're advertised, LLST
+// advertises at most maxLobbies and considers more a misconfiguration
+func ValidateLobbies(lobbies []Lobby, maxLobbies int) error {
+	if len(lobbies) == 0 {
+		return errors.New("no lobbies configured")
+	}
+	if len(lobbies) > maxLobbies {
+		return errors.New("configured " + strconv.Itoa(len(lobbies)) + " lobbies, at most " + strconv.Itoa(maxLobbies) + " are allowed")
+	}
+
+	seen := make(map[string]bool)
+	for _, lobby := range lobbies {
+		if lobby.ID == "" {
+			return errors.New("lobby " + lobby.Name + " has no ID")
+		}
+		if seen[lobby.ID] {
+			return errors.New("lobby ID " + lobby.ID + " is used twice")
+		}
+		seen[lobby.ID] = true
+	}
+
+	return nil
+}
+
+// canJoinLobby checks whether a client in clientLobby may join a game in
+// gameLobby. Clients which haven't listed a lobby through GLST yet aren't in
+// any, so they can't join.
+func (tM *TheaterManager) canJoinLobby(clientLobby string, gameLobby string) bool {
+	if tM.config.AllowCrossLobbyJoins {
+		return true
+	}
+	return clientLobby != "" && clientLobby == gameLobby
+}
+
+// findLobby returns the configured lobby with the given LID
+func (tM *TheaterManager) findLobby(lobbyID string) (Lobby, bool) {
+	for _, lobby := range tM.config.Lobbies {
+		if lobby.ID == lobbyID {
+			return lobby, true
+		}
+	}
+	return Lobby{}, false
+}
+
+// serverLobby returns the LID of the lobby a game server belongs to.
+// Servers which didn't pick a known lobby are in the first one.
+func (tM *TheaterManager) serverLobby(gameServer *lib.RedisObject) string {
+	if _, ok := tM.findLobby(gameServer.Get("LID")); ok {
+		return gameServer.Get("LID")
+	}
+	if len(tM.config.Lobbies) > 0 {
+		return tM.config.Lobbies[0].ID
+	}
+	return ""
+}
+
+// lobbyGameCounts returns how many game servers of a shard are in each lobby
+func (tM *TheaterManager) lobbyGameCounts(shard string) map[string]int {
+	counts := make(map[string]int)
+	for _, gameID := range tM.listGameIDs(shard) {
+		gameServer := new(lib.RedisObject)
+		gameServer.New(tM.redis, gameDataPrefix(shard), gameID)
+		counts[tM.serverLobby(gameServer)]++
+	}
+	return counts
+}
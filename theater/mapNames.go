@@ -0,0 +1,24 @@
+package theater
+
+// DefaultLocale is used for clients which didn't tell us theirs
+const DefaultLocale = "en_US"
+
+// mapDisplayName returns the name of a map in the given locale, falling
+// back to the DefaultLocale and then to the map id itself
+func (tM *TheaterManager) mapDisplayName(locale string, mapID string) string {
+	if name, ok := tM.config.MapDisplayNames[locale][mapID]; ok {
+		return name
+	}
+	if name, ok := tM.config.MapDisplayNames[DefaultLocale][mapID]; ok {
+		return name
+	}
+	return mapID
+}
+
+// clientLocale returns the locale a client connected with
+func clientLocale(locale string) string {
+	if locale == "" {
+		return DefaultLocale
+	}
+	return locale
+}
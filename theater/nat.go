@@ -0,0 +1,102 @@
+package theater
+
+import (
+	"net"
+	"strings"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/log"
+)
+
+// advertisedIP returns the configured PublicIP for addresses that can't be
+// reached from the outside (private, loopback, link-local, unspecified),
+// otherwise the ip itself
+func (tM *TheaterManager) advertisedIP(ip string) string {
+	if tM.config.PublicIP == "" {
+		return ip
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.IsLoopback() || parsed.IsUnspecified() || parsed.IsLinkLocalUnicast() || isPrivateIP(parsed) {
+		return tM.config.PublicIP
+	}
+
+	return ip
+}
+
+// privateNetworks can't be reached from the outside
+var privateNetworks = parseNetworks("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+func isPrivateIP(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// rememberAdvertisedPort stores the port client told us about over TCP, so
+// ECHO can compare it with what it sees over UDP. Clients behind a NAT share
+// their ip, so the ports are kept per client.
+func (tM *TheaterManager) rememberAdvertisedPort(client *GameSpy.Client, ip string, port string) {
+	if port == "" {
+		return
+	}
+
+	tM.advertisedPortsMutex.Lock()
+	defer tM.advertisedPortsMutex.Unlock()
+
+	ports, ok := tM.advertisedPorts[ip]
+	if !ok {
+		ports = make(map[*GameSpy.Client]string)
+		tM.advertisedPorts[ip] = ports
+	}
+	ports[client] = port
+}
+
+// forgetAdvertisedPort drops the port advertised by client from ip once it's
+// gone, leaving the ones of other clients behind the same address
+func (tM *TheaterManager) forgetAdvertisedPort(client *GameSpy.Client, ip string) {
+	tM.advertisedPortsMutex.Lock()
+	defer tM.advertisedPortsMutex.Unlock()
+
+	delete(tM.advertisedPorts[ip], client)
+	if len(tM.advertisedPorts[ip]) == 0 {
+		delete(tM.advertisedPorts, ip)
+	}
+}
+
+// checkAdvertisedPort warns and returns false when none of the clients at ip
+// advertised the port ECHO sees. An ECHO doesn't tell which of them sent it.
+func (tM *TheaterManager) checkAdvertisedPort(ip string, port string) bool {
+	tM.advertisedPortsMutex.Lock()
+	defer tM.advertisedPortsMutex.Unlock()
+
+	ports, ok := tM.advertisedPorts[ip]
+	if !ok {
+		return true
+	}
+
+	advertised := make([]string, 0, len(ports))
+	for _, clientPort := range ports {
+		if clientPort == port {
+			return true
+		}
+		advertised = append(advertised, clientPort)
+	}
+	log.Warningln("ECHO port mismatch for " + ip + ": clients advertised " + strings.Join(advertised, ", ") + ", we see " + port)
+	return false
+}
@@ -0,0 +1,105 @@
+package theater
+
+import (
+	"net"
+	"testing"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+)
+
+func TestAdvertisedIP(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+	tM.config.PublicIP = "198.51.100.1"
+
+	tables := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.5", "203.0.113.5"},
+		{"10.1.2.3", "198.51.100.1"},
+		{"172.20.0.1", "198.51.100.1"},
+		{"192.168.1.10", "198.51.100.1"},
+		{"127.0.0.1", "198.51.100.1"},
+		{"fd00::1", "198.51.100.1"},
+		{"fe80::1", "198.51.100.1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"", "198.51.100.1"},
+	}
+
+	for _, table := range tables {
+		if ip := tM.advertisedIP(table.ip); ip != table.want {
+			t.Errorf("advertisedIP(%s) was incorrect, got: %s, want: %s.", table.ip, ip, table.want)
+		}
+	}
+
+	tM.config.PublicIP = ""
+	if ip := tM.advertisedIP("10.1.2.3"); ip != "10.1.2.3" {
+		t.Errorf("advertisedIP without PublicIP was incorrect, got: %s, want: %s.", ip, "10.1.2.3")
+	}
+}
+
+func TestECHOBehindNAT(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+	tM.config.PublicIP = "198.51.100.1"
+
+	recorder := new(GameSpy.Recorder)
+	tM.socketUDP = recorder.UDP()
+
+	tM.ECHO(GameSpy.SocketUDPEvent{
+		Name: "command.ECHO",
+		Addr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 18275},
+		Data: &GameSpy.CommandFESL{Query: "ECHO", Message: map[string]string{"TID": "8", "TXN": "ECHO"}},
+	})
+
+	packets := recorder.Packets()
+	if len(packets) != 1 || packets[0].Message["IP"] != "198.51.100.1" || packets[0].Message["PORT"] != "18275" {
+		t.Errorf("ECHO was incorrect, got: %v, want IP: %s, PORT: %s.", packets, "198.51.100.1", "18275")
+	}
+}
+
+func TestAdvertisedPortsBehindNAT(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	// Two clients share the public address of their NAT
+	first, _ := newRecordedClient()
+	first.IpAddr = &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 40000}
+	second, _ := newRecordedClient()
+	second.IpAddr = &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 40001}
+
+	tM.rememberAdvertisedPort(first, "203.0.113.5", "18567")
+	tM.rememberAdvertisedPort(second, "203.0.113.5", "18568")
+
+	tables := []struct {
+		port string
+		want bool
+	}{
+		{"18567", true},
+		{"18568", true},
+		{"18569", false},
+	}
+	for _, table := range tables {
+		if ok := tM.checkAdvertisedPort("203.0.113.5", table.port); ok != table.want {
+			t.Errorf("checkAdvertisedPort of %s was incorrect, got: %t, want: %t.", table.port, ok, table.want)
+		}
+	}
+
+	// Closing one leaves the port of the other
+	tM.close(GameSpy.EventClientClose{Client: first})
+	if ok := tM.checkAdvertisedPort("203.0.113.5", "18567"); ok {
+		t.Errorf("checkAdvertisedPort after close was incorrect, the port of the closed client is still remembered.")
+	}
+	if ok := tM.checkAdvertisedPort("203.0.113.5", "18568"); !ok {
+		t.Errorf("checkAdvertisedPort after close was incorrect, the port of the remaining client was forgotten.")
+	}
+
+	tM.close(GameSpy.EventClientClose{Client: second})
+	tM.advertisedPortsMutex.Lock()
+	_, ok := tM.advertisedPorts["203.0.113.5"]
+	tM.advertisedPortsMutex.Unlock()
+	if ok {
+		t.Errorf("close was incorrect, the advertised ports of %s are still remembered.", "203.0.113.5")
+	}
+}
@@ -0,0 +1,37 @@
+package theater
+
+import (
+	"strings"
+	"unicode"
+)
+
+const maxNicknameLength = 32
+
+// sanitizeNickname makes a nickname from the db safe to put into a packet,
+// using fallback when nothing is left of it
+func sanitizeNickname(nickname string, fallback string) string {
+	sanitized := sanitizeText(nickname, maxNicknameLength)
+	if sanitized == "" {
+		return fallback
+	}
+	return sanitized
+}
+
+// sanitizeText makes text safe to put into a packet and cuts it to at most
+// maxLength characters. Control characters and the FESL delimiters (= and
+// newline) are dropped, as are quotes since they get stripped on the other
+// side anyway.
+func sanitizeText(text string, maxLength int) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '=' || r == '"' || r == unicode.ReplacementChar {
+			return -1
+		}
+		return r
+	}, text)
+
+	sanitized = strings.TrimSpace(sanitized)
+	if runes := []rune(sanitized); len(runes) > maxLength {
+		sanitized = strings.TrimSpace(string(runes[:maxLength]))
+	}
+	return sanitized
+}
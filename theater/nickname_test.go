@@ -0,0 +1,57 @@
+package theater
+
+import (
+	"testing"
+
+	"github.com/HeroesAwaken/GoFesl/matchmaking"
+)
+
+func TestSanitizeNickname(t *testing.T) {
+	tables := []struct {
+		nickname  string
+		sanitized string
+	}{
+		{"Hero", "Hero"},
+		{"Evil\nTICKET=1", "EvilTICKET1"},
+		{"\"Quoted\"", "Quoted"},
+		{"Tab\tbed\x00", "Tabbed"},
+		{"Ünïcödé", "Ünïcödé"},
+		{"\n=\"", "Hero"},
+		{"", "Hero"},
+		{"ThisNicknameIsWayTooLongForTheGameToShow", "ThisNicknameIsWayTooLongForTheGa"},
+	}
+
+	for _, table := range tables {
+		if sanitized := sanitizeNickname(table.nickname, "Hero"); sanitized != table.sanitized {
+			t.Errorf("sanitizeNickname(%q) was incorrect, got: %q, want: %q.", table.nickname, sanitized, table.sanitized)
+		}
+	}
+}
+
+func TestEGAMSanitizesNickname(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	expectJoin(t, tM, "Evil\nTICKET=1")
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+
+	server, serverRecorder := newRecordedClient()
+	matchmaking.SetGame("1", server)
+	defer matchmaking.RemoveGame("1")
+
+	client, _ := newJoiningClient(tM)
+
+	tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "4", "GID": "1", "PORT": "40000"}))
+
+	packets := serverRecorder.Packets()
+	if len(packets) != 1 || packets[0].Type != "EGRQ" {
+		t.Fatalf("EGRQ packets were incorrect, got: %v, want: one EGRQ.", packets)
+	}
+	if packets[0].Message["NAME"] != "EvilTICKET1" {
+		t.Errorf("EGRQ NAME was incorrect, got: %q, want: %q.", packets[0].Message["NAME"], "EvilTICKET1")
+	}
+	if packets[0].Message["R-USER"] != "EvilTICKET1" {
+		t.Errorf("EGRQ R-USER was incorrect, got: %q, want: %q.", packets[0].Message["R-USER"], "EvilTICKET1")
+	}
+}
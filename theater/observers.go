@@ -0,0 +1,70 @@
+package theater
+
+import (
+	"strconv"
+
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+const (
+	playerTypePlayer   = "P"
+	playerTypeObserver = "O"
+)
+
+// joinsAsObserver tells whether a client asked to spectate instead of play,
+// which it does by sending PTYPE O with EGAM
+func joinsAsObserver(message map[string]string) bool {
+	return message["PTYPE"] == playerTypeObserver
+}
+
+// numObserversKey is the gdata key of the observer count. Only the theater
+// counts observers, servers can't set it through CGAM or UGAM.
+const numObserversKey = "B-numObservers"
+
+// observersKey is the redis set of the PIDs observing a game
+func observersKey(shard string, gameID string) string {
+	return shardKey(shard, "gobs:"+gameID)
+}
+
+// takeObserverSlot takes an observer slot of a game for pid, returning false
+// if there's none left. Servers not advertising B-maxObservers don't take
+// any. The slot is counted first and given back if that went over the
+// limit, so concurrent joins can't both take the last one.
+func (tM *TheaterManager) takeObserverSlot(shard string, gameID string, pid string, gameServer *lib.RedisObject) bool {
+	maxObservers, err := strconv.Atoi(gameServer.Get("B-maxObservers"))
+	if err != nil {
+		return false
+	}
+
+	// Joining again keeps the slot
+	if tM.redis.SAdd(observersKey(shard, gameID), pid).Val() != 1 {
+		return true
+	}
+
+	key := gameDataPrefix(shard) + ":" + gameID
+	if tM.redis.HIncrBy(key, numObserversKey, 1).Val() > int64(maxObservers) {
+		tM.redis.HIncrBy(key, numObserversKey, -1)
+		tM.redis.SRem(observersKey(shard, gameID), pid)
+		return false
+	}
+	return true
+}
+
+// removeObserver frees the observer slot of pid, returning whether pid was
+// observing the game at all
+func (tM *TheaterManager) removeObserver(shard string, gameID string, pid string) bool {
+	if tM.redis.SRem(observersKey(shard, gameID), pid).Val() != 1 {
+		return false
+	}
+
+	key := gameDataPrefix(shard) + ":" + gameID
+	if tM.redis.HIncrBy(key, numObserversKey, -1).Val() < 0 {
+		tM.redis.HSet(key, numObserversKey, "0")
+	}
+	return true
+}
+
+// isObserver tells whether pid is observing a game
+func (tM *TheaterManager) isObserver(shard string, gameID string, pid string) bool {
+	return tM.redis.SIsMember(observersKey(shard, gameID), pid).Val()
+}
@@ -0,0 +1,130 @@
+package theater
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/lib"
+	"github.com/HeroesAwaken/GoFesl/matchmaking"
+)
+
+func TestEGAMObserver(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	mock := expectJoin(t, tM, "Caster")
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("gdata:1", "AP", "3")
+	tM.redis.HSet("gdata:1", "B-maxObservers", "1")
+	tM.redis.HSet("gdata:1", "B-numObservers", "0")
+
+	server, serverRecorder := newRecordedClient()
+	matchmaking.SetGame("1", server)
+	defer matchmaking.RemoveGame("1")
+
+	client, recorder := newJoiningClient(tM)
+	tM.socket = new(GameSpy.Socket)
+	tM.socket.Clients = append(tM.socket.Clients, client)
+
+	tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "4", "GID": "1", "PORT": "40000", "PTYPE": "O"}))
+
+	packets := serverRecorder.Packets()
+	if len(packets) != 1 || packets[0].Type != "EGRQ" {
+		t.Fatalf("EGRQ packets were incorrect, got: %v, want: one EGRQ.", packets)
+	}
+	if packets[0].Message["PTYPE"] != "O" {
+		t.Errorf("EGRQ PTYPE was incorrect, got: %s, want: %s.", packets[0].Message["PTYPE"], "O")
+	}
+	if team, ok := packets[0].Message["R-U-team"]; ok {
+		t.Errorf("EGRQ R-U-team was incorrect, got: %s, want none for an observer.", team)
+	}
+	if numObservers := tM.redis.HGet("gdata:1", "B-numObservers").Val(); numObservers != "1" {
+		t.Errorf("B-numObservers was incorrect, got: %s, want: %s.", numObservers, "1")
+	}
+
+	// The server reporting the observer doesn't count it as player
+	mock.ExpectPrepare("INSERT INTO game_server_player_stats").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	tM.UPLA(testCommand(server, "UPLA", map[string]string{"TID": "5", "GID": "1", "PID": "7", "P-kit": "1"}))
+	if activePlayers := tM.redis.HGet("gdata:1", "AP").Val(); activePlayers != "3" {
+		t.Errorf("AP was incorrect, got: %s, want: %s.", activePlayers, "3")
+	}
+
+	// Servers can't overwrite the count
+	tM.UGAM(testCommand(server, "UGAM", map[string]string{"TID": "6", "GID": "1", "B-numObservers": "0"}))
+	if numObservers := tM.redis.HGet("gdata:1", "B-numObservers").Val(); numObservers != "1" {
+		t.Errorf("B-numObservers was incorrect after UGAM, got: %s, want: %s.", numObservers, "1")
+	}
+
+	// All observer slots are taken now
+	other, otherRecorder := newRecordedClient()
+	other.IpAddr = client.IpAddr
+	other.RedisState = new(core.RedisState)
+	other.RedisState.New(tM.redis, "mm:other")
+	other.RedisState.Set("id", "8")
+	other.RedisState.Set("userID", "42")
+	other.State.LobbyID = "1"
+
+	mock.ExpectQuery("SELECT game_heroes").WillReturnRows(sqlmock.NewRows([]string{"user_id", "id", "heroName", "statsKey", "statsValue"}).
+		AddRow("42", "8", "Other", "elo", "1200"))
+	tM.EGAM(testCommand(other, "EGAM", map[string]string{"TID": "6", "GID": "1", "PORT": "40001", "PTYPE": "O"}))
+	packets = otherRecorder.Packets()
+	if len(packets) != 1 || packets[0].Type != "EGAM" || packets[0].Message["errorCode"] != "109" {
+		t.Errorf("EGAM was incorrect, got: %v, want errorCode: %s.", packets, "109")
+	}
+	if numObservers := tM.redis.HGet("gdata:1", "B-numObservers").Val(); numObservers != "1" {
+		t.Errorf("B-numObservers was incorrect after a full EGAM, got: %s, want: %s.", numObservers, "1")
+	}
+
+	// ... except for the observer joining again
+	mock.ExpectQuery("SELECT game_heroes").WillReturnRows(sqlmock.NewRows([]string{"user_id", "id", "heroName", "statsKey", "statsValue"}).
+		AddRow("42", "7", "Caster", "elo", "1200"))
+	tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "7", "GID": "1", "PORT": "40000", "PTYPE": "O"}))
+	packets = recorder.Packets()
+	if last := packets[len(packets)-1]; last.Type != "EGEG" {
+		t.Errorf("EGAM was incorrect, got: %v, want: EGEG.", last)
+	}
+
+	tM.PLVT(testCommand(server, "PLVT", map[string]string{"TID": "8", "LID": "1", "GID": "1", "PID": "7"}))
+	if numObservers := tM.redis.HGet("gdata:1", "B-numObservers").Val(); numObservers != "0" {
+		t.Errorf("B-numObservers was incorrect, got: %s, want: %s.", numObservers, "0")
+	}
+	if gameID := tM.playerGame(client); gameID != "" {
+		t.Errorf("PLVT was incorrect, client is still in %s.", gameID)
+	}
+}
+
+func TestTakeObserverSlot(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tables := []struct {
+		maxObservers string
+		numObservers string
+		taken        bool
+	}{
+		{"2", "1", true},
+		{"2", "2", false},
+		{"2", "", true},
+		{"0", "0", false},
+		{"", "", false},
+	}
+
+	gameServer := new(lib.RedisObject)
+	gameServer.New(tM.redis, "gdata", "1")
+
+	for _, table := range tables {
+		tM.redis.Del(observersKey("", "1"))
+		gameServer.Set("B-maxObservers", table.maxObservers)
+		gameServer.Set("B-numObservers", table.numObservers)
+
+		if taken := tM.takeObserverSlot("", "1", "7", gameServer); taken != table.taken {
+			t.Errorf("takeObserverSlot(%s, %s) was incorrect, got: %t, want: %t.", table.maxObservers, table.numObservers, taken, table.taken)
+		}
+		if !table.taken && gameServer.Get("B-numObservers") != table.numObservers {
+			t.Errorf("takeObserverSlot(%s, %s) was incorrect, B-numObservers changed to %s.", table.maxObservers, table.numObservers, gameServer.Get("B-numObservers"))
+		}
+	}
+}
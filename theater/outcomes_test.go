@@ -0,0 +1,78 @@
+package theater
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/HeroesAwaken/GoAwaken/core"
+	"github.com/HeroesAwaken/GoFesl/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCommandOutcomes(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+	tM.name = "outcomes"
+
+	tM.config.Lobbies = []Lobby{
+		{ID: "1", Name: "bfwestPC02", Locale: "en_US", MaxGames: 10000},
+		{ID: "2", Name: "bfeuPC01", Locale: "de_DE", MaxGames: 500},
+	}
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.redis.HSet("gdata:1", "LID", "2")
+	tM.redis.HSet("gdata:2", "GID", "2")
+	tM.redis.HSet("gdata:2", "LID", "1")
+	tM.redis.HSet("gdata:2", "PASSWORD", "secret")
+
+	tables := []struct {
+		command string
+		outcome string
+		reason  string
+		count   float64
+	}{
+		{"EGAM", metrics.OutcomeError, "other_lobby", 1},
+		{"EGAM", metrics.OutcomeError, "wrong_password", 2},
+		{"EGAM", metrics.OutcomeSuccess, "", 0},
+		{"GDAT", metrics.OutcomeRejected, "malformed", 1},
+		{"GLST", metrics.OutcomeRejected, "rate_limited", 1},
+		{metrics.UnknownCommand, metrics.OutcomeRejected, "malformed", 2},
+	}
+
+	// Counters are global, only what this test adds counts
+	before := make([]float64, len(tables))
+	for i, table := range tables {
+		before[i] = testutil.ToFloat64(metrics.CommandOutcomes.WithLabelValues("outcomes", table.command, table.outcome, table.reason))
+	}
+
+	client, _ := newRecordedClient()
+	client.IpAddr = &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 40000}
+	client.RedisState = new(core.RedisState)
+	client.RedisState.New(tM.redis, "mm:test")
+	client.State.LobbyID = "1"
+
+	tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "1", "LID": "2", "GID": "1"}))
+	tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "2", "LID": "1", "GID": "2", "PASSWORD": "wrong"}))
+	tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "3", "LID": "1", "GID": "2", "PASSWORD": "guess"}))
+	tM.rejectCommand(testCommand(client, "GDAT", map[string]string{"TID": "4"}), errors.New("missing GID"))
+
+	// Made up queries don't get their own series
+	tM.rejectCommand(testCommand(client, "XXXX", map[string]string{}), errors.New("missing TID"))
+	tM.rejectCommand(testCommand(client, "YYYY", map[string]string{}), errors.New("missing TID"))
+
+	for i := 0; i <= int(tM.config.CommandBurst); i++ {
+		event := testCommand(client, "GLST", map[string]string{"TID": "5"})
+		if !tM.allowCommand(event, true, time.Now()) {
+			tM.rejectRateLimited(event)
+		}
+	}
+
+	for i, table := range tables {
+		count := testutil.ToFloat64(metrics.CommandOutcomes.WithLabelValues("outcomes", table.command, table.outcome, table.reason)) - before[i]
+		if count != table.count {
+			t.Errorf("%s %s/%s count was incorrect, got: %v, want: %v.", table.command, table.outcome, table.reason, count, table.count)
+		}
+	}
+}
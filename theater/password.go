@@ -0,0 +1,40 @@
+package theater
+
+import (
+	"crypto/subtle"
+
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+// passwordKeys are where servers put their password in CGAM/UGAM. They
+// are never sent to clients.
+var passwordKeys = map[string]bool{
+	"PASSWORD":     true,
+	"B-U-password": true,
+}
+
+// serverPassword returns the password a game server was created with
+func serverPassword(gameServer *lib.RedisObject) string {
+	if password := gameServer.Get("PASSWORD"); password != "" {
+		return password
+	}
+	return gameServer.Get("B-U-password")
+}
+
+// passwordFlag is the PW field of GDAT
+func passwordFlag(gameServer *lib.RedisObject) string {
+	if serverPassword(gameServer) != "" {
+		return "1"
+	}
+	return "0"
+}
+
+// checkPassword tells whether a client may join a game server with the
+// password it sent
+func checkPassword(gameServer *lib.RedisObject, password string) bool {
+	expected := serverPassword(gameServer)
+	if expected == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
@@ -0,0 +1,35 @@
+package theater
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+// ParsePlatformNames checks configured PlatformNames, lowercasing what
+// servers advertise so it's matched regardless of case
+func ParsePlatformNames(config map[string]string) (map[string]string, error) {
+	names := make(map[string]string, len(config))
+	for advertised, platform := range config {
+		if advertised == "" || platform == "" {
+			return nil, errors.New("empty platform name for " + advertised)
+		}
+		names[strings.ToLower(advertised)] = platform
+	}
+	return names, nil
+}
+
+// serverPlatform returns the platform a game server runs on, falling back
+// to the configured Platform
+func (tM *TheaterManager) serverPlatform(gameServer *lib.RedisObject) string {
+	advertised := strings.ToLower(gameServer.Get("PL"))
+	if advertised == "" {
+		advertised = strings.ToLower(gameServer.Get("B-U-platform"))
+	}
+
+	if platform, ok := tM.config.PlatformNames[advertised]; ok {
+		return platform
+	}
+	return tM.config.Platform
+}
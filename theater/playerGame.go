@@ -0,0 +1,49 @@
+package theater
+
+import "github.com/HeroesAwaken/GoFesl/GameSpy"
+
+// setPlayerGame notes the game a player is joining. Handlers, join
+// deadlines and the admin endpoint all run on their own goroutines, so the
+// GameID of a client is only accessed through these.
+func (tM *TheaterManager) setPlayerGame(client *GameSpy.Client, gameID string) {
+	tM.playerGamesMutex.Lock()
+	defer tM.playerGamesMutex.Unlock()
+
+	client.State.GameID = gameID
+}
+
+// playerGame returns the game a player is in or joining, if any
+func (tM *TheaterManager) playerGame(client *GameSpy.Client) string {
+	tM.playerGamesMutex.Lock()
+	defer tM.playerGamesMutex.Unlock()
+
+	return client.State.GameID
+}
+
+// leavePlayerGame forgets the game of a player, unless they moved on to
+// another one already
+func (tM *TheaterManager) leavePlayerGame(client *GameSpy.Client, gameID string) {
+	tM.playerGamesMutex.Lock()
+	defer tM.playerGamesMutex.Unlock()
+
+	if client.State.GameID == gameID {
+		client.State.GameID = ""
+	}
+}
+
+// playerLeft forgets the game of every client in shard playing as pid once
+// the server reports them gone
+func (tM *TheaterManager) playerLeft(shard string, gameID string, pid string) {
+	if tM.socket == nil {
+		return
+	}
+
+	for _, client := range tM.socket.ConnectedClients() {
+		if client.State.IsServer || client.State.Shard != shard || client.RedisState == nil || tM.playerGame(client) != gameID {
+			continue
+		}
+		if client.RedisState.Get("id") == pid {
+			tM.leavePlayerGame(client, gameID)
+		}
+	}
+}
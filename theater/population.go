@@ -0,0 +1,89 @@
+package theater
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/HeroesAwaken/GoFesl/log"
+)
+
+const (
+	// populationHistoryLength is the amount of snapshots we keep per server
+	populationHistoryLength = 60
+	// populationSnapshotInterval is the time between two snapshots
+	populationSnapshotInterval = time.Minute
+)
+
+func populationHistoryKey(shard string, gameID string) string {
+	return shardKey(shard, "gpop:"+gameID)
+}
+
+// snapshotPopulation pushes the current amount of active players of each
+// game of a shard onto its history, dropping the oldest entries past the
+// limit
+func (tM *TheaterManager) snapshotPopulation(shard string, gameIDs []string) {
+	for _, gameID := range gameIDs {
+		activePlayers := tM.redis.HGet(gameDataPrefix(shard)+":"+gameID, "AP").Val()
+		if activePlayers == "" {
+			activePlayers = "0"
+		}
+
+		key := populationHistoryKey(shard, gameID)
+		err := tM.redis.LPush(key, activePlayers).Err()
+		if err != nil {
+			log.Errorln("Failed storing population snapshot for "+gameID, err.Error())
+			continue
+		}
+		tM.redis.LTrim(key, 0, populationHistoryLength-1)
+	}
+}
+
+// populationHistory returns the stored snapshots of a game, oldest first
+func (tM *TheaterManager) populationHistory(shard string, gameID string) []string {
+	history := tM.redis.LRange(populationHistoryKey(shard, gameID), 0, populationHistoryLength-1).Val()
+
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+
+	return history
+}
+
+// hostedGameIDs returns the GIDs of all servers connected to this manager,
+// grouped by shard
+func (tM *TheaterManager) hostedGameIDs() map[string][]string {
+	gameIDs := make(map[string][]string)
+	for _, client := range tM.socket.ConnectedClients() {
+		if client.RedisState == nil {
+			continue
+		}
+		if gameID := client.RedisState.Get("gdata:GID"); gameID != "" {
+			gameIDs[client.State.Shard] = append(gameIDs[client.State.Shard], gameID)
+		}
+	}
+	return gameIDs
+}
+
+func (tM *TheaterManager) runPopulationSnapshots() {
+	for {
+		select {
+		case <-tM.populationTicker.C:
+			for shard, gameIDs := range tM.hostedGameIDs() {
+				tM.snapshotPopulation(shard, gameIDs)
+			}
+		case <-tM.stopPopulation:
+			return
+		}
+	}
+}
+
+func populationAnswer(tid string, gameID string, history []string) map[string]string {
+	answer := make(map[string]string)
+	answer["TID"] = tid
+	answer["GID"] = gameID
+	for i, activePlayers := range history {
+		answer["POP."+strconv.Itoa(i)] = activePlayers
+	}
+	answer["POP.[]"] = strconv.Itoa(len(history))
+	return answer
+}
@@ -0,0 +1,46 @@
+package theater
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestPopulationHistory(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	for _, activePlayers := range []string{"0", "4", "9", "7"} {
+		tM.redis.HSet("gdata:1", "AP", activePlayers)
+		tM.snapshotPopulation("", []string{"1"})
+	}
+
+	history := tM.populationHistory("", "1")
+	want := []string{"0", "4", "9", "7"}
+	if !reflect.DeepEqual(history, want) {
+		t.Errorf("populationHistory was incorrect, got: %v, want: %v.", history, want)
+	}
+
+	answer := populationAnswer("3", "1", history)
+	if answer["POP.[]"] != "4" || answer["POP.2"] != "9" {
+		t.Errorf("populationAnswer was incorrect, got: %v.", answer)
+	}
+}
+
+func TestPopulationHistoryIsBounded(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	for i := 0; i < populationHistoryLength+10; i++ {
+		tM.redis.HSet("gdata:1", "AP", strconv.Itoa(i))
+		tM.snapshotPopulation("", []string{"1"})
+	}
+
+	history := tM.populationHistory("", "1")
+	if len(history) != populationHistoryLength {
+		t.Errorf("populationHistory was incorrect, got length: %d, want: %d.", len(history), populationHistoryLength)
+	}
+	if history[len(history)-1] != strconv.Itoa(populationHistoryLength+9) {
+		t.Errorf("populationHistory was incorrect, got newest: %s, want: %d.", history[len(history)-1], populationHistoryLength+9)
+	}
+}
@@ -0,0 +1,85 @@
+package theater
+
+import (
+	"time"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/HeroesAwaken/GoFesl/metrics"
+)
+
+// tokenBucket refills rate tokens per second up to burst, a command takes one
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+
+	// dropped is the last command over the limit
+	dropped *GameSpy.CommandFESL
+}
+
+func (bucket *tokenBucket) take(now time.Time, rate float64, burst float64) bool {
+	if bucket.last.IsZero() {
+		bucket.tokens = burst
+	} else {
+		bucket.tokens += now.Sub(bucket.last).Seconds() * rate
+		if bucket.tokens > burst {
+			bucket.tokens = burst
+		}
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// allowCommand checks a command against the rate limit of its client. Every
+// command arrives twice, as client.command.X first and then as
+// client.command, only the first one takes a token and the second one
+// shares its fate.
+func (tM *TheaterManager) allowCommand(event GameSpy.EventClientFESLCommand, first bool, now time.Time) bool {
+	tM.rateLimitsMutex.Lock()
+	defer tM.rateLimitsMutex.Unlock()
+
+	bucket, ok := tM.rateLimits[event.Client]
+	if !ok {
+		bucket = new(tokenBucket)
+		tM.rateLimits[event.Client] = bucket
+	}
+
+	if !first {
+		return bucket.dropped != event.Command
+	}
+
+	rate, burst := tM.config.CommandsPerSecond, tM.config.CommandBurst
+	if event.Client.State.IsServer {
+		rate, burst = tM.config.ServerCommandsPerSecond, tM.config.ServerCommandBurst
+	}
+
+	if bucket.take(now, rate, burst) {
+		return true
+	}
+
+	bucket.dropped = event.Command
+	return false
+}
+
+// forgetRateLimit drops the bucket of a client that's gone
+func (tM *TheaterManager) forgetRateLimit(client *GameSpy.Client) {
+	tM.rateLimitsMutex.Lock()
+	delete(tM.rateLimits, client)
+	tM.rateLimitsMutex.Unlock()
+}
+
+func (tM *TheaterManager) rejectRateLimited(event GameSpy.EventClientFESLCommand) {
+	log.Warningln("Dropping command", event.Command.Query, "from", event.Client.IpAddr, "over the rate limit")
+	metrics.CommandOutcome(tM.name, metrics.CommandLabel(event.Command.Query, knownQueries), metrics.OutcomeRejected, "rate_limited")
+
+	if !tM.config.AnswerRateLimited {
+		return
+	}
+
+	tM.writeError(event.Client, event.Command.Query, event.Command.Message["TID"], GameSpy.ErrorCodeRateLimited, "Too many requests, slow down.")
+}
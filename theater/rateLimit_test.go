@@ -0,0 +1,73 @@
+package theater
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+)
+
+func TestAllowCommandBurst(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	client, _ := newRecordedClient()
+	server, _ := newRecordedClient()
+	server.State.IsServer = true
+
+	now := time.Now()
+
+	tables := []struct {
+		client  *GameSpy.Client
+		burst   float64
+		allowed int
+	}{
+		{client, tM.config.CommandBurst * 2, int(tM.config.CommandBurst)},
+		{server, tM.config.ServerCommandBurst * 2, int(tM.config.ServerCommandBurst)},
+	}
+
+	for _, table := range tables {
+		allowed := 0
+		for i := 0; i < int(table.burst); i++ {
+			event := testCommand(table.client, "GDAT", map[string]string{"TID": "1"})
+			if tM.allowCommand(event, true, now) {
+				allowed++
+			}
+		}
+
+		if allowed != table.allowed {
+			t.Errorf("Allowed commands of a burst were incorrect, got: %d, want: %d.", allowed, table.allowed)
+		}
+	}
+
+	// Tokens come back over time
+	event := testCommand(client, "GDAT", map[string]string{"TID": "2"})
+	if !tM.allowCommand(event, true, now.Add(time.Second)) {
+		t.Errorf("Command after waiting was incorrect, got: %t, want: %t.", false, true)
+	}
+}
+
+func TestAllowCommandDropsBothEvents(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	client, _ := newRecordedClient()
+	now := time.Now()
+
+	for i := 0; i < int(tM.config.CommandBurst); i++ {
+		tM.allowCommand(testCommand(client, "GDAT", map[string]string{}), true, now)
+	}
+
+	dropped := testCommand(client, "GDAT", map[string]string{})
+	if tM.allowCommand(dropped, true, now) {
+		t.Fatalf("Command over the limit was incorrect, got: %t, want: %t.", true, false)
+	}
+	if tM.allowCommand(dropped, false, now) {
+		t.Errorf("Second event of a dropped command was incorrect, got: %t, want: %t.", true, false)
+	}
+
+	tM.forgetRateLimit(client)
+	if !tM.allowCommand(testCommand(client, "GDAT", map[string]string{}), true, now) {
+		t.Errorf("Command after forgetting the client was incorrect, got: %t, want: %t.", false, true)
+	}
+}
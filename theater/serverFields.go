@@ -0,0 +1,27 @@
+package theater
+
+// protocolKeys only matter to the command they're sent with, they aren't
+// part of what describes a game server
+var protocolKeys = map[string]bool{
+	"TID": true,
+	"TXN": true,
+}
+
+// theaterKeys are game data the theater keeps itself, servers sending them
+// would overwrite what the theater knows
+var theaterKeys = map[string]bool{
+	numObserversKey: true,
+	regionKey:       true,
+}
+
+// storedInRedis tells whether a CGAM/UGAM key is kept in the game data
+// clients get to see through GDAT and GLST
+func storedInRedis(key string) bool {
+	return !protocolKeys[key] && !theaterKeys[key]
+}
+
+// storedInDB tells whether a CGAM/UGAM key is written to game_server_stats.
+// The GID is already the row's gid, and passwords stay out of the db.
+func storedInDB(key string) bool {
+	return storedInRedis(key) && !passwordKeys[key] && key != "GID"
+}
@@ -0,0 +1,69 @@
+package theater
+
+import (
+	"strings"
+	"time"
+
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/log"
+	"github.com/HeroesAwaken/GoFesl/matchmaking"
+)
+
+// serverIdentityTTL is how long a server which went away can come back and
+// get its GID again
+const serverIdentityTTL = time.Hour
+
+// serverIdentities are how a game server is recognized when it creates its
+// game again, by the UGID it sends or else the address it's reachable at.
+// Anyone can send any UGID, so it only counts together with the account the
+// server logged in with.
+func serverIdentities(shard string, account string, ugid string, ip string, port string) []string {
+	var identities []string
+	if ugid != "" && account != "" {
+		identities = append(identities, shardKey(shard, "gserver:ugid:"+account+":"+ugid))
+	}
+	return append(identities, shardKey(shard, "gserver:addr:"+ip+":"+port))
+}
+
+// knownGameID returns the GID a server had before, empty for new servers
+func (tM *TheaterManager) knownGameID(identities []string) string {
+	for _, identity := range identities {
+		if gameID := tM.redis.Get(identity).Val(); gameID != "" {
+			return gameID
+		}
+	}
+	return ""
+}
+
+// rememberGameID stores the GID of a server for when it creates its game
+// again. They're kept while the server is connected, see forgetGameID.
+func (tM *TheaterManager) rememberGameID(client *GameSpy.Client, identities []string, gameID string) {
+	for _, identity := range identities {
+		tM.redis.Set(identity, gameID, 0)
+	}
+	client.RedisState.Set("gdata:identities", strings.Join(identities, " "))
+}
+
+// forgetGameID lets the identities of a server which went away expire after
+// serverIdentityTTL, unless another server took them over already
+func (tM *TheaterManager) forgetGameID(client *GameSpy.Client, gameID string) {
+	for _, identity := range strings.Fields(client.RedisState.Get("gdata:identities")) {
+		if tM.redis.Get(identity).Val() == gameID {
+			tM.redis.Expire(identity, serverIdentityTTL)
+		}
+	}
+}
+
+// takeOverGameServer resets what's left of the previous game of a server
+// creating it again. The game is handed to the new connection first, so a
+// previous one still around can be closed without its close removing the
+// game again.
+func (tM *TheaterManager) takeOverGameServer(client *GameSpy.Client, shard string, gameID string) {
+	log.Noteln("Game server " + gameID + " created its game again, reusing it")
+
+	if previous, ok := matchmaking.ReplaceGame(shardKey(shard, gameID), client); ok && previous != client {
+		previous.Close()
+	}
+
+	tM.removeGameServer(shard, gameID)
+}
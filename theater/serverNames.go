@@ -0,0 +1,71 @@
+package theater
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Policies for servers registering with a name already in use on their shard
+const (
+	ServerNamesAllow  = "allow"
+	ServerNamesReject = "reject"
+	ServerNamesSuffix = "suffix"
+)
+
+var errServerNameTaken = errors.New("server name taken")
+
+// serverNamesKey is the index of the names of the servers of a shard, it
+// maps lowercased names to the GID using them
+func serverNamesKey(shard string) string {
+	return shardKey(shard, "servernames")
+}
+
+// claimServerName applies the ServerNamePolicy to the name a server wants and
+// returns the name it gets. Callers hold serverNamesMutex until the name is
+// stored.
+func (tM *TheaterManager) claimServerName(shard string, gameID string, name string) (string, error) {
+	if tM.config.ServerNamePolicy == ServerNamesAllow || name == "" {
+		return name, nil
+	}
+
+	if tM.serverNameFree(shard, gameID, name) {
+		tM.redis.HSet(serverNamesKey(shard), strings.ToLower(name), gameID)
+		return name, nil
+	}
+
+	if tM.config.ServerNamePolicy == ServerNamesReject {
+		return "", errServerNameTaken
+	}
+
+	for i := 2; ; i++ {
+		suffixed := name + " (" + strconv.Itoa(i) + ")"
+		if tM.serverNameFree(shard, gameID, suffixed) {
+			tM.redis.HSet(serverNamesKey(shard), strings.ToLower(suffixed), gameID)
+			return suffixed, nil
+		}
+	}
+}
+
+// serverNameFree checks whether gameID may use name
+func (tM *TheaterManager) serverNameFree(shard string, gameID string, name string) bool {
+	owner := tM.redis.HGet(serverNamesKey(shard), strings.ToLower(name)).Val()
+	if owner == "" || owner == gameID {
+		return true
+	}
+
+	// Left behind by a server which is gone or renamed
+	stored := tM.redis.HGet(gameDataPrefix(shard)+":"+owner, "NAME").Val()
+	return !strings.EqualFold(stored, name)
+}
+
+// releaseServerName drops name from the index, if gameID is the one using it
+func (tM *TheaterManager) releaseServerName(shard string, gameID string, name string) {
+	if name == "" {
+		return
+	}
+
+	if tM.redis.HGet(serverNamesKey(shard), strings.ToLower(name)).Val() == gameID {
+		tM.redis.HDel(serverNamesKey(shard), strings.ToLower(name))
+	}
+}
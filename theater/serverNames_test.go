@@ -0,0 +1,107 @@
+package theater
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestClaimServerName(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.config.ServerNamePolicy = ServerNamesReject
+	for gameID, name := range map[string]string{"1": "Heroes Server", "2": "Heroes Server (2)"} {
+		tM.redis.HSet("gdata:"+gameID, "NAME", name)
+		if _, err := tM.claimServerName("", gameID, name); err != nil {
+			t.Fatalf("claimServerName(%s) failed: %s", name, err)
+		}
+	}
+	// Other shards don't count
+	tM.redis.HSet("eu:gdata:1", "NAME", "EU Server")
+	tM.claimServerName("eu", "1", "EU Server")
+	// Neither do servers which are gone
+	tM.redis.HSet(serverNamesKey(""), "old server", "9")
+
+	tables := []struct {
+		policy      string
+		name        string
+		want        string
+		shouldError bool
+	}{
+		{ServerNamesAllow, "Heroes Server", "Heroes Server", false},
+		{ServerNamesReject, "Heroes Server", "", true},
+		{ServerNamesReject, "heroes server", "", true},
+		{ServerNamesReject, "EU Server", "EU Server", false},
+		{ServerNamesReject, "Old Server", "Old Server", false},
+		{ServerNamesSuffix, "Heroes Server", "Heroes Server (3)", false},
+		{ServerNamesSuffix, "Other Server", "Other Server", false},
+	}
+
+	for _, table := range tables {
+		tM.config.ServerNamePolicy = table.policy
+
+		name, err := tM.claimServerName("", "5", table.name)
+		if (err != nil) != table.shouldError {
+			t.Errorf("claimServerName(%s) with policy %s was incorrect, got error: %v.", table.name, table.policy, err)
+			continue
+		}
+		if name != table.want {
+			t.Errorf("claimServerName(%s) with policy %s was incorrect, got: %s, want: %s.", table.name, table.policy, name, table.want)
+		}
+		tM.releaseServerName("", "5", name)
+	}
+}
+
+func TestServerNamePolicyThroughCGAMAndUGAM(t *testing.T) {
+	l, cleanup := newTestLifecycle(t)
+	defer cleanup()
+
+	l.tM.config.ServerNamePolicy = ServerNamesReject
+
+	create := func(server *lifecycleClient, name string, port string) map[string]string {
+		return l.send(server, "CGAM", map[string]string{
+			"TID": "2", "LID": "1", "NAME": "\"" + name + "\"", "PORT": port, "MAX-PLAYERS": "16", "JOIN": "O",
+		})
+	}
+
+	l.mock.ExpectPrepare("INSERT INTO game_server_stats").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	l.mock.ExpectExec("INSERT INTO games").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	first := l.connect("203.0.113.5", 40000)
+	created := create(first, "Heroes Server", "18567")
+	if created["GID"] == "" {
+		t.Fatalf("CGAM was incorrect, got: %v, want a GID.", created)
+	}
+
+	// A second server can't take the name, whatever its case
+	second := l.connect("203.0.113.6", 40000)
+	if rejected := create(second, "heroes server", "18567"); rejected["errorCode"] != "105" {
+		t.Errorf("CGAM with a taken name was incorrect, got: %v, want errorCode: %s.", rejected, "105")
+	}
+
+	l.mock.ExpectExec("INSERT INTO game_server_stats").WillReturnResult(sqlmock.NewResult(0, 1))
+	l.mock.ExpectExec("INSERT INTO games").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	other := create(second, "Other Server", "18567")
+	if other["GID"] == "" || other["GID"] == created["GID"] {
+		t.Fatalf("CGAM was incorrect, got: %v, want a new GID.", other)
+	}
+
+	// ... nor rename itself to it later
+	l.sendQuiet(second, "UGAM", map[string]string{"TID": "3", "GID": other["GID"], "NAME": "\"Heroes Server\""})
+	if name := l.tM.redis.HGet("gdata:"+other["GID"], "NAME").Val(); name != "Other Server" {
+		t.Errorf("UGAM with a taken name was incorrect, got NAME: %s, want: %s.", name, "Other Server")
+	}
+
+	// Renaming frees the old name
+	l.sendQuiet(first, "UGAM", map[string]string{"TID": "4", "GID": created["GID"], "NAME": "\"Renamed Server\""})
+	l.sendQuiet(second, "UGAM", map[string]string{"TID": "5", "GID": other["GID"], "NAME": "\"Heroes Server\""})
+	if name := l.tM.redis.HGet("gdata:"+other["GID"], "NAME").Val(); name != "Heroes Server" {
+		t.Errorf("UGAM with a freed name was incorrect, got NAME: %s, want: %s.", name, "Heroes Server")
+	}
+
+	if err := l.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("CGAM database calls were incorrect: %s", err)
+	}
+}
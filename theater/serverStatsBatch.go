@@ -0,0 +1,140 @@
+package theater
+
+import (
+	"database/sql"
+
+	"github.com/HeroesAwaken/GoFesl/lib"
+	"github.com/HeroesAwaken/GoFesl/log"
+)
+
+// serverRef identifies a game server across shards
+type serverRef struct {
+	shard  string
+	gameID string
+}
+
+// queueServerStats remembers the latest value of a server stat until the
+// next flush, older values of the same key get overwritten
+func (tM *TheaterManager) queueServerStats(shard string, gameID string, key string, value string) {
+	tM.pendingServerStatsMutex.Lock()
+	defer tM.pendingServerStatsMutex.Unlock()
+
+	server := serverRef{shard, gameID}
+	if _, ok := tM.pendingServerStats[server]; !ok {
+		tM.pendingServerStats[server] = make(map[string]string)
+	}
+	tM.pendingServerStats[server][key] = value
+}
+
+// dropServerStats forgets pending stats of a server which is going away
+func (tM *TheaterManager) dropServerStats(shard string, gameID string) {
+	tM.pendingServerStatsMutex.Lock()
+	delete(tM.pendingServerStats, serverRef{shard, gameID})
+	tM.pendingServerStatsMutex.Unlock()
+}
+
+// serverStatsChunk is the most stats written with one statement, which
+// bounds both the statements prepared for it and their placeholders
+const serverStatsChunk = 64
+
+// flushServerStats writes the pending stats of each server in its own
+// transaction. Stats of servers which couldn't be written are queued again
+// for the next flush.
+func (tM *TheaterManager) flushServerStats() {
+	tM.pendingServerStatsMutex.Lock()
+	pending := tM.pendingServerStats
+	tM.pendingServerStats = make(map[serverRef]map[string]string)
+	tM.pendingServerStatsMutex.Unlock()
+
+	failed := 0
+	for server, stats := range pending {
+		// Deadlocks with other writers and lost connections are retried
+		err := tM.db.Retry(func() error {
+			return tM.writeServerStats(server, stats)
+		})
+		if err != nil {
+			log.Errorln("Failed to flush stats for game server "+server.gameID, err.Error())
+			tM.requeueServerStats(server, stats)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		log.Errorln("Failed to flush stats for", failed, "of", len(pending), "game servers")
+	}
+}
+
+// requeueServerStats puts stats which couldn't be written back, unless they
+// were updated in the meantime or the server is gone
+func (tM *TheaterManager) requeueServerStats(server serverRef, stats map[string]string) {
+	if tM.redis.Exists(gameDataPrefix(server.shard)+":"+server.gameID).Val() == 0 {
+		return
+	}
+
+	tM.pendingServerStatsMutex.Lock()
+	defer tM.pendingServerStatsMutex.Unlock()
+
+	if _, ok := tM.pendingServerStats[server]; !ok {
+		tM.pendingServerStats[server] = make(map[string]string)
+	}
+	for key, value := range stats {
+		if _, ok := tM.pendingServerStats[server][key]; !ok {
+			tM.pendingServerStats[server][key] = value
+		}
+	}
+}
+
+// serverStatsWrite is one statement of a serverStatsChunk of stats
+type serverStatsWrite struct {
+	statement *lib.Stmt
+	args      []interface{}
+}
+
+func (tM *TheaterManager) writeServerStats(server serverRef, stats map[string]string) error {
+	// Prepared up front, inside the transaction they'd be prepared twice
+	var writes []serverStatsWrite
+	var args []interface{}
+	for key, value := range stats {
+		args = append(args, server.gameID, dbShard(server.shard), key, value)
+		if len(args) == serverStatsChunk*4 {
+			writes = append(writes, serverStatsWrite{args: args})
+			args = nil
+		}
+	}
+	if len(args) > 0 {
+		writes = append(writes, serverStatsWrite{args: args})
+	}
+	for i := range writes {
+		statement, err := tM.setServerStatsStatements.Get(len(writes[i].args) / 4)
+		if err != nil {
+			return err
+		}
+		writes[i].statement = statement
+	}
+
+	tx, err := tM.db.Conn().Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(tM.stmtUpdateGame.Stmt()).Exec(server.gameID, dbShard(server.shard))
+	if err != nil {
+		return rollback(tx, err)
+	}
+
+	for _, write := range writes {
+		_, err = tx.Stmt(write.statement.Stmt()).Exec(write.args...)
+		if err != nil {
+			return rollback(tx, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func rollback(tx *sql.Tx, err error) error {
+	if rollbackErr := tx.Rollback(); rollbackErr != nil {
+		log.Errorln("Rollback failed", rollbackErr.Error())
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package theater
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFlushServerStatsInChunks(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	mock := newTestDB(t, tM)
+	mock.ExpectPrepare("UPDATE games")
+	tM.stmtUpdateGame, _ = tM.db.Prepare("UPDATE games SET updated_at = NOW() WHERE gid = ? AND shard = ?")
+
+	for i := 0; i < serverStatsChunk+6; i++ {
+		tM.queueServerStats("", "1", "B-U-key"+strconv.Itoa(i), "value")
+	}
+
+	chunk := mock.ExpectPrepare("INSERT INTO game_server_stats")
+	rest := mock.ExpectPrepare("INSERT INTO game_server_stats")
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE games").WithArgs("1", dbShard("")).WillReturnResult(sqlmock.NewResult(0, 1))
+	chunk.ExpectExec().WillReturnResult(sqlmock.NewResult(0, int64(serverStatsChunk)))
+	rest.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 6))
+	mock.ExpectCommit()
+
+	tM.flushServerStats()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("flushServerStats database calls were incorrect: %s", err)
+	}
+}
+
+func TestFlushServerStatsRequeuesFailures(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	mock := newTestDB(t, tM)
+	mock.ExpectPrepare("UPDATE games")
+	tM.stmtUpdateGame, _ = tM.db.Prepare("UPDATE games SET updated_at = NOW() WHERE gid = ? AND shard = ?")
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+	tM.queueServerStats("", "1", "B-U-map", "village")
+
+	mock.ExpectPrepare("INSERT INTO game_server_stats")
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE games").WillReturnError(errors.New("table is full"))
+	mock.ExpectRollback()
+
+	tM.flushServerStats()
+
+	// Newer values queued in the meantime win over the failed ones
+	tM.queueServerStats("", "1", "B-U-map", "bridge")
+	tM.requeueServerStats(serverRef{"", "1"}, map[string]string{"B-U-map": "village", "B-U-mode": "conquest"})
+
+	tM.pendingServerStatsMutex.Lock()
+	pending := tM.pendingServerStats[serverRef{"", "1"}]
+	tM.pendingServerStatsMutex.Unlock()
+	if pending["B-U-map"] != "bridge" || pending["B-U-mode"] != "conquest" {
+		t.Errorf("flushServerStats pending stats were incorrect, got: %v.", pending)
+	}
+
+	// Stats of servers which are gone aren't kept
+	tM.requeueServerStats(serverRef{"", "2"}, map[string]string{"B-U-map": "village"})
+	tM.pendingServerStatsMutex.Lock()
+	_, ok := tM.pendingServerStats[serverRef{"", "2"}]
+	tM.pendingServerStatsMutex.Unlock()
+	if ok {
+		t.Errorf("requeueServerStats was incorrect, stats of a removed server were queued.")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("flushServerStats database calls were incorrect: %s", err)
+	}
+}
+
+func TestFlushServerStatsKeepsShardsApart(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	mock := newTestDB(t, tM)
+	mock.ExpectPrepare("UPDATE games")
+	tM.stmtUpdateGame, _ = tM.db.Prepare("UPDATE games SET updated_at = NOW() WHERE gid = ? AND shard = ?")
+
+	// GIDs are counted per shard, so both shards have a server 1
+	tM.queueServerStats("eu", "1", "B-U-map", "village")
+
+	insert := mock.ExpectPrepare("INSERT INTO game_server_stats")
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE games").WithArgs("1", dbShard("eu")).WillReturnResult(sqlmock.NewResult(0, 1))
+	insert.ExpectExec().WithArgs("1", dbShard("eu"), "B-U-map", "village").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tM.flushServerStats()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("flushServerStats database calls were incorrect: %s", err)
+	}
+}
@@ -0,0 +1,75 @@
+package theater
+
+import (
+	"net"
+	"sort"
+)
+
+// ShardNetworks maps each shard to the networks its players connect from.
+// Clients outside of all of them belong to the default shard "", which
+// uses the plain redis keys.
+var ShardNetworks map[string][]*net.IPNet
+
+// ParseShardNetworks turns the CIDRs configured for each shard into networks
+func ParseShardNetworks(shards map[string][]string) (map[string][]*net.IPNet, error) {
+	networks := make(map[string][]*net.IPNet)
+
+	for shard, cidrs := range shards {
+		for _, cidr := range cidrs {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, err
+			}
+			networks[shard] = append(networks[shard], network)
+		}
+	}
+
+	return networks, nil
+}
+
+// shardForAddr returns the shard of a client connecting from addr
+func shardForAddr(addr net.Addr) string {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+
+	// Sorted, so overlapping networks always resolve to the same shard
+	var shards []string
+	for shard := range ShardNetworks {
+		shards = append(shards, shard)
+	}
+	sort.Strings(shards)
+
+	for _, shard := range shards {
+		for _, network := range ShardNetworks[shard] {
+			if network.Contains(tcpAddr.IP) {
+				return shard
+			}
+		}
+	}
+
+	return ""
+}
+
+// shardKey namespaces a redis key by shard
+func shardKey(shard string, key string) string {
+	if shard == "" {
+		return key
+	}
+	return shard + ":" + key
+}
+
+// gameDataPrefix is the RedisObject prefix of the game servers of a shard
+func gameDataPrefix(shard string) string {
+	return shardKey(shard, "gdata")
+}
+
+// dbShard is what goes into the shard column of games. GIDs are only
+// unique within a shard, so rows of different shards need telling apart.
+func dbShard(shard string) string {
+	if shard == "" {
+		return Shard
+	}
+	return Shard + "-" + shard
+}
@@ -0,0 +1,43 @@
+package theater
+
+import (
+	"net"
+	"testing"
+)
+
+func TestShardForAddr(t *testing.T) {
+	networks, err := ParseShardNetworks(map[string][]string{
+		"eu": {"10.1.0.0/16", "2001:db8:1::/48"},
+		"na": {"10.2.0.0/16"},
+	})
+	if err != nil {
+		t.Fatalf("ParseShardNetworks failed: %s", err)
+	}
+	previous := ShardNetworks
+	ShardNetworks = networks
+	defer func() { ShardNetworks = previous }()
+
+	tables := []struct {
+		ip    string
+		shard string
+	}{
+		{"10.1.4.2", "eu"},
+		{"2001:db8:1::5", "eu"},
+		{"10.2.0.1", "na"},
+		{"192.168.1.1", ""},
+	}
+
+	for _, table := range tables {
+		shard := shardForAddr(&net.TCPAddr{IP: net.ParseIP(table.ip), Port: 18275})
+		if shard != table.shard {
+			t.Errorf("shardForAddr of %s was incorrect, got: %s, want: %s.", table.ip, shard, table.shard)
+		}
+	}
+}
+
+func TestParseShardNetworksInvalid(t *testing.T) {
+	_, err := ParseShardNetworks(map[string][]string{"eu": {"10.1.0.0"}})
+	if err == nil {
+		t.Errorf("ParseShardNetworks was incorrect, accepted a CIDR without prefix length")
+	}
+}
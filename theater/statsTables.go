@@ -0,0 +1,19 @@
+package theater
+
+import (
+	"github.com/HeroesAwaken/GoFesl/GameSpy"
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+// StatsTables maps the clientString of a game to the table its hero stats
+// are kept in, the same as fesl.StatsTables
+var StatsTables lib.StatsTables
+
+// statsTable returns the stats table of the game a client is playing. FESL
+// hands the clientString over with the LKEY of USER.
+func statsTable(client *GameSpy.Client) string {
+	if client.RedisState == nil {
+		return lib.DefaultStatsTable
+	}
+	return StatsTables.For(client.RedisState.Get("clientString"))
+}
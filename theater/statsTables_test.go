@@ -0,0 +1,42 @@
+package theater
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+func TestStatsTableFromLKEY(t *testing.T) {
+	StatsTables = lib.StatsTables{"game-a": "game_a_stats"}
+	defer func() { StatsTables = nil }()
+
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	mock := newTestDB(t, tM)
+
+	tM.redis.HSet("lkeys:abc", "id", "7")
+	tM.redis.HSet("lkeys:abc", "clientString", "game-a")
+
+	client, _ := newRecordedClient()
+	tM.USER(testCommand(client, "USER", map[string]string{"TID": "3", "LKEY": "abc"}))
+
+	table := statsTable(client)
+	if table != "game_a_stats" {
+		t.Fatalf("statsTable was incorrect, got: %s, want: %s.", table, "game_a_stats")
+	}
+
+	rows := sqlmock.NewRows([]string{"user_id", "id", "heroName", "statsKey", "statsValue"}).
+		AddRow("42", "7", "Hero", "level", "12")
+	mock.ExpectPrepare("LEFT JOIN game_a_stats AS stats").ExpectQuery().WithArgs("c_kit", "c_team", "elo", "level", "7").WillReturnRows(rows)
+
+	stats, err := tM.playerStats(table, "7")
+	if err != nil || stats["level"] != "12" {
+		t.Errorf("playerStats was incorrect, got: %v, %v, want level: %s.", stats, err, "12")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("playerStats was incorrect, %s", err)
+	}
+}
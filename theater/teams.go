@@ -0,0 +1,57 @@
+package theater
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+// balancedTeam picks the team a joining player should play for, so joins
+// fill up the lighter side.
+//
+// B-U-army_distribution holds the amount of players per army, observers
+// aren't part of it. Servers which don't report it are balanced by
+// B-U-army_balance, the amount of players army 1 has over army 2. An even
+// (or empty) server always gets army 1 first.
+func balancedTeam(gameServer *lib.RedisObject) string {
+	if team1, team2, ok := armyDistribution(gameServer.Get("B-U-army_distribution")); ok {
+		if team2 < team1 {
+			return "2"
+		}
+		return "1"
+	}
+
+	balance, err := strconv.Atoi(gameServer.Get("B-U-army_balance"))
+	if err == nil && balance > 0 {
+		return "2"
+	}
+	return "1"
+}
+
+// armyDistribution parses the player counts of both armies
+func armyDistribution(distribution string) (int, int, bool) {
+	counts := strings.Split(distribution, ",")
+	if len(counts) < 2 {
+		return 0, 0, false
+	}
+
+	team1, err := strconv.Atoi(strings.TrimSpace(counts[0]))
+	if err != nil {
+		return 0, 0, false
+	}
+	team2, err := strconv.Atoi(strings.TrimSpace(counts[1]))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return team1, team2, true
+}
+
+// statOrDefault returns a stat, or def if the hero doesn't have it yet
+func statOrDefault(stats map[string]string, key string, def string) string {
+	if value := stats[key]; value != "" {
+		return value
+	}
+	return def
+}
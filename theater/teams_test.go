@@ -0,0 +1,48 @@
+package theater
+
+import (
+	"testing"
+
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+func TestBalancedTeam(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tables := []struct {
+		distribution string
+		balance      string
+		team         string
+	}{
+		{"", "", "1"},
+		{"0,0", "", "1"},
+		{"3,3", "", "1"},
+		{"4,2", "", "2"},
+		{"2,4", "", "1"},
+		{"5, 3", "-4", "2"},
+		{"", "2", "2"},
+		{"", "-1", "1"},
+		{"", "0", "1"},
+		{"garbage", "3", "2"},
+	}
+
+	for _, table := range tables {
+		tM.redis.Del("gdata:1")
+		tM.redis.HSet("gdata:1", "GID", "1")
+		if table.distribution != "" {
+			tM.redis.HSet("gdata:1", "B-U-army_distribution", table.distribution)
+		}
+		if table.balance != "" {
+			tM.redis.HSet("gdata:1", "B-U-army_balance", table.balance)
+		}
+
+		gameServer := new(lib.RedisObject)
+		gameServer.New(tM.redis, "gdata", "1")
+
+		team := balancedTeam(gameServer)
+		if team != table.team {
+			t.Errorf("balancedTeam(%q, %q) was incorrect, got: %s, want: %s.", table.distribution, table.balance, team, table.team)
+		}
+	}
+}
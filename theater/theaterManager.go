@@ -1,10 +1,13 @@
 package theater
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/HeroesAwaken/GoAwaken/core"
@@ -12,6 +15,7 @@ import (
 	"github.com/HeroesAwaken/GoFesl/lib"
 	"github.com/HeroesAwaken/GoFesl/log"
 	"github.com/HeroesAwaken/GoFesl/matchmaking"
+	"github.com/HeroesAwaken/GoFesl/metrics"
 	"github.com/go-redis/redis"
 )
 
@@ -60,80 +64,175 @@ type GameServer struct {
 type TheaterManager struct {
 	name             string
 	socket           *GameSpy.Socket
-	socketUDP        *GameSpy.SocketUDP
-	db               *sql.DB
+	socketUDP        GameSpy.FESLWriterUDP
+	db               *lib.DB
 	redis            *redis.Client
 	eventsChannel    chan GameSpy.SocketEvent
 	eventsChannelUDP chan GameSpy.SocketUDPEvent
 	batchTicker      *time.Ticker
 	stopTicker       chan bool
+	populationTicker *time.Ticker
+	stopPopulation   chan bool
 	cacheCounters    *lib.RedisObject
 	iDB              *core.InfluxDB
 	localMode        bool
+	config           Config
+	bans             *lib.BanChecker
+
+	advertisedPorts      map[string]map[*GameSpy.Client]string
+	advertisedPortsMutex sync.Mutex
+
+	scanSlots chan struct{}
+
+	serverNamesMutex sync.Mutex
+
+	// GID each client wants GDAT updates for
+	gdatSubscriptions      map[*GameSpy.Client]string
+	gdatSubscriptionsMutex sync.Mutex
+
+	// Command rate limit of each client
+	rateLimits      map[*GameSpy.Client]*tokenBucket
+	rateLimitsMutex sync.Mutex
+
+	// Server stats waiting for the next batchTicker flush, by server
+	pendingServerStats      map[serverRef]map[string]string
+	pendingServerStatsMutex sync.Mutex
+
+	// Joins which haven't reached PENT yet, by player and game
+	pendingJoins      map[joinRef]*pendingJoin
+	pendingJoinsMutex sync.Mutex
+
+	// Guards State.GameID of the clients, see setPlayerGame
+	playerGamesMutex sync.Mutex
 
 	// Database Statements
-	stmtGetHeroeByID                      *sql.Stmt
-	stmtDeleteServerStatsByGID            *sql.Stmt
-	stmtDeleteGameByGIDAndShard           *sql.Stmt
-	stmtAddGame                           *sql.Stmt
-	stmtGameIncreaseJoining               *sql.Stmt
-	stmtGameIncreaseTeam1                 *sql.Stmt
-	stmtGameIncreaseTeam2                 *sql.Stmt
-	stmtGameDecreaseTeam1                 *sql.Stmt
-	stmtGameDecreaseTeam2                 *sql.Stmt
-	stmtUpdateGame                        *sql.Stmt
-	mapGetStatsVariableAmount             map[int]*sql.Stmt
-	mapSetServerStatsVariableAmount       map[int]*sql.Stmt
-	mapSetServerPlayerStatsVariableAmount map[int]*sql.Stmt
+	stmtGetHeroeByID                   *lib.Stmt
+	stmtDeleteServerStatsByGIDAndShard *lib.Stmt
+	stmtDeleteGameByGIDAndShard        *lib.Stmt
+	stmtAddGame                        *lib.Stmt
+	stmtGameIncreaseJoining            *lib.Stmt
+	stmtGameDecreaseJoining            *lib.Stmt
+	stmtGameIncreaseTeam1              *lib.Stmt
+	stmtGameIncreaseTeam2              *lib.Stmt
+	stmtGameDecreaseTeam1              *lib.Stmt
+	stmtGameDecreaseTeam2              *lib.Stmt
+	stmtUpdateGame                     *lib.Stmt
+
+	// Statements depending on the amount of stats, by amount. The hero
+	// stats ones by stats table as well.
+	getStatsStatements             map[string]*lib.StmtCache
+	getStatsStatementsMutex        sync.Mutex
+	setServerStatsStatements       lib.StmtCache
+	setServerPlayerStatsStatements lib.StmtCache
 }
 
+// Shard identifies this instance in the games table
 var Shard string
 
+// knownQueries are the queries handled by the theater, others are counted
+// as metrics.UnknownCommand
+var knownQueries = map[string]bool{
+	"CONN": true,
+	"USER": true,
+	"LLST": true,
+	"GDAT": true,
+	"GPOP": true,
+	"GSUB": true,
+	"EGAM": true,
+	"ECNL": true,
+	"CGAM": true,
+	"UBRA": true,
+	"UGAM": true,
+	"EGRS": true,
+	"GLST": true,
+	"PENT": true,
+	"PLVT": true,
+	"UPLA": true,
+	"PING": true,
+}
+
 const COUNTER_GID_KEY = "counters:GID"
 
+// dbPingInterval is how often the db connection gets checked
+const dbPingInterval = time.Second * 30
+
 // New creates and starts a new TheaterManager
-func (tM *TheaterManager) New(name string, port string, db *sql.DB, redis *redis.Client, iDB *core.InfluxDB, localMode bool) {
+func (tM *TheaterManager) New(name string, port string, config Config, db *sql.DB, redis *redis.Client, iDB *core.InfluxDB, localMode bool) {
 	var err error
 
 	tM.socket = new(GameSpy.Socket)
-	tM.socketUDP = new(GameSpy.SocketUDP)
-	tM.db = db
+	socketUDP := new(GameSpy.SocketUDP)
+	tM.socketUDP = socketUDP
+	tM.db = new(lib.DB)
+	tM.db.New(db, dbPingInterval)
 	tM.redis = redis
 	tM.name = name
+	tM.config = config
 	tM.eventsChannel, err = tM.socket.New(tM.name, port, true)
 	tM.iDB = iDB
 	tM.localMode = localMode
 	if err != nil {
 		log.Errorln(err)
 	}
-	tM.eventsChannelUDP, err = tM.socketUDP.New(tM.name, port, true)
+	tM.eventsChannelUDP, err = socketUDP.New(tM.name, port, true)
 	if err != nil {
 		log.Errorln(err)
 	}
 	tM.stopTicker = make(chan bool, 1)
+	tM.stopPopulation = make(chan bool, 1)
+	tM.advertisedPorts = make(map[string]map[*GameSpy.Client]string)
+	tM.pendingServerStats = make(map[serverRef]map[string]string)
+	tM.pendingJoins = make(map[joinRef]*pendingJoin)
+	tM.gdatSubscriptions = make(map[*GameSpy.Client]string)
+	tM.rateLimits = make(map[*GameSpy.Client]*tokenBucket)
+	tM.scanSlots = make(chan struct{}, tM.config.MaxConcurrentScans)
 
 	// Prepare database statements
-	tM.mapGetStatsVariableAmount = make(map[int]*sql.Stmt)
-	tM.mapSetServerStatsVariableAmount = make(map[int]*sql.Stmt)
-	tM.mapSetServerPlayerStatsVariableAmount = make(map[int]*sql.Stmt)
 	tM.prepareStatements()
+	tM.warmStatements()
+
+	tM.bans = new(lib.BanChecker)
+	err = tM.bans.New(tM.db.Conn(), time.Second*30)
+	if err != nil {
+		log.Fatalln("Error preparing ban lookup.", err.Error())
+	}
 
-	// Collect metrics every 10 seconds
+	// Collect metrics and flush server stats every second
 	tM.batchTicker = time.NewTicker(time.Second * 1)
 	go func() {
-		for range tM.batchTicker.C {
-			tM.collectMetrics()
+		for {
+			select {
+			case <-tM.batchTicker.C:
+				tM.collectMetrics()
+				tM.flushServerStats()
+			case <-tM.stopTicker:
+				return
+			}
 		}
 	}()
 
+	tM.populationTicker = time.NewTicker(populationSnapshotInterval)
+	go tM.runPopulationSnapshots()
+
 	//tM.redis.Set(COUNTER_GID_KEY, 0, 0)
 
 	go tM.run()
 }
 
+// Stop stops the tickers and flushes everything still pending
+func (tM *TheaterManager) Stop() {
+	tM.batchTicker.Stop()
+	tM.stopTicker <- true
+	tM.populationTicker.Stop()
+	tM.stopPopulation <- true
+	tM.flushServerStats()
+}
+
 func (tM *TheaterManager) prepareStatements() {
 	var err error
 
+	tM.prepareStatsStatements()
+
 	tM.stmtGetHeroeByID, err = tM.db.Prepare(
 		"SELECT id, user_id, heroName, online" +
 			"	FROM game_heroes" +
@@ -142,8 +241,8 @@ func (tM *TheaterManager) prepareStatements() {
 		log.Fatalln("Error preparing stmtGetHeroeByID.", err.Error())
 	}
 
-	tM.stmtDeleteServerStatsByGID, err = tM.db.Prepare(
-		"DELETE FROM game_server_stats WHERE gid = ?")
+	tM.stmtDeleteServerStatsByGIDAndShard, err = tM.db.Prepare(
+		"DELETE FROM game_server_stats WHERE gid = ? AND shard = ?")
 	if err != nil {
 		log.Fatalln("Error preparing stmtClearGameServerStats.", err.Error())
 	}
@@ -186,6 +285,15 @@ func (tM *TheaterManager) prepareStatements() {
 		log.Fatalln("Error preparing stmtGameIncreaseJoining.", err.Error())
 	}
 
+	tM.stmtGameDecreaseJoining, err = tM.db.Prepare(
+		"UPDATE games SET " +
+			"	players_joining = players_joining - 1," +
+			"	updated_at = NOW()" +
+			"WHERE gid = ? AND shard = ?")
+	if err != nil {
+		log.Fatalln("Error preparing stmtGameDecreaseJoining.", err.Error())
+	}
+
 	tM.stmtGameIncreaseTeam1, err = tM.db.Prepare(
 		"UPDATE games SET " +
 			"	players_connected = players_connected + 1," +
@@ -237,112 +345,144 @@ func (tM *TheaterManager) prepareStatements() {
 	}
 }
 
-func (tM *TheaterManager) getStatsStatement(statsAmount int) *sql.Stmt {
-	var err error
+// prepareStatsStatements sets up the caches of the statements depending on
+// the amount of stats
+func (tM *TheaterManager) prepareStatsStatements() {
+	tM.getStatsStatements = make(map[string]*lib.StmtCache)
+	tM.setServerStatsStatements.New(tM.db, setServerStatsQuery)
+	tM.setServerPlayerStatsStatements.New(tM.db, setServerPlayerStatsQuery)
+}
 
-	// Check if we already have a statement prepared for that amount of stats
-	if statement, ok := tM.mapGetStatsVariableAmount[statsAmount]; ok {
-		return statement
+func (tM *TheaterManager) getStatsStatement(table string, statsAmount int) *lib.Stmt {
+	tM.getStatsStatementsMutex.Lock()
+	cache, ok := tM.getStatsStatements[table]
+	if !ok {
+		cache = new(lib.StmtCache)
+		cache.New(tM.db, getStatsQuery(table))
+		tM.getStatsStatements[table] = cache
 	}
+	tM.getStatsStatementsMutex.Unlock()
 
-	var query string
-	for i := 1; i < statsAmount; i++ {
-		query += "?, "
+	statement, err := cache.Get(statsAmount)
+	if err != nil {
+		log.Fatalln("Error preparing getStatsStatement with "+getStatsQuery(table)(statsAmount)+" query.", err.Error())
 	}
+	return statement
+}
 
-	sql := "SELECT game_heroes.user_id, game_heroes.id, game_heroes.heroName, game_stats.statsKey, game_stats.statsValue" +
-		"	FROM game_heroes" +
-		"	LEFT JOIN game_stats" +
-		"		ON game_stats.user_id = game_heroes.user_id" +
-		"		AND game_stats.heroID = game_heroes.id" +
-		"	WHERE game_heroes.id=?" +
-		"		AND game_stats.statsKey IN (" + query + "?)"
+// getStatsQuery binds statsAmount stats keys first and the hero id last
+func getStatsQuery(table string) func(statsAmount int) string {
+	return func(statsAmount int) string {
+		var query string
+		for i := 1; i < statsAmount; i++ {
+			query += "?, "
+		}
 
-	tM.mapGetStatsVariableAmount[statsAmount], err = tM.db.Prepare(sql)
-	if err != nil {
-		log.Fatalln("Error preparing stmtGetStatsVariableAmount with "+sql+" query.", err.Error())
+		return "SELECT game_heroes.user_id, game_heroes.id, game_heroes.heroName, stats.statsKey, stats.statsValue" +
+			"	FROM game_heroes" +
+			"	LEFT JOIN " + table + " AS stats" +
+			"		ON stats.user_id = game_heroes.user_id" +
+			"		AND stats.heroID = game_heroes.id" +
+			"		AND stats.statsKey IN (" + query + "?)" +
+			"	WHERE game_heroes.id=?"
 	}
-
-	return tM.mapGetStatsVariableAmount[statsAmount]
 }
 
-func (tM *TheaterManager) setServerStatsStatement(statsAmount int) *sql.Stmt {
-	var err error
-
-	// Check if we already have a statement prepared for that amount of stats
-	if statement, ok := tM.mapSetServerStatsVariableAmount[statsAmount]; ok {
-		return statement
+func (tM *TheaterManager) setServerStatsStatement(statsAmount int) *lib.Stmt {
+	statement, err := tM.setServerStatsStatements.Get(statsAmount)
+	if err != nil {
+		log.Fatalln("Error preparing setServerStatsStatement with "+setServerStatsQuery(statsAmount)+" query.", err.Error())
 	}
+	return statement
+}
 
+// setServerStatsQuery writes (gid, shard, statsKey, statsValue) rows. GIDs are
+// only unique per shard, so the unique key of game_server_stats has to be
+// (gid, shard, statsKey).
+func setServerStatsQuery(statsAmount int) string {
 	var query string
 	for i := 1; i < statsAmount; i++ {
-		query += "(?, ?, ?, NOW()), "
+		query += "(?, ?, ?, ?, NOW()), "
 	}
 
-	sql := "INSERT INTO game_server_stats" +
-		"	(gid, statsKey, statsValue, created_at)" +
-		"	VALUES " + query + "(?, ?, ?, NOW())" +
+	return "INSERT INTO game_server_stats" +
+		"	(gid, shard, statsKey, statsValue, created_at)" +
+		"	VALUES " + query + "(?, ?, ?, ?, NOW())" +
 		"	ON DUPLICATE KEY UPDATE" +
 		"	statsValue=VALUES(statsValue)," +
 		"   updated_at=NOW()"
+}
 
-	tM.mapSetServerStatsVariableAmount[statsAmount], err = tM.db.Prepare(sql)
+func (tM *TheaterManager) setServerPlayerStatsStatement(statsAmount int) *lib.Stmt {
+	statement, err := tM.setServerPlayerStatsStatements.Get(statsAmount)
 	if err != nil {
-		log.Fatalln("Error preparing setServerStatsStatement with "+sql+" query.", err.Error())
+		log.Fatalln("Error preparing setServerPlayerStatsStatement with "+setServerPlayerStatsQuery(statsAmount)+" query.", err.Error())
 	}
-
-	return tM.mapSetServerStatsVariableAmount[statsAmount]
+	return statement
 }
 
-func (tM *TheaterManager) setServerPlayerStatsStatement(statsAmount int) *sql.Stmt {
-	var err error
-
-	// Check if we already have a statement prepared for that amount of stats
-	if statement, ok := tM.mapSetServerPlayerStatsVariableAmount[statsAmount]; ok {
-		return statement
-	}
-
+func setServerPlayerStatsQuery(statsAmount int) string {
 	var query string
 	for i := 1; i < statsAmount; i++ {
 		query += "(?, ?, ?, ?, NOW()), "
 	}
 
-	sql := "INSERT INTO game_server_player_stats" +
+	return "INSERT INTO game_server_player_stats" +
 		"	(gid, pid, statsKey, statsValue, created_at)" +
 		"	VALUES " + query + "(?, ?, ?, ?, NOW())" +
 		"	ON DUPLICATE KEY UPDATE" +
 		"	statsValue=VALUES(statsValue)," +
 		"   updated_at=NOW()"
-
-	tM.mapSetServerPlayerStatsVariableAmount[statsAmount], err = tM.db.Prepare(sql)
-	if err != nil {
-		log.Fatalln("Error preparing mapSetServerPlayerStatsVariableAmount with "+sql+" query.", err.Error())
-	}
-
-	return tM.mapSetServerPlayerStatsVariableAmount[statsAmount]
 }
 
 func (tM *TheaterManager) closeStatements() {
-	// Close the dynamic lenght getStats statements
-	for index := range tM.mapGetStatsVariableAmount {
-		tM.mapGetStatsVariableAmount[index].Close()
-	}
+	// Close the dynamic lenght stats statements
+	tM.getStatsStatementsMutex.Lock()
+	for _, cache := range tM.getStatsStatements {
+		cache.Close()
+	}
+	tM.getStatsStatementsMutex.Unlock()
+	tM.setServerStatsStatements.Close()
+	tM.setServerPlayerStatsStatements.Close()
 }
 
 func (tM *TheaterManager) collectMetrics() {
 	// Create a point and add to batch
+	clients := len(tM.socket.ConnectedClients())
+
 	tags := map[string]string{"clients": "clients-total", "server": "theaterManager-" + tM.name}
 	fields := map[string]interface{}{
-		"clients": len(tM.socket.Clients),
+		"clients": clients,
 	}
 
 	tM.iDB.AddMetric("clients_total", tags, fields)
+
+	queueLength := 0
+	gameServers := 0
+	for shard, gameIDs := range tM.hostedGameIDs() {
+		gameServers += len(gameIDs)
+		for _, gameID := range gameIDs {
+			length, _ := strconv.Atoi(tM.redis.HGet(gameDataPrefix(shard)+":"+gameID, "QUEUE-LENGTH").Val())
+			queueLength += length
+		}
+	}
+
+	metrics.ClientsConnected.WithLabelValues(tM.name).Set(float64(clients))
+	metrics.GameServersActive.WithLabelValues(tM.name).Set(float64(gameServers))
+	metrics.QueueLength.WithLabelValues(tM.name).Set(float64(queueLength))
 }
 
 func (tM *TheaterManager) run() {
 	for {
 		select {
 		case event := <-tM.eventsChannelUDP:
+			if command, ok := event.Data.(*GameSpy.CommandFESL); ok {
+				if err := GameSpy.ValidateTheaterCommand(command); err != nil {
+					log.Warningln("Dropping malformed UDP command from", event.Addr, err)
+					continue
+				}
+			}
+
 			switch {
 			case event.Name == "command.ECHO":
 				go tM.ECHO(event)
@@ -353,9 +493,33 @@ func (tM *TheaterManager) run() {
 				log.Debugf("UDP Got event %s: %v", event.Name, event.Data)
 			}
 		case event := <-tM.eventsChannel:
+			if command, ok := event.Data.(GameSpy.EventClientFESLCommand); ok {
+				if err := GameSpy.ValidateTheaterCommand(command.Command); err != nil {
+					// Every command arrives twice, only answer the specific one
+					if event.Name != "client.command" {
+						tM.rejectCommand(command, err)
+					}
+					continue
+				}
+
+				if !tM.allowCommand(command, event.Name != "client.command", time.Now()) {
+					if event.Name != "client.command" {
+						tM.rejectRateLimited(command)
+					}
+					continue
+				}
+
+				if event.Name == "client.command" {
+					command.Client.Touch()
+					metrics.Commands.WithLabelValues(tM.name, metrics.CommandLabel(command.Command.Query, knownQueries)).Inc()
+				}
+			}
+
 			switch {
 			case event.Name == "newClient":
-				go tM.newClient(event.Data.(GameSpy.EventNewClient))
+				// Not in its own goroutine, close and error of the client
+				// need the heartbeat it starts
+				tM.newClient(event.Data.(GameSpy.EventNewClient))
 			case event.Name == "client.command.CONN":
 				go tM.CONN(event.Data.(GameSpy.EventClientFESLCommand))
 			case event.Name == "client.command.USER":
@@ -364,6 +528,10 @@ func (tM *TheaterManager) run() {
 				go tM.LLST(event.Data.(GameSpy.EventClientFESLCommand))
 			case event.Name == "client.command.GDAT":
 				go tM.GDAT(event.Data.(GameSpy.EventClientFESLCommand))
+			case event.Name == "client.command.GPOP":
+				go tM.GPOP(event.Data.(GameSpy.EventClientFESLCommand))
+			case event.Name == "client.command.GSUB":
+				go tM.GSUB(event.Data.(GameSpy.EventClientFESLCommand))
 			case event.Name == "client.command.EGAM":
 				go tM.EGAM(event.Data.(GameSpy.EventClientFESLCommand))
 			case event.Name == "client.command.ECNL":
@@ -384,8 +552,14 @@ func (tM *TheaterManager) run() {
 				go tM.PLVT(event.Data.(GameSpy.EventClientFESLCommand))
 			case event.Name == "client.command.UPLA":
 				go tM.UPLA(event.Data.(GameSpy.EventClientFESLCommand))
+			case event.Name == "client.command.PING":
+				go tM.PING(event.Data.(GameSpy.EventClientFESLCommand))
 			case event.Name == "client.close":
 				tM.close(event.Data.(GameSpy.EventClientClose))
+			case event.Name == "client.error":
+				data := event.Data.([]interface{})
+				err, _ := data[1].(error)
+				tM.error(GameSpy.EventClientError{Client: data[0].(*GameSpy.Client), Error: err})
 			case event.Name == "client.command":
 				tM.LogCommand(event.Data.(GameSpy.EventClientFESLCommand))
 				log.Debugf("Got event %s: %v", event.Name, event.Data.(GameSpy.EventClientFESLCommand).Command)
@@ -399,6 +573,14 @@ func (tM *TheaterManager) run() {
 	tM.closeStatements()
 }
 
+// rejectCommand answers a malformed command with a protocol error
+func (tM *TheaterManager) rejectCommand(event GameSpy.EventClientFESLCommand, err error) {
+	log.Warningln("Rejecting malformed command", event.Command.Query, "from", event.Client.IpAddr, err)
+	metrics.CommandOutcome(tM.name, metrics.CommandLabel(event.Command.Query, knownQueries), metrics.OutcomeRejected, "malformed")
+
+	tM.writeError(event.Client, event.Command.Query, event.Command.Message["TID"], GameSpy.ErrorCodeInvalid, err.Error())
+}
+
 // LogCommandUDP log data to a debug file for further analysis
 func (tM *TheaterManager) LogCommandUDP(event *GameSpy.CommandFESL) {
 	b, err := json.MarshalIndent(event.Message, "", "	")
@@ -453,50 +635,64 @@ func (tM *TheaterManager) newClient(event GameSpy.EventNewClient) {
 	}
 	log.Noteln("Client connecting")
 
-	// Start Heartbeat
-	event.Client.State.HeartTicker = time.NewTicker(time.Second * 15)
+	event.Client.Touch()
+
+	// Start Heartbeat, runs until the client closes or errors
+	ticker := time.NewTicker(heartbeatInterval)
+	ctx, cancel := context.WithCancel(context.Background())
+	event.Client.State.HeartTicker = ticker
+	event.Client.State.HeartCtx = ctx
+	event.Client.State.HeartCancel = cancel
 	go func() {
 		for {
-			if !event.Client.IsActive {
-				return
-			}
 			select {
-			case <-event.Client.State.HeartTicker.C:
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
 				if !event.Client.IsActive {
 					return
 				}
+				if tM.isIdle(event.Client, time.Now()) {
+					log.Noteln("Closing idle client", event.Client.IpAddr)
+					event.Client.Close()
+					return
+				}
 				pingPacket := make(map[string]string)
-				pingPacket["TID"] = "0"
+				pingPacket["TID"] = heartbeatTID
 				event.Client.WriteFESL("PING", pingPacket, 0x0)
 			}
 		}
 	}()
 }
 
+// stopHeartbeat ends the heartbeat of a client right away
+func stopHeartbeat(client *GameSpy.Client) {
+	if client.State.HeartCancel != nil {
+		client.State.HeartCancel()
+	}
+	if client.State.HeartTicker != nil {
+		client.State.HeartTicker.Stop()
+	}
+}
+
 func (tM *TheaterManager) close(event GameSpy.EventClientClose) {
 	log.Noteln("Client closed.")
 
-	if event.Client.RedisState != nil {
-
-		if event.Client.RedisState.Get("gdata:GID") != "" {
-
-			// Delete game from db
-			_, err := tM.stmtDeleteServerStatsByGID.Exec(event.Client.RedisState.Get("gdata:GID"))
-			if err != nil {
-				log.Errorln("Failed deleting settings for  "+event.Client.RedisState.Get("gdata:GID"), err.Error())
-			}
-
-			_, err = tM.stmtDeleteGameByGIDAndShard.Exec(event.Client.RedisState.Get("gdata:GID"), Shard)
-			if err != nil {
-				log.Errorln("Failed deleting game for "+event.Client.RedisState.Get("gdata:GID")+" and shard "+Shard, err.Error())
-			}
+	stopHeartbeat(event.Client)
+	tM.unsubscribeGDAT(event.Client)
+	tM.forgetRateLimit(event.Client)
+	if ip, _, ok := clientAddress(event.Client.IpAddr); ok {
+		tM.forgetAdvertisedPort(event.Client, ip)
+	}
 
-			// Delete game out of matchmaking array
-			delete(matchmaking.Games, event.Client.RedisState.Get("gdata:GID"))
+	if event.Client.RedisState != nil {
 
-			gameServer := new(lib.RedisObject)
-			gameServer.New(tM.redis, "gdata", event.Client.RedisState.Get("gdata:GID"))
-			gameServer.Delete()
+		// A server which created its game again on another connection
+		// owns it now
+		gameID := event.Client.RedisState.Get("gdata:GID")
+		if gameID != "" && matchmaking.RemoveGameOf(shardKey(event.Client.State.Shard, gameID), event.Client) {
+			tM.removeGameServer(event.Client.State.Shard, gameID)
+			tM.forgetGameID(event.Client, gameID)
 		}
 
 		event.Client.RedisState.Delete()
@@ -508,6 +704,34 @@ func (tM *TheaterManager) close(event GameSpy.EventClientClose) {
 
 }
 
-func (tM *TheaterManager) error(event GameSpy.EventClientTLSError) {
+// removeGameServer deletes everything we know about a game server. Who
+// hosts it is up to the callers, see matchmaking.RemoveGameOf.
+func (tM *TheaterManager) removeGameServer(shard string, gameID string) {
+	tM.dropServerStats(shard, gameID)
+	tM.cancelJoins(shard, gameID)
+
+	// Delete game from db
+	_, err := tM.stmtDeleteServerStatsByGIDAndShard.Exec(gameID, dbShard(shard))
+	if err != nil {
+		log.Errorln("Failed deleting settings for  "+gameID, err.Error())
+	}
+
+	_, err = tM.stmtDeleteGameByGIDAndShard.Exec(gameID, dbShard(shard))
+	if err != nil {
+		log.Errorln("Failed deleting game for "+gameID+" and shard "+dbShard(shard), err.Error())
+	}
+
+	gameServer := new(lib.RedisObject)
+	gameServer.New(tM.redis, gameDataPrefix(shard), gameID)
+	tM.releaseServerName(shard, gameID, gameServer.Get("NAME"))
+	gameServer.Delete()
+
+	tM.redis.Del(populationHistoryKey(shard, gameID))
+	tM.redis.Del(observersKey(shard, gameID))
+	tM.unsubscribeGame(shard, gameID)
+}
+
+func (tM *TheaterManager) error(event GameSpy.EventClientError) {
 	log.Noteln("Client threw an error: ", event.Error)
+	stopHeartbeat(event.Client)
 }
@@ -0,0 +1,35 @@
+package theater
+
+import (
+	"strings"
+
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+// serverVersion returns the build a game server registered with. Servers
+// which don't send B-version may still have sent V.
+func serverVersion(gameServer *lib.RedisObject) string {
+	if version := gameServer.Get("B-version"); version != "" {
+		return version
+	}
+	return gameServer.Get("V")
+}
+
+// versionCompatible checks if a client can join a server. Versions match
+// when all the components both of them have are equal, so "1.46" is
+// compatible with "1.46.222034.0". Unknown versions are always compatible.
+func versionCompatible(clientVersion string, serverVersion string) bool {
+	if clientVersion == "" || serverVersion == "" {
+		return true
+	}
+
+	clientParts := strings.Split(clientVersion, ".")
+	serverParts := strings.Split(serverVersion, ".")
+	for i := 0; i < len(clientParts) && i < len(serverParts); i++ {
+		if clientParts[i] != serverParts[i] {
+			return false
+		}
+	}
+
+	return true
+}
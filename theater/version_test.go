@@ -0,0 +1,25 @@
+package theater
+
+import "testing"
+
+func TestVersionCompatible(t *testing.T) {
+	tests := []struct {
+		client string
+		server string
+		want   bool
+	}{
+		{"1.46.222034", "1.46.222034.0", true},
+		{"1.46", "1.46.222034.0", true},
+		{"1.46.222034", "1.47.222035.0", false},
+		{"1.45.220000", "1.46.222034.0", false},
+		{"", "1.46.222034.0", true},
+		{"1.46.222034", "", true},
+	}
+
+	for _, test := range tests {
+		compatible := versionCompatible(test.client, test.server)
+		if compatible != test.want {
+			t.Errorf("versionCompatible was incorrect for %s and %s, got: %t, want: %t.", test.client, test.server, compatible, test.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package theater
+
+import "github.com/HeroesAwaken/GoFesl/log"
+
+// warmStatements prepares the statements of the configured key counts.
+// Flushes write the stats of a server in chunks of at most
+// serverStatsChunk, so those chunks get prepared for WarmServerStatsKeys.
+func (tM *TheaterManager) warmStatements() {
+	warmed := 0
+
+	for _, keys := range tM.config.WarmGetStatsKeys {
+		if keys <= 0 {
+			continue
+		}
+		for _, table := range StatsTables.Tables() {
+			tM.getStatsStatement(table, keys)
+			warmed++
+		}
+	}
+
+	for _, keys := range tM.config.WarmServerStatsKeys {
+		if keys >= serverStatsChunk {
+			tM.setServerStatsStatement(serverStatsChunk)
+			warmed++
+		}
+		if keys%serverStatsChunk > 0 {
+			tM.setServerStatsStatement(keys % serverStatsChunk)
+			warmed++
+		}
+	}
+
+	if warmed > 0 {
+		log.Noteln("Warmed", warmed, "stats statements")
+	}
+}
@@ -0,0 +1,39 @@
+package theater
+
+import (
+	"testing"
+
+	"github.com/HeroesAwaken/GoFesl/lib"
+)
+
+func TestWarmStatements(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+	tM.config.WarmGetStatsKeys = []int{4, 0}
+	tM.config.WarmServerStatsKeys = []int{6, 70}
+
+	mock := newTestDB(t, tM)
+	mock.ExpectPrepare("SELECT game_heroes.user_id")
+	mock.ExpectPrepare(`INSERT INTO game_server_stats\s+\(gid, shard, statsKey, statsValue, created_at\)\s+VALUES (\(\?, \?, \?, \?, NOW\(\)\), ){5}\(\?, \?, \?, \?, NOW\(\)\)\s+ON DUPLICATE`)
+	mock.ExpectPrepare(`INSERT INTO game_server_stats\s+\(gid, shard, statsKey, statsValue, created_at\)\s+VALUES (\(\?, \?, \?, \?, NOW\(\)\), ){63}\(\?, \?, \?, \?, NOW\(\)\)\s+ON DUPLICATE`)
+
+	tM.warmStatements()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("warmStatements was incorrect, %s", err)
+	}
+
+	// Requests of the warmed amounts must not prepare again
+	if _, err := tM.getStatsStatements[lib.DefaultStatsTable].Get(4); err != nil {
+		t.Errorf("getStatsStatements was incorrect, %s", err)
+	}
+	// ... and neither must the chunks a flush of 70 stats is split into
+	for _, keys := range []int{6, serverStatsChunk} {
+		if _, err := tM.setServerStatsStatements.Get(keys); err != nil {
+			t.Errorf("setServerStatsStatements was incorrect, %s", err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Warmed statements were incorrect, %s", err)
+	}
+}
@@ -0,0 +1,15 @@
+package theater
+
+import "github.com/HeroesAwaken/GoFesl/lib"
+
+// welcomeMessageKey is where servers put the message shown to joining
+// players in CGAM/UGAM
+const welcomeMessageKey = "B-U-welcome"
+
+const maxWelcomeLength = 128
+
+// welcomeMessage returns the sanitized welcome message of a game server,
+// empty if it has none
+func welcomeMessage(gameServer *lib.RedisObject) string {
+	return sanitizeText(gameServer.Get(welcomeMessageKey), maxWelcomeLength)
+}
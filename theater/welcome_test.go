@@ -0,0 +1,54 @@
+package theater
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/HeroesAwaken/GoFesl/lib"
+	"github.com/HeroesAwaken/GoFesl/matchmaking"
+)
+
+func TestEGEGWelcomeMessage(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	expectJoin(t, tM, "Joiner")
+
+	tM.redis.HSet("gdata:1", "GID", "1")
+
+	server, _ := newRecordedClient()
+	matchmaking.SetGame("1", server)
+	defer matchmaking.RemoveGame("1")
+
+	tM.UGAM(testCommand(server, "UGAM", map[string]string{"TID": "3", "GID": "1", "B-U-welcome": "\"Welcome to\nour server=\""}))
+
+	client, recorder := newJoiningClient(tM)
+	tM.EGAM(testCommand(client, "EGAM", map[string]string{"TID": "4", "GID": "1", "PORT": "40000"}))
+
+	packets := recorder.Packets()
+	if len(packets) != 2 || packets[1].Type != "EGEG" {
+		t.Fatalf("EGAM packets were incorrect, got: %v, want: EGAM and EGEG.", packets)
+	}
+	if welcome := packets[1].Message["WELCOME"]; welcome != "\"Welcome toour server\"" {
+		t.Errorf("EGEG WELCOME was incorrect, got: %s, want: %s.", welcome, "\"Welcome toour server\"")
+	}
+}
+
+func TestWelcomeMessageLength(t *testing.T) {
+	tM, cleanup := newTestTheater(t)
+	defer cleanup()
+
+	tM.redis.HSet("gdata:1", welcomeMessageKey, strings.Repeat("a", maxWelcomeLength+10))
+	tM.redis.HSet("gdata:2", "GID", "2")
+
+	server := new(lib.RedisObject)
+	server.New(tM.redis, "gdata", "1")
+	if welcome := welcomeMessage(server); len(welcome) != maxWelcomeLength {
+		t.Errorf("welcomeMessage length was incorrect, got: %d, want: %d.", len(welcome), maxWelcomeLength)
+	}
+
+	server.New(tM.redis, "gdata", "2")
+	if welcome := welcomeMessage(server); welcome != "" {
+		t.Errorf("welcomeMessage was incorrect, got: %s, want none.", welcome)
+	}
+}